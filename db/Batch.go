@@ -0,0 +1,239 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// BatchResult is the outcome of a batch submitted in chunks.
+// With SortBatch the chunks are made of the instances in the order of the primary key.
+type BatchResult struct {
+	// the affected rows of each submitted chunk, including the failed one
+	Chunks []int64
+	// the affected rows of all chunks
+	Total int64
+	// the index of the failed chunk, or -1 if all succeeded
+	Failed int
+	// the indexes, in the submitted slice, of the instances that were not applied, if a chunk failed.
+	// Outside a transaction the instances of the failed chunk before the failing one were applied
+	Pending []int
+}
+
+// Completed returns the number of chunks that were applied
+func (this *BatchResult) Completed() int {
+	if this.Failed < 0 {
+		return len(this.Chunks)
+	}
+	return this.Failed
+}
+
+// submits, one by one, the struct pointers of the slice, sorted by the primary key if requested
+func (this *DmlCore) submitBatch(instances interface{}, submit func(instance interface{}) (int64, error)) (int64, error) {
+	items, _, err := this.batchItems(instances)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, item := range items {
+		n, err := submit(item.Interface())
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// submits the struct pointers of the slice in chunks of the given size.
+// In a transaction, each chunk is protected by a savepoint, so that a failed chunk is rolled back as a whole,
+// keeping the previous chunks and leaving the transaction usable.
+func (this *DmlCore) submitChunks(instances interface{}, size int, submit func(instance interface{}) (int64, error)) (*BatchResult, error) {
+	if size < 1 {
+		return nil, errors.New(fmt.Sprintf("goSQL: Invalid chunk size %v", size))
+	}
+	items, indexes, err := this.batchItems(instances)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BatchResult{Failed: -1}
+	for chunk := 0; chunk*size < len(items); chunk++ {
+		end := (chunk + 1) * size
+		if end > len(items) {
+			end = len(items)
+		}
+		n, applied, err := this.submitChunk(items[chunk*size:end], submit)
+		result.Chunks = append(result.Chunks, n)
+		result.Total += n
+		if err != nil {
+			result.Failed = chunk
+			result.Pending = append([]int{}, indexes[chunk*size+applied:]...)
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// submits the instances of a chunk, returning the affected rows and the number of applied instances
+func (this *DmlCore) submitChunk(items []reflect.Value, submit func(instance interface{}) (int64, error)) (int64, int, error) {
+	tx, ok := this.db.GetConnection().(*MyTx)
+	if !ok || !this.db.InTransaction() {
+		var total int64
+		for k, item := range items {
+			n, err := submit(item.Interface())
+			total += n
+			if err != nil {
+				return total, k, err
+			}
+		}
+		return total, len(items), nil
+	}
+
+	var total int64
+	err := tx.inSavepoint(this.db.GetTranslator(), "SB_"+strconv.Itoa(tx.depth), func() error {
+		for _, item := range items {
+			n, err := submit(item.Interface())
+			if err != nil {
+				return err
+			}
+			total += n
+		}
+		return nil
+	})
+	if err != nil {
+		// nothing of the chunk remains
+		return 0, 0, err
+	}
+	return total, len(items), nil
+}
+
+// the struct pointers of the slice, sorted by the primary key if requested,
+// and their indexes in the slice
+func (this *DmlCore) batchItems(instances interface{}) ([]reflect.Value, []int, error) {
+	v := reflect.ValueOf(instances)
+	if v.Kind() != reflect.Slice {
+		return nil, nil, errors.New(fmt.Sprintf("goSQL: Expected a slice of struct pointers. Got %T", instances))
+	}
+
+	items := make([]reflect.Value, v.Len())
+	indexes := make([]int, v.Len())
+	for k := range items {
+		items[k] = v.Index(k)
+		indexes[k] = k
+	}
+	if this.sortBatch && len(items) > 1 {
+		if err := this.sortByKey(items, indexes); err != nil {
+			return nil, nil, err
+		}
+	}
+	return items, indexes, nil
+}
+
+// sorts the instances, and their indexes, by the values of the key columns,
+// imposing a consistent lock acquisition order. Instances without key values come first.
+func (this *DmlCore) sortByKey(items []reflect.Value, indexes []int) error {
+	typ := items[0].Type()
+	if typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Struct {
+		return errors.New(fmt.Sprintf("goSQL: Expected a slice of struct pointers. Got []%s", typ))
+	}
+	mappings := PopulateMapping("", typ.Elem())
+
+	var properties []*EntityProperty
+	for e := this.table.GetKeyColumns().Enumerator(); e.HasNext(); {
+		column := e.Next().(*Column)
+		if bp := mappings[column.GetAlias()]; bp != nil {
+			properties = append(properties, bp)
+		}
+	}
+	if len(properties) == 0 {
+		return nil
+	}
+
+	type keyed struct {
+		item  reflect.Value
+		index int
+		key   []interface{}
+	}
+	sorted := make([]keyed, len(items))
+	for i, item := range items {
+		values := make([]interface{}, len(properties))
+		if !item.IsNil() {
+			elem := item.Elem()
+			for k, bp := range properties {
+				if val := reflect.Indirect(bp.Get(elem)); val.IsValid() {
+					values[k] = val.Interface()
+				}
+			}
+		}
+		sorted[i] = keyed{item, indexes[i], values}
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].key, sorted[j].key
+		for k := range a {
+			if c := compareKey(a[k], b[k]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	for i := range sorted {
+		items[i] = sorted[i].item
+		indexes[i] = sorted[i].index
+	}
+	return nil
+}
+
+func compareKey(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	if t, ok := a.(time.Time); ok {
+		if u, ok := b.(time.Time); ok {
+			switch {
+			case t.Before(u):
+				return -1
+			case t.After(u):
+				return 1
+			}
+			return 0
+		}
+	}
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Kind() == vb.Kind() {
+		switch va.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return compareOrdered(va.Int() < vb.Int(), va.Int() > vb.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return compareOrdered(va.Uint() < vb.Uint(), va.Uint() > vb.Uint())
+		case reflect.Float32, reflect.Float64:
+			return compareOrdered(va.Float() < vb.Float(), va.Float() > vb.Float())
+		case reflect.String:
+			return compareOrdered(va.String() < vb.String(), va.String() > vb.String())
+		}
+	}
+	sa, sb := fmt.Sprint(a), fmt.Sprint(b)
+	return compareOrdered(sa < sb, sa > sb)
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
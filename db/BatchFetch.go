@@ -0,0 +1,154 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// association loaded with a second query. See Query.FetchBatch
+type batchFetch struct {
+	association *Association
+	columns     []Tokener
+	criteria    *Criteria
+}
+
+// the slice parameter with the keys of the parents. Being a slice, the IN is split when it exceeds
+// the maximum parameters of the database
+const batchKeysParam = "batch_keys"
+
+// copies the batches, deep copying their columns and criteria with the cloner
+func cloneBatches(c *cloner, batches []*batchFetch) []*batchFetch {
+	if batches == nil {
+		return nil
+	}
+	others := make([]*batchFetch, len(batches))
+	for k, v := range batches {
+		others[k] = &batchFetch{v.association, c.tokenList(v.columns), c.criteria(v.criteria)}
+	}
+	return others
+}
+
+func (this *Query) fetchBatches(parents []reflect.Value) error {
+	if len(parents) == 0 {
+		return nil
+	}
+	for _, batch := range this.batches {
+		if err := batch.fetch(this, parents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetches the children of all the parents with one query and sets them in the parents
+func (this *batchFetch) fetch(parentQuery *Query, parents []reflect.Value) error {
+	association := this.association
+	relation := association.GetRelations()[0]
+	from := relation.From.GetColumn()
+	to := relation.To.GetColumn()
+
+	mappings := PopulateMapping("", parents[0].Type())
+	keyProperty := mappings[from.GetAlias()]
+	if keyProperty == nil {
+		return errors.New(fmt.Sprintf("goSQL: No field %s for the association %s", from.GetAlias(), association.String()))
+	}
+	target := mappings[association.Alias]
+	if target == nil {
+		return errors.New(fmt.Sprintf("goSQL: No field %s for the association %s", association.Alias, association.String()))
+	}
+
+	// group the parents by key
+	byKey := make(map[string][]reflect.Value)
+	keys := make([]interface{}, 0)
+	for _, parent := range parents {
+		key, ok := batchKey(keyProperty.Get(parent))
+		if !ok {
+			continue
+		}
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, reflect.Indirect(keyProperty.Get(parent)).Interface())
+		}
+		byKey[key] = append(byKey[key], parent)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	query := parentQuery.db.Query(association.GetTableTo())
+	if parentQuery.forcePrimary {
+		query.ForcePrimary()
+	}
+	if len(this.columns) == 0 {
+		query.All()
+	} else {
+		query.Column(to)
+		for _, c := range this.columns {
+			if ch, ok := c.(*ColumnHolder); !ok || !ch.GetColumn().Equals(to) {
+				query.Column(c)
+			}
+		}
+	}
+	criterias := []*Criteria{to.In(Param(batchKeysParam))}
+	if this.criteria != nil {
+		criterias = append(criterias, this.criteria.Clone().(*Criteria))
+	}
+	for _, discriminator := range association.GetDiscriminators() {
+		criterias = append(criterias, discriminator.Criteria())
+	}
+	query.Where(criterias...)
+	query.SetParameter(batchKeysParam, keys)
+
+	// the children are always pointers to structs
+	childType := target.Type
+	if target.IsMany() {
+		childType = target.InnerType
+	}
+	if childType.Kind() != reflect.Ptr {
+		childType = reflect.PtrTo(childType)
+	}
+	children := reflect.New(reflect.SliceOf(childType))
+	if err := query.List(children.Interface()); err != nil {
+		return err
+	}
+	children = children.Elem()
+	if children.Len() == 0 {
+		return nil
+	}
+
+	childKeyProperty := PopulateMapping("", childType)[to.GetAlias()]
+	if childKeyProperty == nil {
+		return errors.New(fmt.Sprintf("goSQL: No field %s for the association %s", to.GetAlias(), association.String()))
+	}
+	for i := 0; i < children.Len(); i++ {
+		child := children.Index(i)
+		key, ok := batchKey(childKeyProperty.Get(child))
+		if !ok {
+			continue
+		}
+		for _, parent := range byKey[key] {
+			field := target.Get(parent)
+			value := child
+			if field.Kind() != reflect.Ptr && (!target.IsMany() || target.InnerType.Kind() != reflect.Ptr) {
+				value = child.Elem()
+			}
+			if target.IsMany() {
+				field.Set(reflect.Append(field, value))
+			} else {
+				field.Set(value)
+			}
+		}
+	}
+	return nil
+}
+
+// the key values of the parents and of the children may have different types (ex: int64 and *int64)
+func batchKey(v reflect.Value) (string, bool) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+	return fmt.Sprint(v.Interface()), true
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var _ Converter = &BoolConverter{}
+
+// BoolConverter is a Converter that binds a bool as the representation used by legacy schemas,
+// like 'Y'/'N' or 1/0, and reads it back as a bool.
+//
+// ex: BOOK.COLUMN("ACTIVE").BoolAs("Y", "N")
+type BoolConverter struct {
+	trueValue  interface{}
+	falseValue interface{}
+}
+
+func NewBoolConverter(trueValue interface{}, falseValue interface{}) *BoolConverter {
+	this := new(BoolConverter)
+	this.trueValue = trueValue
+	this.falseValue = falseValue
+	return this
+}
+
+// ToDb converts a bool or *bool into its representation
+func (this *BoolConverter) ToDb(in interface{}) (interface{}, error) {
+	switch v := in.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		return this.represent(v), nil
+	case *bool:
+		if v == nil {
+			return nil, nil
+		}
+		return this.represent(*v), nil
+	}
+	return nil, errors.New(fmt.Sprintf("goSQL: Expected a bool. Got %T", in))
+}
+
+func (this *BoolConverter) represent(b bool) interface{} {
+	if b {
+		return this.trueValue
+	}
+	return this.falseValue
+}
+
+func (this *BoolConverter) FromDbInstance() interface{} {
+	return new(interface{})
+}
+
+// FromDb converts the representation into a bool.
+// Text values are compared ignoring the padding of CHAR columns.
+func (this *BoolConverter) FromDb(in interface{}) (interface{}, error) {
+	value := *(in.(*interface{}))
+	if value == nil {
+		return nil, nil
+	}
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	s := strings.TrimSpace(fmt.Sprint(value))
+	switch s {
+	case fmt.Sprint(this.trueValue):
+		return true, nil
+	case fmt.Sprint(this.falseValue):
+		return false, nil
+	}
+	return nil, errors.New(fmt.Sprintf("goSQL: Unable to convert %v to a bool. Expected %v or %v", value, this.trueValue, this.falseValue))
+}
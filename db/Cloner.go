@@ -0,0 +1,301 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+)
+
+// cloner deep copies the structures of a query,
+// keeping the sharing between them (ex: a token that is both in a path element and in the columns list).
+// Associations are not copied since they are not changed after being prepared,
+// unless the table aliases are remapped.
+type cloner struct {
+	tokens       map[Tokener]Tokener
+	paths        map[*PathElement]*PathElement
+	orders       map[*Order]*Order
+	associations map[*Association]*Association
+	// the table aliases to replace in the copy
+	aliases map[string]string
+	// the prefix of the raw parameters to replace in the copy, and its replacement
+	rawPrefix    string
+	newRawPrefix string
+}
+
+func newCloner() *cloner {
+	this := new(cloner)
+	this.tokens = make(map[Tokener]Tokener)
+	this.paths = make(map[*PathElement]*PathElement)
+	this.orders = make(map[*Order]*Order)
+	this.associations = make(map[*Association]*Association)
+	return this
+}
+
+// a cloner replacing the main table alias of the statement, and the join aliases generated from it, by alias
+func newAliasCloner(base *DmlBase, alias string) *cloner {
+	this := newCloner()
+	this.aliases = map[string]string{base.tableAlias: alias}
+	prefix := base.tableAlias + "_" + base.joinPrefix
+	for it := base.joinBag.bag.Iterator(); it.HasNext(); {
+		a := it.Next().Value.(string)
+		if strings.HasPrefix(a, prefix) {
+			this.aliases[a] = alias + "_" + base.joinPrefix + a[len(prefix):]
+		}
+	}
+	this.rawPrefix = base.tableAlias + "_R"
+	this.newRawPrefix = alias + "_R"
+	return this
+}
+
+// the raw parameter name in the copy
+func (this *cloner) param(name string) string {
+	if this.rawPrefix != "" && strings.HasPrefix(name, this.rawPrefix) {
+		if _, err := strconv.Atoi(name[len(this.rawPrefix):]); err == nil {
+			return this.newRawPrefix + name[len(this.rawPrefix):]
+		}
+	}
+	return name
+}
+
+// the table alias in the copy
+func (this *cloner) alias(a string) string {
+	if c, ok := this.aliases[a]; ok {
+		return c
+	}
+	return a
+}
+
+func (this *cloner) token(t Tokener) Tokener {
+	if t == nil {
+		return nil
+	}
+	if c, ok := this.tokens[t]; ok {
+		return c
+	}
+
+	var c Tokener
+	switch o := t.(type) {
+	case *ColumnHolder:
+		ch := NewColumnHolder(o.column)
+		ch.Alias = o.Alias
+		ch.tableAlias = this.alias(o.tableAlias)
+		ch.pseudoTableAlias = this.alias(o.pseudoTableAlias)
+		c = ch
+	case *Criteria:
+		c = &Criteria{this.plainToken(o.Token), o.IsNot}
+	case *Token:
+		c = this.plainToken(o)
+	default:
+		c = t.Clone().(Tokener)
+	}
+	this.tokens[t] = c
+	return c
+}
+
+func (this *cloner) plainToken(t *Token) *Token {
+	if t == nil {
+		return nil
+	}
+	c := new(Token)
+	c.Operator = t.Operator
+	c.Alias = t.Alias
+	c.tableAlias = this.alias(t.tableAlias)
+	c.pseudoTableAlias = this.alias(t.pseudoTableAlias)
+	if q, ok := t.Value.(*Query); ok && this.aliases != nil {
+		// a correlated subquery refers to the remapped aliases
+		sub := newCloner()
+		sub.aliases = this.aliases
+		sub.rawPrefix = this.rawPrefix
+		sub.newRawPrefix = this.newRawPrefix
+		c.Value = q.clone(sub)
+	} else if ok {
+		c.Value = q.Clone()
+	} else if name, ok := t.Value.(string); ok && t.Operator == TOKEN_PARAM {
+		c.Value = this.param(name)
+	} else {
+		c.Value = t.Value
+	}
+	c.Members = this.tokenList(t.Members)
+	return c
+}
+
+func (this *cloner) criteria(c *Criteria) *Criteria {
+	if c == nil {
+		return nil
+	}
+	return this.token(c).(*Criteria)
+}
+
+func (this *cloner) criteriaList(criterias []*Criteria) []*Criteria {
+	if criterias == nil {
+		return nil
+	}
+	list := make([]*Criteria, len(criterias))
+	for k, v := range criterias {
+		list[k] = this.criteria(v)
+	}
+	return list
+}
+
+func (this *cloner) tokenList(tokens []Tokener) []Tokener {
+	if tokens == nil {
+		return nil
+	}
+	list := make([]Tokener, len(tokens))
+	for k, v := range tokens {
+		list[k] = this.token(v)
+	}
+	return list
+}
+
+func (this *cloner) order(o *Order) *Order {
+	if o == nil {
+		return nil
+	}
+	if c, ok := this.orders[o]; ok {
+		return c
+	}
+	c := new(Order)
+	c.alias = o.alias
+	c.asc = o.asc
+	c.collation = o.collation
+	c.ignoreCase = o.ignoreCase
+	if o.column != nil {
+		c.column = this.token(o.column).(*ColumnHolder)
+	}
+	this.orders[o] = c
+	return c
+}
+
+func (this *cloner) orderList(orders []*Order) []*Order {
+	if orders == nil {
+		return nil
+	}
+	list := make([]*Order, len(orders))
+	for k, v := range orders {
+		list[k] = this.order(v)
+	}
+	return list
+}
+
+func (this *cloner) path(pe *PathElement) *PathElement {
+	if pe == nil {
+		return nil
+	}
+	if c, ok := this.paths[pe]; ok {
+		return c
+	}
+	c := new(PathElement)
+	c.Base = pe.Base
+	c.Derived = this.association(pe.Derived)
+	c.Inner = pe.Inner
+	c.Criteria = this.criteria(pe.Criteria)
+	c.Columns = this.tokenList(pe.Columns)
+	c.Orders = this.orderList(pe.Orders)
+	c.PreferredAlias = pe.PreferredAlias
+	this.paths[pe] = c
+	return c
+}
+
+// copies the prepared association only if the aliases are remapped
+func (this *cloner) association(a *Association) *Association {
+	if a == nil || this.aliases == nil {
+		return a
+	}
+	if c, ok := this.associations[a]; ok {
+		return c
+	}
+	c := NewAssociationCopy(a)
+	c.aliasFrom = this.alias(a.aliasFrom)
+	c.aliasTo = this.alias(a.aliasTo)
+	for k, rel := range a.relations {
+		c.relations[k].From.tableAlias = this.alias(rel.From.tableAlias)
+		c.relations[k].To.tableAlias = this.alias(rel.To.tableAlias)
+	}
+	if a.IsMany2Many() {
+		c.FromM2M = this.association(a.FromM2M)
+		c.ToM2M = this.association(a.ToM2M)
+	}
+	this.associations[a] = c
+	return c
+}
+
+func (this *cloner) pathList(path []*PathElement) []*PathElement {
+	if path == nil {
+		return nil
+	}
+	list := make([]*PathElement, len(path))
+	for k, v := range path {
+		list[k] = this.path(v)
+	}
+	return list
+}
+
+func (this *cloner) join(join *Join) *Join {
+	if join == nil {
+		return nil
+	}
+	return &Join{this.pathList(join.associations), join.fetch}
+}
+
+func (this *cloner) aliasBag(bag *AliasBag) *AliasBag {
+	if bag == nil {
+		return nil
+	}
+	c := NewAliasBag(bag.prefix)
+	c.counter = bag.counter
+	for it := bag.bag.Iterator(); it.HasNext(); {
+		entry := it.Next()
+		c.bag.Put(this.association(entry.Key.(*Association)), this.alias(entry.Value.(string)))
+	}
+	return c
+}
+
+// copies the DmlBase state into other
+func (this *cloner) dmlBase(from *DmlBase, other *DmlBase) {
+	other.table = from.table
+	other.tableAlias = this.alias(from.tableAlias)
+	other.joinPrefix = from.joinPrefix
+	other.joinBag = this.aliasBag(from.joinBag)
+	if other.tableAlias != from.tableAlias {
+		other.joinBag.prefix = other.tableAlias + "_" + other.joinPrefix
+	}
+	other.lastFkAlias = this.alias(from.lastFkAlias)
+	other.discriminatorCriterias = this.criteriaList(from.discriminatorCriterias)
+	other.combiner = from.combiner
+	other.rawIndex = from.rawIndex
+	other.criteria = this.criteria(from.criteria)
+	other.restrictions = this.criteriaList(from.restrictions)
+
+	other.parameters = make(map[string]interface{}, len(from.parameters))
+	for k, v := range from.parameters {
+		other.parameters[this.param(k)] = v
+	}
+	other.paramColumns = make(map[string]*Column, len(from.paramColumns))
+	for k, v := range from.paramColumns {
+		other.paramColumns[this.param(k)] = v
+	}
+
+	if from.joins != nil {
+		other.joins = make([]*Join, len(from.joins))
+		for k, v := range from.joins {
+			other.joins[k] = this.join(v)
+			if v == from.lastJoin {
+				other.lastJoin = other.joins[k]
+			}
+		}
+	}
+	if from.cachedAssociation != nil {
+		other.cachedAssociation = make([][]*PathElement, len(from.cachedAssociation))
+		for k, v := range from.cachedAssociation {
+			other.cachedAssociation[k] = this.pathList(v)
+		}
+	}
+	other.path = this.pathList(from.path)
+	other.maxJoinDepth = from.maxJoinDepth
+	other.strictTypes = from.strictTypes
+
+	// with remapped aliases the SQL is generated again
+	if from.rawSQL != nil && this.aliases == nil {
+		other.rawSQL = from.rawSQL.Clone().(*RawSql)
+	}
+}
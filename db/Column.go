@@ -2,9 +2,57 @@ package db
 
 import (
 	tk "github.com/quintans/toolkit"
+
+	"database/sql/driver"
+	"reflect"
 	"strings"
+	"time"
+)
+
+// how a zero value, coming from a struct, is inserted or updated
+type ZeroMode int
+
+const (
+	// the zero value is written as is
+	ZERO_KEEP ZeroMode = iota
+	// the column is omitted, letting the database default apply on insert and keeping the current value on update
+	ZERO_OMIT
+	// NULL is written
+	ZERO_NULL
 )
 
+// the declared type of a column, used to validate the bound values
+type ColumnType int
+
+const (
+	// any value is accepted
+	TYPE_ANY ColumnType = iota
+	TYPE_INTEGER
+	TYPE_DECIMAL
+	TYPE_STRING
+	TYPE_BOOLEAN
+	TYPE_TIME
+	TYPE_BYTES
+)
+
+func (this ColumnType) String() string {
+	switch this {
+	case TYPE_INTEGER:
+		return "INTEGER"
+	case TYPE_DECIMAL:
+		return "DECIMAL"
+	case TYPE_STRING:
+		return "STRING"
+	case TYPE_BOOLEAN:
+		return "BOOLEAN"
+	case TYPE_TIME:
+		return "TIME"
+	case TYPE_BYTES:
+		return "BYTES"
+	}
+	return "ANY"
+}
+
 type Column struct {
 	table     *Table // the table that this column belongs
 	name      string // column name
@@ -13,6 +61,11 @@ type Column struct {
 	mandatory bool
 	version   bool
 	deletion  bool
+	converter Converter
+	zeroMode  ZeroMode
+	virtual   Tokener // expression of a virtual column
+	secret    bool
+	typ       ColumnType
 	hash      int
 }
 
@@ -67,6 +120,129 @@ func (this *Column) Deletion() *Column {
 	return this
 }
 
+// OmitZero omits this column when inserting or updating a struct with a zero value in the mapped field.
+// The same can be declared in the struct field with the tag `sql:"omitzero"`
+func (this *Column) OmitZero() *Column {
+	this.zeroMode = ZERO_OMIT
+	return this
+}
+
+// NullZero writes NULL when inserting or updating a struct with a zero value in the mapped field.
+// The same can be declared in the struct field with the tag `sql:"nullzero"`
+func (this *Column) NullZero() *Column {
+	this.zeroMode = ZERO_NULL
+	return this
+}
+
+func (this *Column) GetZeroMode() ZeroMode {
+	return this.zeroMode
+}
+
+// Secret marks this column as holding sensitive data, so that the values bound to it are never logged
+func (this *Column) Secret() *Column {
+	this.secret = true
+	return this
+}
+
+func (this *Column) IsSecret() bool {
+	return this.secret
+}
+
+// Type declares the type of this column.
+// With strict types, enabled in the store or in the statement, values of an incompatible Go kind are rejected.
+func (this *Column) Type(typ ColumnType) *Column {
+	this.typ = typ
+	return this
+}
+
+func (this *Column) GetType() ColumnType {
+	return this.typ
+}
+
+// Accepts checks if the value is compatible with the declared type of this column.
+// nil, deferred values, values handled by a converter and undeclared types are always accepted.
+// The elements of a slice, used in IN, are checked individually.
+func (this *Column) Accepts(value interface{}) bool {
+	if this.typ == TYPE_ANY || this.converter != nil {
+		return true
+	}
+	if _, ok := value.(func() interface{}); ok {
+		return true
+	}
+	return acceptsValue(this.typ, reflect.ValueOf(value))
+}
+
+func acceptsValue(typ ColumnType, v reflect.Value) bool {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return true
+	}
+	if v.CanInterface() {
+		if _, ok := v.Interface().(time.Time); ok {
+			return typ == TYPE_TIME
+		}
+		if valuer, ok := v.Interface().(driver.Valuer); ok {
+			dv, err := valuer.Value()
+			return err != nil || acceptsValue(typ, reflect.ValueOf(dv))
+		}
+	}
+
+	kind := v.Kind()
+	switch {
+	case kind == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		return typ == TYPE_BYTES
+	case kind == reflect.Slice || kind == reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if !acceptsValue(typ, v.Index(i)) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch typ {
+	case TYPE_INTEGER:
+		return kind >= reflect.Int && kind <= reflect.Uint64
+	case TYPE_DECIMAL:
+		return kind >= reflect.Int && kind <= reflect.Uint64 || kind == reflect.Float32 || kind == reflect.Float64
+	case TYPE_STRING:
+		return kind == reflect.String
+	case TYPE_BOOLEAN:
+		return kind == reflect.Bool
+	}
+	return false
+}
+
+// Convert defines the converter used when binding and reading the values of this column
+func (this *Column) Convert(converter Converter) *Column {
+	this.converter = converter
+	return this
+}
+
+// Encrypt encrypts the values of this column with the keys of the provider. See Encrypter.
+// The column is also marked as secret, so that the plain values bound to it are never logged.
+func (this *Column) Encrypt(provider KeyProvider) *Column {
+	this.Convert(NewEncrypter(provider))
+	return this.Secret()
+}
+
+// BoolAs binds the bool values of this column with the representations of true and false,
+// and reads them back as bool. See BoolConverter.
+//
+// ex: BOOK.COLUMN("ACTIVE").BoolAs("Y", "N")
+func (this *Column) BoolAs(trueValue interface{}, falseValue interface{}) *Column {
+	return this.Convert(NewBoolConverter(trueValue, falseValue))
+}
+
+func (this *Column) GetConverter() Converter {
+	return this.converter
+}
+
 //	Gets the table that this column belongs to
 //
 //	returns the table
@@ -108,6 +284,25 @@ func (this *Column) IsDeletion() bool {
 	return this.deletion
 }
 
+// IsVirtual returns true if this column is computed by an expression
+// and does not exist in the table.
+func (this *Column) IsVirtual() bool {
+	return this.virtual != nil
+}
+
+// GetVirtual returns the expression of a virtual column
+func (this *Column) GetVirtual() Tokener {
+	return this.virtual
+}
+
+// VirtualFor returns a deep copy of the expression of a virtual column, resolved with the table alias.
+// The expression is shared by all the queries, so it is never changed.
+func (this *Column) VirtualFor(tableAlias string) Tokener {
+	expr := newCloner().token(this.virtual)
+	expr.SetTableAlias(tableAlias)
+	return expr
+}
+
 //	/**
 //	 * devolve a representação em String desta coluna.
 //	 *
@@ -0,0 +1,19 @@
+package db
+
+// Materialization of a common table expression
+type Materialization int
+
+const (
+	MATERIALIZATION_DEFAULT Materialization = iota // decided by the database
+	MATERIALIZED                                   // computed once
+	NOT_MATERIALIZED                               // inlined in the main query
+)
+
+// CommonTable is a common table expression (WITH name AS (...)) of a query.
+// The table declares the name and the columns of the expression,
+// that are selected by the query in the same order.
+type CommonTable struct {
+	Table           *Table
+	Query           *Query
+	Materialization Materialization
+}
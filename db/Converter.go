@@ -0,0 +1,12 @@
+package db
+
+// Converter converts the values of a column between Go and the database.
+// ex: binding a Go slice to a Postgres array column.
+type Converter interface {
+	// ToDb converts the Go value into the value to bind to the statement
+	ToDb(in interface{}) (interface{}, error)
+	// FromDbInstance returns a new holder where the database value will be scanned into
+	FromDbInstance() interface{}
+	// FromDb converts the scanned holder into the value of the struct field
+	FromDb(in interface{}) (interface{}, error)
+}
@@ -1,5 +1,7 @@
 package db
 
+import "fmt"
+
 /*
  * Criteria
  */
@@ -13,9 +15,25 @@ var _ Tokener = &Criteria{}
 func NewCriteria(operator string, members ...interface{}) *Criteria {
 	c := new(Criteria)
 	c.Token = NewToken(operator, members...)
+	// the values of an encrypted column are only known after decrypting them
+	if operator != TOKEN_ISNULL {
+		for _, member := range c.Token.GetMembers() {
+			if holder, ok := member.(*ColumnHolder); ok {
+				if _, encrypted := holder.GetColumn().GetConverter().(*Encrypter); encrypted {
+					panic(fmt.Sprintf("goSQL: The encrypted column %s can only be used in a criteria with IsNull", holder.GetColumn()))
+				}
+			}
+		}
+	}
 	return c
 }
 
+// As defines the output name of the criteria when used in the select list, keeping the criteria type
+func (this *Criteria) As(alias string) *Criteria {
+	this.Alias = alias
+	return this
+}
+
 func (this *Criteria) Not() *Criteria {
 	this.IsNot = true
 	return this
@@ -59,10 +77,14 @@ func (this *Criteria) Clone() interface{} {
 	return c
 }
 
-func (this *Criteria) And(criteria *Criteria) *Criteria {
-	return And(this, criteria)
+// And combines this criteria with the others using AND.
+// ex: BOOK_C_PRICE.Greater(10).And(BOOK_C_NAME.Like("%book"))
+func (this *Criteria) And(criterias ...*Criteria) *Criteria {
+	return And(append([]*Criteria{this}, criterias...)...)
 }
 
-func (this *Criteria) Or(criteria *Criteria) *Criteria {
-	return Or(this, criteria)
+// Or combines this criteria with the others using OR.
+// ex: BOOK_C_PRICE.Lesser(10).Or(BOOK_C_PRICE.Greater(30))
+func (this *Criteria) Or(criterias ...*Criteria) *Criteria {
+	return Or(append([]*Criteria{this}, criterias...)...)
 }
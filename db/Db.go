@@ -1,9 +1,12 @@
 package db
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/quintans/goSQL/dbx"
 	. "github.com/quintans/toolkit/ext"
@@ -18,6 +21,8 @@ var VERSION_SET_MSG = "Unable to set Version data."
 const (
 	sqlOmitionKey = "sql"
 	sqlOmitionVal = "omit"
+	sqlOmitZero   = "omitzero"
+	sqlNullZero   = "nullzero"
 )
 
 // Interface that a struct must implement to inform what columns where changed
@@ -53,15 +58,56 @@ func (this *Marker) Unmark() {
 type IDb interface {
 	GetTranslator() Translator
 	GetConnection() dbx.IConnection
+	// GetReadConnection returns the connection for queries.
+	// Inside a transaction it is always the primary connection.
+	GetReadConnection() dbx.IConnection
+	SetReadConnection(connection dbx.IConnection)
+	// interceptors applied to all the SQL executed by this IDb
+	AddInterceptor(interceptors ...dbx.Interceptor)
+	GetInterceptors() []dbx.Interceptor
+	// logger for the SQL executed by this IDb. If nil, the package logger is used
+	SetLogger(logger dbx.Logger)
+	GetLogger() dbx.Logger
+	// records the SQL instead of executing it. If nil, the SQL is executed
+	SetDryRun(dryRun *dbx.DryRun)
+	GetDryRun() *dbx.DryRun
+	// location of the time parameters and of the scanned times. If nil, the times are not converted
+	SetLocation(location *time.Location)
+	GetLocation() *time.Location
+	// comment appended to all the SQL executed by this IDb. ex: app=billing,req=abc123
+	SetComment(comment string)
+	GetComment() string
+	// validates the values bound to the columns with a declared type, when the statements are executed
+	SetStrictTypes(strict bool)
+	IsStrictTypes() bool
+	// MapSchema renders the tables of a schema in another schema. ex: a tenant specific schema
+	MapSchema(schema string, actual string)
+	// ResolveSchema returns the schema where the tables of the schema are rendered
+	ResolveSchema(schema string) string
 	InTransaction() bool
+	// TxDepth returns the transaction nesting level. Zero if not in a transaction.
+	TxDepth() int
+	// Ping runs a trivial query, returning an error if the database is unreachable
+	Ping(ctx context.Context) error
+	// SetStatementTimeout limits, server side, the execution time of each statement of the ongoing transaction
+	SetStatementTimeout(timeout time.Duration) error
 
 	Query(table *Table) *Query
 	Insert(table *Table) *Insert
 	Delete(table *Table) *Delete
 	Update(table *Table) *Update
+	// Truncate removes all the rows of the table
+	Truncate(table *Table) *Truncate
+
+	// ExecRaw executes native SQL, passing the positional arguments straight to the driver
+	ExecRaw(query string, args ...interface{}) (sql.Result, error)
+	// QueryRaw executes a native SELECT, passing the positional arguments straight to the driver,
+	// and calls the closure for each row, as in dbx.SimpleDBA.QueryInto
+	QueryRaw(query string, closure interface{}, args ...interface{}) ([]interface{}, error)
 
 	Create(instance interface{}) error
 	Retrive(instance interface{}, keys ...interface{}) (bool, error)
+	LoadInto(criteria *Criteria, instance interface{}) (bool, error)
 	FindFirst(instance interface{}, example interface{}) (bool, error)
 	FindAll(instance interface{}, example interface{}) error
 	Modify(instance interface{}) (bool, error)
@@ -89,6 +135,16 @@ type Db struct {
 	inTx       *bool
 	Connection dbx.IConnection
 	Translator Translator
+	// optional connection to a read replica
+	ReadConnection dbx.IConnection
+
+	interceptors []dbx.Interceptor
+	logger       dbx.Logger
+	dryRun       *dbx.DryRun
+	location     *time.Location
+	comment      string
+	strictTypes  bool
+	schemas      map[string]string
 
 	attributes map[string]interface{}
 }
@@ -97,6 +153,79 @@ func (this *Db) InTransaction() bool {
 	return *this.inTx
 }
 
+func (this *Db) TxDepth() int {
+	if tx, ok := this.Connection.(*MyTx); ok && *this.inTx {
+		return tx.depth
+	}
+	return 0
+}
+
+func (this *Db) AddInterceptor(interceptors ...dbx.Interceptor) {
+	this.interceptors = append(this.interceptors, interceptors...)
+}
+
+func (this *Db) GetInterceptors() []dbx.Interceptor {
+	return this.interceptors
+}
+
+func (this *Db) SetLogger(logger dbx.Logger) {
+	this.logger = logger
+}
+
+func (this *Db) GetLogger() dbx.Logger {
+	return this.logger
+}
+
+func (this *Db) SetDryRun(dryRun *dbx.DryRun) {
+	this.dryRun = dryRun
+}
+
+func (this *Db) GetDryRun() *dbx.DryRun {
+	return this.dryRun
+}
+
+func (this *Db) SetLocation(location *time.Location) {
+	this.location = location
+}
+
+func (this *Db) GetLocation() *time.Location {
+	return this.location
+}
+
+func (this *Db) SetComment(comment string) {
+	this.comment = comment
+}
+
+func (this *Db) GetComment() string {
+	return this.comment
+}
+
+// SetStrictTypes enables, for the statements of this store, the validation of the values
+// bound to the columns with a declared type. See Column.Type
+func (this *Db) SetStrictTypes(strict bool) {
+	this.strictTypes = strict
+}
+
+func (this *Db) IsStrictTypes() bool {
+	return this.strictTypes
+}
+
+// MapSchema renders the tables declared in the schema in the actual schema, for the statements of this store.
+// The empty schema refers to the tables without schema.
+func (this *Db) MapSchema(schema string, actual string) {
+	if this.schemas == nil {
+		this.schemas = make(map[string]string)
+	}
+	this.schemas[schema] = actual
+}
+
+func (this *Db) ResolveSchema(schema string) string {
+	if actual, ok := this.schemas[schema]; ok {
+		return actual
+	}
+	return schema
+}
+
 func (this *Db) GetTranslator() Translator {
 	return this.Translator
 }
@@ -105,6 +234,72 @@ func (this *Db) GetConnection() dbx.IConnection {
 	return this.Connection
 }
 
+func (this *Db) GetReadConnection() dbx.IConnection {
+	// inside a transaction everything is pinned to the primary
+	if _, inTx := this.Connection.(*MyTx); inTx || this.ReadConnection == nil {
+		return this.Connection
+	}
+	return this.ReadConnection
+}
+
+func (this *Db) SetReadConnection(connection dbx.IConnection) {
+	this.ReadConnection = connection
+}
+
+// ExecRaw executes native SQL, with the placeholders of the database, without the named parameters mapping.
+// Any statement can be executed, including DDL.
+// The interceptors, the logger and the dry run of this store are applied.
+//
+// ex: store.ExecRaw("UPDATE BOOK SET PRICE = PRICE * ? WHERE PUBLISHER_ID = ?", 1.1, 2)
+func (this *Db) ExecRaw(query string, args ...interface{}) (sql.Result, error) {
+	return newDba(this, this.GetConnection()).Exec(query, args...)
+}
+
+// Ping runs the trivial query of the translator, like SELECT 1, in the connection of this store,
+// returning an error if the database is unreachable. Useful for readiness probes,
+// since a real query catches connection issues that the driver Ping may miss.
+// The context limits the wait, if the connection supports it.
+func (this *Db) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	query := this.Translator.GetSqlForPing()
+	var one interface{}
+	if c, ok := this.GetConnection().(interface {
+		QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	}); ok {
+		return c.QueryRowContext(ctx, query).Scan(&one)
+	}
+	return this.GetConnection().QueryRow(query).Scan(&one)
+}
+
+// SetStatementTimeout limits, server side, the execution time of each statement of the ongoing transaction,
+// so that runaway queries are killed by the database even if no context deadline is in place.
+// The limit ends with the transaction and zero removes it.
+// Returns an error if the timeout is negative, if not in a transaction or if the database has no such limit.
+func (this *Db) SetStatementTimeout(timeout time.Duration) error {
+	if timeout < 0 {
+		return errors.New(fmt.Sprintf("goSQL: Invalid statement timeout %s", timeout))
+	}
+	if this.TxDepth() == 0 {
+		return errors.New("goSQL: The statement timeout requires a transaction")
+	}
+	sql := this.Translator.GetSqlForStatementTimeout(timeout)
+	if sql == "" {
+		return errors.New("goSQL: The statement timeout is not supported by the database")
+	}
+	_, err := this.ExecRaw(sql)
+	return err
+}
+
+// QueryRaw executes a native SELECT, with the placeholders of the database, without the named parameters mapping,
+// calling the closure for each row as in dbx.SimpleDBA.QueryInto.
+//
+// ex: store.QueryRaw("SELECT NAME FROM BOOK WHERE PRICE > ?", func(name string) { ... }, 10)
+func (this *Db) QueryRaw(query string, closure interface{}, args ...interface{}) ([]interface{}, error) {
+	return newDba(this, this.GetReadConnection()).QueryInto(query, closure, args...)
+}
+
 // the idea is to centralize the query creation so that future customization could be made
 func (this *Db) Query(table *Table) *Query {
 	return NewQuery(this, table)
@@ -125,6 +320,10 @@ func (this *Db) Update(table *Table) *Update {
 	return NewUpdate(this, table)
 }
 
+func (this *Db) Truncate(table *Table) *Truncate {
+	return NewTruncate(this, table)
+}
+
 // finds the registered table for the passed struct
 func structName(instance interface{}) (*Table, reflect.Type, error) {
 	typ := reflect.TypeOf(instance)
@@ -190,14 +389,22 @@ func (this *Db) Retrive(instance interface{}, keys ...interface{}) (bool, error)
 		dml.Column(c)
 	})
 
-	criterias := make([]*Criteria, 0)
-	pos := 0
-	for e := table.GetKeyColumns().Enumerator(); e.HasNext(); {
-		column := e.Next().(*Column)
-		if len(keys) > pos {
-			criterias = append(criterias, column.Matches(keys[pos]))
+	var criterias []*Criteria
+	if _, ok := singleKey(keys); ok {
+		criterias, err = KeyCriteria(table, keys...)
+		if err != nil {
+			return false, err
+		}
+	} else {
+		// a partial key matches only the first key columns
+		pos := 0
+		for e := table.GetKeyColumns().Enumerator(); e.HasNext(); {
+			column := e.Next().(*Column)
+			if len(keys) > pos {
+				criterias = append(criterias, column.Matches(keys[pos]))
+			}
+			pos++
 		}
-		pos++
 	}
 
 	if len(criterias) > 0 {
@@ -207,6 +414,27 @@ func (this *Db) Retrive(instance interface{}, keys ...interface{}) (bool, error)
 	return dml.SelectTo(instance)
 }
 
+// LoadInto loads the row matching the criteria onto the supplied struct pointer,
+// overwriting only the fields of the mapped columns, preserving the other fields.
+//
+// ex: store.LoadInto(PUBLISHER_C_ID.Matches(2), &publisher)
+func (this *Db) LoadInto(criteria *Criteria, instance interface{}) (bool, error) {
+	table, t, err := structName(instance)
+	if err != nil {
+		return false, err
+	}
+
+	var dml = this.Overrider.Query(table)
+	acceptColumn(table, t, func(c *Column) {
+		dml.Column(c)
+	})
+	if criteria != nil {
+		dml.Where(criteria)
+	}
+
+	return dml.LoadInto(instance)
+}
+
 func isZero(x interface{}) bool {
 	if x == nil {
 		return true
@@ -141,16 +141,40 @@ func (this *Delete) Execute() (int64, error) {
 	rsql := this.getCachedSql()
 	this.debugSQL(rsql.OriSql, 1)
 
+	rsqls, params, e := this.splitValues(rsql, true)
+	if e != nil {
+		return 0, e
+	}
+
 	now := time.Now()
-	affectedRows, e := this.DmlBase.dba.Delete(rsql.Sql, rsql.BuildValues(this.DmlBase.parameters)...)
-	this.debugTime(now, 1)
+	var affectedRows int64
+	e = this.execParts(len(rsqls), func(dba *dbx.SimpleDBA, k int) error {
+		affected, e := dba.Delete(rsqls[k].Sql, params[k]...)
+		affectedRows += affected
+		return e
+	})
 	if e != nil {
 		return 0, e
 	}
+	this.debugTime(now, 1)
 
 	return affectedRows, nil
 }
 
+// InterpolatedSQL returns the SQL with the parameters values in place, for logging and debugging.
+// Secret parameters, by SECRET_SUFFIX, by SecretParameters or bound to a Secret column, are masked.
+// It is NOT SAFE to execute the returned SQL.
+func (this *Delete) InterpolatedSQL() string {
+	return this.interpolate(this.getCachedSql())
+}
+
+// GetCachedSQL returns the generated SQL, without executing it.
+// Failures generating the SQL are returned as errors.
+func (this *Delete) GetCachedSQL() (rsql *RawSql, err error) {
+	defer recoverSQL(&err)
+	return this.getCachedSql(), nil
+}
+
 func (this *Delete) getCachedSql() *RawSql {
 	if this.rawSQL == nil {
 		// if the discriminator conditions have not yet been processed, apply them now
@@ -165,6 +189,32 @@ func (this *Delete) getCachedSql() *RawSql {
 	return this.rawSQL
 }
 
+//// JOINS ===
+
+// Inner includes the associations as inner joins, so that the rows to delete
+// can be filtered by the joined tables. The path must be closed with Join.
+// Only some databases support it. ex: Postgres (USING) and MySQL.
+//
+// ex: store.Delete(BOOK).Inner(BOOK_A_PUBLISHER).On(PUBLISHER_C_NAME.Matches("X")).Join().Execute()
+func (this *Delete) Inner(associations ...*Association) *Delete {
+	this.DmlBase.extendPath(INNER_JOIN, associations...)
+	return this
+}
+
+// On is the restriction to apply to the last association. Several calls are ANDed.
+func (this *Delete) On(criteria ...*Criteria) *Delete {
+	this.DmlBase.on(criteria)
+	return this
+}
+
+// Join closes the current association path
+func (this *Delete) Join() *Delete {
+	this.DmlBase.joinTo(this.path, joinOptions{})
+	this.path = nil
+	this.rawSQL = nil
+	return this
+}
+
 //// WHERE ===
 
 func (this *Delete) Where(restriction ...*Criteria) *Delete {
@@ -173,3 +223,31 @@ func (this *Delete) Where(restriction ...*Criteria) *Delete {
 	}
 	return this
 }
+
+// WhereIf ANDs the restrictions with the ones of the previous Where, WhereIf or WhereIfSet, if the condition is true.
+//
+// ex: WhereIf(name != "", BOOK_C_NAME.Like(name))
+func (this *Delete) WhereIf(condition bool, restriction ...*Criteria) *Delete {
+	if condition {
+		this.DmlBase.andWhere(restriction)
+	}
+	return this
+}
+
+// WhereIfSet ANDs the restrictions with the ones of the previous Where, WhereIf or WhereIfSet,
+// ignoring the restrictions with a nil, empty or zero value.
+// Useful to list all the possible filters of a search, where only the filled ones are applied.
+//
+// ex: WhereIfSet(BOOK_C_NAME.Matches(form.Name), BOOK_C_PRICE.Lesser(form.MaxPrice))
+func (this *Delete) WhereIfSet(restriction ...*Criteria) *Delete {
+	this.DmlBase.whereIfSet(restriction)
+	return this
+}
+
+// WhereKey restricts to the row with the supplied primary key,
+// matching all the key columns, even if composite.
+// The values are either in the order the key columns were declared, or a single Key.
+func (this *Delete) WhereKey(keys ...interface{}) *Delete {
+	this.DmlBase.whereKey(keys)
+	return this
+}
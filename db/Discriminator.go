@@ -17,3 +17,29 @@ func NewDiscriminator(column *Column, value Tokener) Discriminator {
 func (this Discriminator) Criteria() *Criteria {
 	return Matches(this.Column, this.Value)
 }
+
+// DiscriminatorCombiner builds the where criteria from the user restrictions and the table discriminators.
+// It may return nil if there is nothing to restrict.
+type DiscriminatorCombiner func(restrictions []*Criteria, discriminators []*Criteria) *Criteria
+
+// AndDiscriminators is the default combiner. All restrictions and discriminators are ANDed.
+func AndDiscriminators(restrictions []*Criteria, discriminators []*Criteria) *Criteria {
+	criterias := append(append([]*Criteria{}, restrictions...), discriminators...)
+	if len(criterias) > 0 {
+		return And(criterias...)
+	}
+	return nil
+}
+
+// OrDiscriminators ORs the discriminators between them and ANDs the result with the restrictions.
+// Useful when a table holds more than one discriminator value, ex: TABLE("X").With("TYPE", "A").With("TYPE", "B")
+func OrDiscriminators(restrictions []*Criteria, discriminators []*Criteria) *Criteria {
+	criterias := append([]*Criteria{}, restrictions...)
+	if len(discriminators) > 0 {
+		criterias = append(criterias, Or(discriminators...))
+	}
+	if len(criterias) > 0 {
+		return And(criterias...)
+	}
+	return nil
+}
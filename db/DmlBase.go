@@ -1,6 +1,9 @@
 package db
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"github.com/quintans/goSQL/dbx"
 	tk "github.com/quintans/toolkit"
@@ -19,41 +22,8 @@ var lgr = log.LoggerFor("github.com/quintans/goSQL/db")
 //	lgr.SetCallerAt(1)
 //}
 
-type RawSql struct {
-	// original sql
-	OriSql string
-	// the converted SQL with the Database specific placeholders
-	Sql string
-	// the parameters values
-	Names []string
-}
-
-// Convert a Map of named parameter values to a corresponding array.
-//
-// return the array of values
-func (this *RawSql) BuildValues(paramMap map[string]interface{}) []interface{} {
-	paramArray := make([]interface{}, len(this.Names))
-	var ok bool
-	for i, name := range this.Names {
-		paramArray[i], ok = paramMap[name]
-		if !ok {
-			panic(fmt.Sprintf("[%s] No value supplied for the SQL parameter '%s' for the SQL %s",
-				dbx.FAULT_VALUES_STATEMENT, name, this.OriSql))
-		}
-	}
-	return paramArray
-}
-
-func (this *RawSql) Clone() interface{} {
-	other := new(RawSql)
-	other.OriSql = this.OriSql
-	other.Sql = this.Sql
-	if this.Names != nil {
-		other.Names = make([]string, len(this.Names))
-		copy(other.Names, this.Names)
-	}
-	return other
-}
+// RawSql is defined in dbx so that it can be executed directly by SimpleDBA
+type RawSql = dbx.RawSql
 
 type PathCriteria struct {
 	Criterias []*Criteria
@@ -63,6 +33,10 @@ type PathCriteria struct {
 const JOIN_PREFIX = "j"
 const PREFIX = "t"
 
+// MAX_JOIN_DEPTH is the default maximum number of associations in a join path.
+// Zero means no limit.
+var MAX_JOIN_DEPTH = 0
+
 type DmlBase struct {
 	db IDb
 
@@ -70,16 +44,24 @@ type DmlBase struct {
 	tableAlias             string
 	joins                  []*Join
 	criteria               *Criteria
+	restrictions           []*Criteria // the restrictions of the where, before applying the discriminators
 	parameters             map[string]interface{}
+	paramColumns           map[string]*Column // the column to which a parameter is bound, if any
 	joinBag                *AliasBag
+	joinPrefix             string
 	lastFkAlias            string
 	lastJoin               *Join
 	discriminatorCriterias []*Criteria
+	combiner               DiscriminatorCombiner
 	rawIndex               int
 	// stores the paths (associations) already traveled
 	cachedAssociation [][]*PathElement
 	// list with the associations of the current path
 	path []*PathElement
+	// maximum number of associations in a path. Zero means no limit
+	maxJoinDepth int
+	// if the values bound to the columns are validated against their declared type
+	strictTypes bool
 
 	rawSQL *RawSql
 	dba    *dbx.SimpleDBA
@@ -94,14 +76,30 @@ func NewDmlBase(DB IDb, table *Table) *DmlBase {
 func (this *DmlBase) Super(DB IDb, table *Table) {
 	this.db = DB
 	this.table = table
+	this.joinPrefix = JOIN_PREFIX
+	this.maxJoinDepth = MAX_JOIN_DEPTH
+	this.strictTypes = DB.IsStrictTypes()
 	this.alias(PREFIX + "0")
 
 	if table != nil {
 		this.discriminatorCriterias = table.GetCriterias()
+		this.combiner = table.GetDiscriminatorCombiner()
 	}
 	this.parameters = make(map[string]interface{})
+	this.paramColumns = make(map[string]*Column)
 
-	this.dba = dbx.NewSimpleDBA(DB.GetConnection())
+	this.dba = newDba(DB, DB.GetConnection())
+}
+
+// creates the SimpleDBA for the connection, configured with the IDb settings
+func newDba(store IDb, connection dbx.IConnection) *dbx.SimpleDBA {
+	return dbx.NewSimpleDBA(connection).
+		AddInterceptor(store.GetInterceptors()...).
+		SetLogger(store.GetLogger()).
+		SetDryRun(store.GetDryRun()).
+		SetLocation(store.GetLocation()).
+		SetComment(store.GetComment()).
+		SetIdentifierCase(store.GetTranslator().IdentifierCase())
 }
 
 func (this *DmlBase) NextRawIndex() int {
@@ -129,9 +127,52 @@ func (this *DmlBase) SetTableAlias(alias string) {
 	this.alias(alias)
 }
 
+// SetJoinAliasPrefix defines the prefix used to generate the join aliases,
+// that will be in the form <table alias>_<prefix><n>. The default is JOIN_PREFIX.
+// It must be called before defining any join.
+func (this *DmlBase) SetJoinAliasPrefix(prefix string) {
+	if prefix == "" {
+		panic("An empty join alias prefix is not allowed.")
+	}
+	if len(this.joins) > 0 || len(this.path) > 0 {
+		panic("The join alias prefix must be defined before any join.")
+	}
+	this.joinPrefix = prefix
+	this.alias(this.tableAlias)
+}
+
+// SetMaxJoinDepth defines the maximum number of associations that a join path can have,
+// to catch accidental deep joins early. Zero means no limit. The default is MAX_JOIN_DEPTH.
+func (this *DmlBase) SetMaxJoinDepth(depth int) {
+	if depth < 0 {
+		panic("A negative max join depth is not allowed.")
+	}
+	this.maxJoinDepth = depth
+}
+
+func (this *DmlBase) GetMaxJoinDepth() int {
+	return this.maxJoinDepth
+}
+
+// panics if the path is deeper than the max join depth
+func (this *DmlBase) checkJoinDepth(path []*PathElement) {
+	if this.maxJoinDepth > 0 && len(path) > this.maxJoinDepth {
+		panic(fmt.Sprintf("goSQL: The join path %s has %v associations, exceeding the max join depth of %v",
+			pathString(path), len(path), this.maxJoinDepth))
+	}
+}
+
+func pathString(path []*PathElement) string {
+	names := make([]string, len(path))
+	for k, pe := range path {
+		names[k] = pe.Base.String()
+	}
+	return strings.Join(names, " -> ")
+}
+
 func (this *DmlBase) alias(a string) {
 	if a != "" {
-		this.joinBag = NewAliasBag(a + "_" + JOIN_PREFIX)
+		this.joinBag = NewAliasBag(a + "_" + this.joinPrefix)
 		this.tableAlias = a
 		this.rawSQL = nil
 	}
@@ -141,6 +182,8 @@ func (this *DmlBase) GetJoins() []*Join {
 	return this.joins
 }
 
+// SetParameter binds the value to the parameter name.
+// A func() interface{} value is deferred: it is only called, for each execution, when the parameters are bound.
 func (this *DmlBase) SetParameter(key string, parameter interface{}) {
 	this.parameters[key] = parameter
 }
@@ -153,15 +196,34 @@ func (this *DmlBase) GetParameter(column *Column) interface{} {
 	return this.parameters[column.GetAlias()]
 }
 
+// GetCriteria returns the WHERE restriction.
+// It is called when generating the SQL, so the columns of the joined tables
+// are resolved here, whether the joins were declared before or after the restriction.
 func (this *DmlBase) GetCriteria() *Criteria {
+	if this.criteria != nil {
+		this.resolveJoinAlias(this.criteria)
+	}
 	return this.criteria
 }
 
-// Sets the value of parameter to the column
+// Sets the value of parameter to the column.
+// With strict types, a value not compatible with the declared type of the column
+// makes the execution of the statement return an error.
 // param col: The column
 // param parameter: The value to set
 func (this *DmlBase) SetParameterFor(col *Column, parameter interface{}) {
 	this.SetParameter(col.GetAlias(), parameter)
+	this.paramColumns[col.GetAlias()] = col
+}
+
+// SetStrictTypes overrides, for this statement, the validation of the values bound to the columns
+// against their declared type. The default is the one of the store. See IDb.SetStrictTypes
+func (this *DmlBase) SetStrictTypes(strict bool) {
+	this.strictTypes = strict
+}
+
+func (this *DmlBase) IsStrictTypes() bool {
+	return this.strictTypes
 }
 
 func (this *DmlBase) GetAliasForAssociation(association *Association) string {
@@ -171,27 +233,85 @@ func (this *DmlBase) GetAliasForAssociation(association *Association) string {
 	return ""
 }
 
-// includes the associations as inner joins to the current path
+// includes the associations, with the join type, to the current path
 // param associations
-func (this *DmlBase) inner(inner bool, associations ...*Association) {
+func (this *DmlBase) extendPath(joinType JoinType, associations ...*Association) {
 	for _, association := range associations {
 		pe := new(PathElement)
 		pe.Base = association
-		pe.Inner = inner
+		pe.Inner = joinType == INNER_JOIN
 		this.path = append(this.path, pe)
 	}
+	this.checkJoinDepth(this.path)
 
 	this.rawSQL = nil
 }
 
+// sets the alias of the join to the columns that belong to a joined table
+// and that were given the alias of the main table, for not having one.
+// The first join targeting the column table is used.
+func (this *DmlBase) resolveJoinAlias(token Tokener) {
+	if len(this.joins) == 0 || token == nil {
+		return
+	}
+	if ch, ok := token.(*ColumnHolder); ok {
+		table := ch.GetColumn().GetTable()
+		if ch.tableAlias != this.tableAlias || table.Equals(this.table) {
+			return
+		}
+		for _, join := range this.joins {
+			for _, pe := range join.GetPathElements() {
+				if pe.Derived != nil && pe.Derived.GetTableTo().Equals(table) {
+					ch.tableAlias = pathElementAlias(pe)
+					return
+				}
+			}
+		}
+		return
+	}
+	for _, member := range token.GetMembers() {
+		this.resolveJoinAlias(member)
+	}
+}
+
+// restriction to apply to the last association of the current path.
+// It is ANDed with the restrictions of previous calls.
+func (this *DmlBase) on(criteria []*Criteria) {
+	if len(this.path) > 0 {
+		var retriction *Criteria
+		if len(criteria) > 1 {
+			retriction = And(criteria...)
+		} else if len(criteria) == 1 {
+			retriction = criteria[0]
+		} else {
+			panic("nil or empty criterias was passed")
+		}
+		pe := this.path[len(this.path)-1]
+		if pe.Criteria != nil {
+			retriction = And(pe.Criteria, retriction)
+		}
+		pe.Criteria = retriction
+
+		this.rawSQL = nil
+	} else {
+		panic("There is no current join")
+	}
+}
+
 /*
 Indicates that the current association chain should be used to join only.
 A table end alias can also be supplied.
 This
 */
-func (this *DmlBase) joinTo(path []*PathElement, fetch bool) {
+func (this *DmlBase) joinTo(path []*PathElement, options joinOptions) {
 	if len(path) > 0 {
-		this.addJoin(path, nil, fetch)
+		if options.joinType != nil {
+			for _, pe := range path {
+				pe.Inner = *options.joinType == INNER_JOIN
+			}
+		}
+		this.checkJoinDepth(path)
+		this.addJoin(path, nil, options)
 
 		// the first position refers to constraints applied to the table, due to a association discriminator
 		pathCriterias := this.buildPathCriterias(path)
@@ -302,7 +422,7 @@ func (this *DmlBase) buildPathCriterias(paths []*PathElement) []*PathCriteria {
 	return pathCriterias
 }
 
-func (this *DmlBase) addJoin(associations []*PathElement, common []*PathElement, fetch bool) []*PathElement {
+func (this *DmlBase) addJoin(associations []*PathElement, common []*PathElement, options joinOptions) []*PathElement {
 	var local []*PathElement
 
 	if common == nil {
@@ -403,7 +523,7 @@ func (this *DmlBase) addJoin(associations []*PathElement, common []*PathElement,
 	// gets the alias of the last join
 	this.lastFkAlias = this.joinBag.GetAlias(lastFk)
 
-	this.lastJoin = NewJoin(local, fetch)
+	this.lastJoin = NewJoin(local, options.fetch)
 	this.joins = append(this.joins, this.lastJoin)
 
 	return local
@@ -418,19 +538,79 @@ func (this *DmlBase) prepareAssociation(aliasFrom string, aliasTo string, curren
 	}
 }
 
+// SetDiscriminatorCombiner overrides, for this statement, how the discriminators are combined with the restrictions.
+// It must be called before defining the where clause.
+func (this *DmlBase) SetDiscriminatorCombiner(combiner DiscriminatorCombiner) {
+	this.combiner = combiner
+}
+
 func (this *DmlBase) where(restrictions []*Criteria) {
-	var criterias []*Criteria
+	this.restrictions = append([]*Criteria{}, restrictions...)
+
+	combiner := this.combiner
+	if combiner == nil {
+		combiner = AndDiscriminators
+	}
+
+	if criteria := combiner(restrictions, this.discriminatorCriterias); criteria != nil {
+		this.applyWhere(criteria)
+	}
+}
+
+// drops the discriminator conditions of the table, rebuilding the where without them
+func (this *DmlBase) ignoreDiscriminators() {
+	this.discriminatorCriterias = nil
+	this.criteria = nil
+	if len(this.restrictions) > 0 {
+		this.where(this.restrictions)
+	}
+	this.rawSQL = nil
+}
+
+// andWhere ANDs the restrictions with the ones of the previous where
+func (this *DmlBase) andWhere(restrictions []*Criteria) {
 	if len(restrictions) > 0 {
-		criterias = append(criterias, restrictions...)
+		this.where(append(append([]*Criteria{}, this.restrictions...), restrictions...))
 	}
+}
 
-	if len(this.discriminatorCriterias) > 0 {
-		criterias = append(criterias, this.discriminatorCriterias...)
+// whereIfSet ANDs the restrictions that do not have empty values
+func (this *DmlBase) whereIfSet(restrictions []*Criteria) {
+	set := make([]*Criteria, 0, len(restrictions))
+	for _, restriction := range restrictions {
+		if restriction != nil && !hasEmptyValue(restriction) {
+			set = append(set, restriction)
+		}
 	}
+	this.andWhere(set)
+}
 
-	if len(criterias) > 0 {
-		this.applyWhere(And(criterias...))
+// hasEmptyValue checks if any value of the token is nil, an empty slice or the zero value of its type.
+// A pointer to a zero value is not empty.
+func hasEmptyValue(token Tokener) bool {
+	if token == nil {
+		return false
+	}
+	if token.GetOperator() == TOKEN_RAW {
+		value := token.GetValue()
+		if value == nil {
+			return true
+		}
+		v := reflect.ValueOf(value)
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			return v.IsNil()
+		case reflect.Slice, reflect.Map:
+			return v.Len() == 0
+		}
+		return v.IsZero()
+	}
+	for _, m := range token.GetMembers() {
+		if hasEmptyValue(m) {
+			return true
+		}
 	}
+	return false
 }
 
 func (this *DmlBase) applyOn(chain []*PathElement, criteria *Criteria) {
@@ -483,17 +663,326 @@ func (this *DmlBase) applyWhere(restriction *Criteria) {
 	this.rawSQL = nil
 }
 
+// builds the ordered values of the SQL parameters.
+// Returns the SQL to execute, since slice parameters are expanded.
+func (this *DmlBase) buildValues(rsql *RawSql) (*RawSql, []interface{}, error) {
+	params, err := this.convertParameters()
+	if err != nil {
+		return nil, nil, err
+	}
+	if rsql, params, err = rsql.Expand(params); err != nil {
+		return nil, nil, err
+	}
+	values, err := rsql.BuildValuesSafe(params)
+	return rsql, values, err
+}
+
+// splitValues builds the values as buildValues, returning the statements to execute.
+// When the parameters exceed the maximum of the database, or the values of the IN exceed the maximum of a list,
+// the slice of the IN restricting the whole WHERE is split in parts, with a statement for each part.
+// If the statement is not splittable an error is returned.
+func (this *DmlBase) splitValues(rsql *RawSql, splittable bool) ([]*RawSql, [][]interface{}, error) {
+	translator := this.db.GetTranslator()
+	max := translator.GetMaxParameters()
+	maxIn := translator.GetMaxInValues()
+	params, err := this.convertParameters()
+	if err != nil {
+		return nil, nil, err
+	}
+	expanded, expandedParams, err := rsql.Expand(params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var slice reflect.Value
+	name := ""
+	if splittable {
+		name = inSliceParameter(this.criteria, expandedParams)
+	}
+	occurrences := 0
+	for _, n := range rsql.Names {
+		if n == name {
+			occurrences++
+		}
+	}
+	if occurrences == 1 {
+		slice = reflect.ValueOf(expandedParams[name])
+	}
+
+	overParameters := max > 0 && len(expanded.Names) > max
+	overIn := maxIn > 0 && slice.IsValid() && slice.Len() > maxIn
+	if !overParameters && !overIn {
+		values, err := expanded.BuildValuesSafe(expandedParams)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []*RawSql{expanded}, [][]interface{}{values}, nil
+	}
+
+	if overParameters && (!slice.IsValid() || max-(len(expanded.Names)-slice.Len()) < 1) {
+		return nil, nil, errors.New(fmt.Sprintf("goSQL: The statement has %v parameters, more than the maximum of %v, and cannot be split",
+			len(expanded.Names), max))
+	}
+
+	size := slice.Len()
+	if overParameters {
+		size = max - (len(expanded.Names) - slice.Len())
+	}
+	if maxIn > 0 && size > maxIn {
+		size = maxIn
+	}
+	var rsqls []*RawSql
+	var values [][]interface{}
+	for i := 0; i < slice.Len(); i += size {
+		j := i + size
+		if j > slice.Len() {
+			j = slice.Len()
+		}
+		part := make(map[string]interface{}, len(expandedParams))
+		for k, v := range expandedParams {
+			part[k] = v
+		}
+		part[name] = slice.Slice(i, j).Interface()
+		r, p, err := rsql.Expand(part)
+		if err != nil {
+			return nil, nil, err
+		}
+		vals, err := r.BuildValuesSafe(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		rsqls = append(rsqls, r)
+		values = append(values, vals)
+	}
+	return rsqls, values, nil
+}
+
+// execParts executes the parts of a split statement as a whole.
+// In a transaction the parts are protected by a savepoint, otherwise they run in a transaction of their own,
+// so that a failed part leaves nothing of the previous parts.
+func (this *DmlBase) execParts(count int, exec func(dba *dbx.SimpleDBA, part int) error) error {
+	if count == 1 {
+		return exec(this.dba, 0)
+	}
+
+	if tx, ok := this.db.GetConnection().(*MyTx); ok && this.db.InTransaction() {
+		return tx.inSavepoint(this.db.GetTranslator(), "SS_"+strconv.Itoa(tx.depth), func() error {
+			for k := 0; k < count; k++ {
+				if err := exec(this.dba, k); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	beginner, ok := this.db.GetConnection().(interface {
+		Begin() (*sql.Tx, error)
+	})
+	if !ok {
+		return errors.New(fmt.Sprintf("goSQL: The statement was split in %v parts and must run in a transaction", count))
+	}
+	tx, err := beginner.Begin()
+	if err != nil {
+		return err
+	}
+	dba := newDba(this.db, tx)
+	for k := 0; k < count; k++ {
+		if err := exec(dba, k); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// inSliceParameter returns the name of the slice parameter of the IN that restricts the whole criteria,
+// or empty if there is none
+func inSliceParameter(criteria *Criteria, params map[string]interface{}) string {
+	if criteria == nil || criteria.IsNot {
+		return ""
+	}
+	members := criteria.GetMembers()
+	switch criteria.GetOperator() {
+	case TOKEN_AND:
+		for _, m := range members {
+			if c, ok := m.(*Criteria); ok {
+				if name := inSliceParameter(c, params); name != "" {
+					return name
+				}
+			}
+		}
+	case TOKEN_IN:
+		if len(members) == 2 && members[1] != nil && members[1].GetOperator() == TOKEN_PARAM {
+			name := members[1].GetValue().(string)
+			if v := params[name]; v != nil {
+				if _, ok := v.([]byte); !ok && reflect.TypeOf(v).Kind() == reflect.Slice {
+					return name
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// BoundValues returns the SQL, with the slice parameters expanded, and the ordered values of its parameters.
+// Together with GetCachedSQL, it allows asserting the generated SQL without a connection.
+func (this *DmlBase) BoundValues(rsql *RawSql) (*RawSql, []interface{}, error) {
+	return this.buildValues(rsql)
+}
+
+// converts a panic while generating the SQL into an error
+func recoverSQL(err *error) {
+	if r := recover(); r != nil {
+		*err = errors.New(fmt.Sprintf("goSQL: Unable to generate the SQL: %v", r))
+	}
+}
+
+// evaluates the deferred parameters and applies the column converters to the parameters bound to those columns.
+// The original parameters are not changed.
+func (this *DmlBase) convertParameters() (map[string]interface{}, error) {
+	resolved := dbx.ResolveParameters(this.parameters)
+	params := resolved
+	copied := false
+	for name, column := range this.paramColumns {
+		v, ok := resolved[name]
+		if !ok {
+			continue
+		}
+		if this.strictTypes && !column.Accepts(v) {
+			return nil, errors.New(fmt.Sprintf("goSQL: A value of type %T cannot be bound to the %s column %s",
+				v, column.GetType(), column))
+		}
+		converter := column.GetConverter()
+		if converter == nil {
+			continue
+		}
+		if !copied {
+			params = make(map[string]interface{}, len(resolved))
+			for k, p := range resolved {
+				params[k] = p
+			}
+			copied = true
+		}
+		c, err := converter.ToDb(v)
+		if err != nil {
+			return nil, err
+		}
+		params[name] = c
+	}
+	return params, nil
+}
+
+// SECRET_SUFFIX identifies, by the name ending, the parameters whose values are never logged.
+// An empty suffix disables this convention.
+var SECRET_SUFFIX = "$"
+
+var secretParameters = make(map[string]bool)
+
+// SecretParameters registers the names of the parameters whose values are never logged.
+// It should only be called during the initialization.
+func SecretParameters(names ...string) {
+	for _, name := range names {
+		secretParameters[name] = true
+	}
+}
+
+// a parameter is secret if it follows the suffix convention, if it is registered
+// or if it is bound to a secret column
+func (this *DmlBase) isSecret(name string) bool {
+	if SECRET_SUFFIX != "" && strings.HasSuffix(name, SECRET_SUFFIX) || secretParameters[name] {
+		return true
+	}
+	col := this.paramColumns[name]
+	return col != nil && col.IsSecret()
+}
+
+// interpolate returns the SQL with the parameters replaced by literal values.
+// It is only meant for logging. NEVER execute the result, since it is not safe against SQL injection.
+func (this *DmlBase) interpolate(rsql *RawSql) string {
+	params, err := this.convertParameters()
+	if err != nil {
+		params = this.parameters
+	}
+	if len(rsql.Indexes) != len(rsql.Names) {
+		return rsql.OriSql
+	}
+
+	sb := tk.NewStrBuffer()
+	last := 0
+	for i, name := range rsql.Names {
+		idx := rsql.Indexes[i]
+		sb.Add(rsql.OriSql[last:idx[0]])
+		last = idx[1]
+		if this.isSecret(name) {
+			sb.Add("'****'")
+		} else if v, ok := params[name]; ok {
+			sb.Add(sqlLiteral(v))
+		} else {
+			// no value
+			sb.Add(rsql.OriSql[idx[0]:idx[1]])
+		}
+	}
+	sb.Add(rsql.OriSql[last:])
+	return sb.String()
+}
+
+// renders a value as a SQL literal, for logging
+func sqlLiteral(v interface{}) string {
+	if valuer, ok := v.(driver.Valuer); ok {
+		var err error
+		if v, err = valuer.Value(); err != nil {
+			return "<ERROR>"
+		}
+	}
+	if v == nil {
+		return "NULL"
+	}
+
+	switch t := v.(type) {
+	case string:
+		return "'" + strings.Replace(t, "'", "''", -1) + "'"
+	case []byte:
+		return "<BLOB>"
+	case time.Time:
+		return "'" + t.Format("2006-01-02 15:04:05.999999") + "'"
+	case bool:
+		if t {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+
+	val := reflect.ValueOf(v)
+	switch val.Kind() {
+	case reflect.Ptr:
+		if val.IsNil() {
+			return "NULL"
+		}
+		return sqlLiteral(val.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		// as expanded in a IN clause
+		items := make([]string, val.Len())
+		for k := range items {
+			items[k] = sqlLiteral(val.Index(k).Interface())
+		}
+		return strings.Join(items, ", ")
+	}
+	return fmt.Sprintf("%v", v)
+}
+
 func (this *DmlBase) dumpParameters(params map[string]interface{}) string {
 	str := tk.NewStrBuffer()
 	for name, v := range params {
-		if strings.HasSuffix(name, "$") {
-			// secret
+		if this.isSecret(name) {
 			str.Add(fmt.Sprintf("[%s=****]", name))
 		} else if v != nil {
 			typ := reflect.ValueOf(v)
 			k := typ.Kind()
-			if k == reflect.Slice || k == reflect.Array {
+			if _, ok := v.([]byte); ok {
 				str.Add(fmt.Sprintf("[%s=<BLOB>]", name))
+			} else if k == reflect.Slice || k == reflect.Array {
+				str.Add(fmt.Sprintf("[%s=%v]", name, v))
 			} else if k == reflect.Ptr {
 				if typ.IsNil() {
 					str.Add(fmt.Sprintf("[%s=NULL]", name))
@@ -513,7 +1002,11 @@ func (this *DmlBase) dumpParameters(params map[string]interface{}) string {
 
 func (this *DmlBase) debugTime(when time.Time, depth int) {
 	elapsed := time.Since(when)
-	if lgr.IsActive(log.DEBUG) {
+	if l := this.dba.GetLogger(); l != nil {
+		if l.IsDebug() {
+			l.Debugf("executed in: %f secs", elapsed.Seconds())
+		}
+	} else if lgr.IsActive(log.DEBUG) {
 		lgr.CallerAt(depth + 1).Debug(func() string {
 			return fmt.Sprintf("executed in: %f secs", elapsed.Seconds())
 		})
@@ -521,7 +1014,12 @@ func (this *DmlBase) debugTime(when time.Time, depth int) {
 }
 
 func (this *DmlBase) debugSQL(sql string, depth int) {
-	if lgr.IsActive(log.DEBUG) {
+	if l := this.dba.GetLogger(); l != nil {
+		if l.IsDebug() {
+			l.Debugf("\n\t%T SQL: %s\n\tparameters: %s",
+				this, sql, this.dumpParameters(this.parameters))
+		}
+	} else if lgr.IsActive(log.DEBUG) {
 		dump := this.dumpParameters(this.parameters)
 		lgr.CallerAt(depth + 1).Debug(func() string {
 			return fmt.Sprintf("\n\t%T SQL: %s\n\tparameters: %s",
@@ -530,6 +1028,16 @@ func (this *DmlBase) debugSQL(sql string, depth int) {
 	}
 }
 
+func (this *DmlBase) debugf(format string, args ...interface{}) {
+	if l := this.dba.GetLogger(); l != nil {
+		if l.IsDebug() {
+			l.Debugf(format, args...)
+		}
+	} else {
+		lgr.Debugf(format, args...)
+	}
+}
+
 // replaces RAW with PARAM
 //
 // param baseDml: the instance DmlBase were to put the created parameters
@@ -556,12 +1064,26 @@ func (this *DmlBase) replaceRaw(token Tokener) {
 		for k, v := range subquery.GetParameters() {
 			this.SetParameter(k, v)
 		}
+		for k, v := range subquery.paramColumns {
+			this.paramColumns[k] = v
+		}
 		return
 	} else {
 		if members != nil {
+			// a raw value compared with a column is bound to that column
+			var column *Column
+			for _, t := range members {
+				if ch, ok := t.(*ColumnHolder); ok {
+					column = ch.GetColumn()
+					break
+				}
+			}
 			for _, t := range members {
 				if t != nil {
 					this.replaceRaw(t)
+					if column != nil && t.GetOperator() == TOKEN_PARAM {
+						this.paramColumns[t.GetValue().(string)] = column
+					}
 				}
 			}
 		}
@@ -3,7 +3,9 @@ package db
 import (
 	coll "github.com/quintans/toolkit/collection"
 
+	"database/sql/driver"
 	"reflect"
+	"time"
 )
 
 type DmlCore struct {
@@ -13,6 +15,8 @@ type DmlCore struct {
 	lastMappings map[string]*EntityProperty
 	vals         coll.Map
 	cols         []*Column
+	// SubmitBatch sorts the instances by key
+	sortBatch bool
 }
 
 // Sets the value by defining a parameter with the column alias.
@@ -25,6 +29,9 @@ type DmlCore struct {
 func (this *DmlCore) set(col *Column, value interface{}) interface{} {
 	token := tokenizeOne(value)
 	this.replaceRaw(token)
+	if token.GetOperator() == TOKEN_PARAM {
+		this.paramColumns[token.GetValue().(string)] = col
+	}
 	token.SetTableAlias(this.tableAlias)
 	// if the column was not yet defined, the sql changed
 	val, ok := this.defineParameter(col, token)
@@ -53,6 +60,9 @@ func (this *DmlCore) defineParameter(col *Column, value Tokener) (interface{}, b
 	if col.GetTable().GetName() != this.table.GetName() {
 		panic(col.String() + " does not belong to table " + this.table.String())
 	}
+	if col.IsVirtual() {
+		panic("The virtual column " + col.String() + " cannot be inserted or updated")
+	}
 
 	if this.vals == nil {
 		this.vals = coll.NewLinkedHashMap()
@@ -85,6 +95,59 @@ func (this *DmlCore) defineParameter(col *Column, value Tokener) (interface{}, b
 	return nil, true
 }
 
+// returns the field value as a driver.Valuer, even if only its pointer implements it. Otherwise nil.
+func valuerOf(v reflect.Value) driver.Valuer {
+	if valuer, ok := v.Interface().(driver.Valuer); ok {
+		return valuer
+	}
+	if v.CanAddr() {
+		if valuer, ok := v.Addr().Interface().(driver.Valuer); ok {
+			return valuer
+		}
+	}
+	return nil
+}
+
+// sets a timestamp column with the current time
+func (this *DmlCore) stamp(col *Column) {
+	if col == nil {
+		return
+	}
+	if this.table.IsTimestampInSQL() {
+		// avoids a new SQL when executing again
+		if this.vals != nil {
+			if old, ok := this.vals.Get(col); ok && old.(Tokener).GetOperator() == TOKEN_NOW {
+				return
+			}
+		}
+		this.set(col, Now())
+	} else {
+		this.set(col, time.Now())
+	}
+}
+
+// removes a previously set column, if any
+func (this *DmlCore) unset(col *Column) {
+	if this.vals == nil {
+		return
+	}
+	if old := this.vals.Delete(col); old != nil {
+		if tok := old.(Tokener); tok.GetOperator() == TOKEN_PARAM {
+			delete(this.parameters, tok.GetValue().(string))
+		}
+		this.rawSQL = nil
+	}
+}
+
+// GetValues returns the values by column.
+// As with GetCriteria, the columns of the joined tables are resolved here.
 func (this *DmlCore) GetValues() coll.Map {
+	if this.vals != nil && len(this.joins) > 0 {
+		for it := this.vals.Iterator(); it.HasNext(); {
+			if token, ok := it.Next().Value.(Tokener); ok {
+				this.resolveJoinAlias(token)
+			}
+		}
+	}
 	return this.vals
 }
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var _ Converter = &Encrypter{}
+
+// KeyProvider supplies the keys of the column encryption.
+// Since the id of the key is stored alongside each value, the keys can be rotated:
+// new values are encrypted with the current key and old values are still decrypted with the old keys.
+type KeyProvider interface {
+	// CurrentKey returns the id and the key used to encrypt the values
+	CurrentKey() (string, []byte, error)
+	// Key returns the key with the id, used to decrypt the values
+	Key(id string) ([]byte, error)
+}
+
+// KeyRing is a KeyProvider holding the keys in memory, by id.
+type KeyRing struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+func (this *KeyRing) CurrentKey() (string, []byte, error) {
+	key, err := this.Key(this.Current)
+	return this.Current, key, err
+}
+
+func (this *KeyRing) Key(id string) ([]byte, error) {
+	key, ok := this.Keys[id]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("goSQL: Unknown encryption key %s", id))
+	}
+	return key, nil
+}
+
+// Encrypter is a Converter that encrypts the strings written to a column and decrypts them when read,
+// with AES-GCM. The keys, of 16, 24 or 32 bytes, are supplied by a KeyProvider.
+// The value is stored as <key id>:<base64 of the nonce and the cipher text>.
+// Since the encryption is not deterministic, an encrypted column cannot be used in restrictions.
+//
+// ex: USER.COLUMN("SSN").Encrypt(keys)
+type Encrypter struct {
+	provider KeyProvider
+}
+
+func NewEncrypter(provider KeyProvider) *Encrypter {
+	this := new(Encrypter)
+	this.provider = provider
+	return this
+}
+
+// ToDb encrypts a string, *string or []byte with the current key
+func (this *Encrypter) ToDb(in interface{}) (interface{}, error) {
+	var plain []byte
+	switch v := in.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		plain = []byte(v)
+	case *string:
+		if v == nil {
+			return nil, nil
+		}
+		plain = []byte(*v)
+	case []byte:
+		if v == nil {
+			return nil, nil
+		}
+		plain = v
+	default:
+		return nil, errors.New(fmt.Sprintf("goSQL: Expected a string to encrypt. Got %T", in))
+	}
+
+	id, key, err := this.provider.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	sealed := gcm.Seal(nonce, nonce, plain, nil)
+	return id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (this *Encrypter) FromDbInstance() interface{} {
+	return new(sql.NullString)
+}
+
+// FromDb decrypts the value with the key it was encrypted with
+func (this *Encrypter) FromDb(in interface{}) (interface{}, error) {
+	ns := in.(*sql.NullString)
+	if !ns.Valid {
+		return nil, nil
+	}
+	id := KeyId(ns.String)
+	if id == "" {
+		return nil, errors.New("goSQL: Invalid encrypted value")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(ns.String[len(id)+1:])
+	if err != nil {
+		return nil, errors.New("goSQL: Invalid encrypted value")
+	}
+	key, err := this.provider.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("goSQL: Invalid encrypted value")
+	}
+	nonce := sealed[:gcm.NonceSize()]
+	plain, err := gcm.Open(nil, nonce, sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("goSQL: Unable to decrypt with the key %s: %s", id, err))
+	}
+	return string(plain), nil
+}
+
+// KeyId returns the id of the key used to encrypt the stored value, or empty if it is not encrypted.
+// Useful to find the values to encrypt again, with the current key, after a rotation.
+func KeyId(stored string) string {
+	i := strings.Index(stored, ":")
+	if i <= 0 {
+		return ""
+	}
+	return stored[:i]
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
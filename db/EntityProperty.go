@@ -1,6 +1,8 @@
 package db
 
 import (
+	"database/sql"
+	"database/sql/driver"
 	"reflect"
 )
 
@@ -11,6 +13,20 @@ type EntityProperty struct {
 	InnerType reflect.Type
 	Key       bool
 	Tag       reflect.StructTag
+	// converter of the mapped column, if any
+	Converter Converter
+	// the field is not a pointer and knows how to scan itself (sql.Scanner)
+	Scanner bool
+}
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// types that are handled by the driver interfaces, even if they are slices or arrays. ex: uuid.UUID
+func isColumnValue(typ reflect.Type) bool {
+	ptr := reflect.PtrTo(typ)
+	return typ.Implements(scannerType) || ptr.Implements(scannerType) ||
+		typ.Implements(valuerType) || ptr.Implements(valuerType)
 }
 
 func (this *EntityProperty) New() reflect.Value {
@@ -25,13 +41,23 @@ func (this *EntityProperty) IsMany() bool {
 // If value is nil it will return false, otherwise returns true
 func (this *EntityProperty) Set(instance reflect.Value, value reflect.Value) bool {
 	// do not set nil values
-	if value.Kind() != reflect.Ptr || !value.IsNil() {
+	if value.IsValid() && (value.Kind() != reflect.Ptr || !value.IsNil()) {
 		if instance.Kind() == reflect.Ptr {
 			instance = instance.Elem()
 		}
 		field := instance.FieldByName(this.FieldName)
-		if field.Kind() == reflect.Ptr || field.Kind() == reflect.Slice || field.Kind() == reflect.Array {
+		if this.Scanner && this.Converter == nil {
+			// the field scanned itself
+			field.Set(value)
+		} else if field.Kind() != reflect.Interface && value.Type().AssignableTo(field.Type()) {
 			field.Set(value)
+		} else if text, ok := textAs(value, field.Type()); ok {
+			field.Set(text)
+		} else if field.Kind() == reflect.Ptr && value.Type().AssignableTo(field.Type().Elem()) {
+			// a converted value for a pointer field
+			p := reflect.New(field.Type().Elem())
+			p.Elem().Set(value)
+			field.Set(p)
 		} else {
 			field.Set(value.Elem())
 		}
@@ -40,6 +66,71 @@ func (this *EntityProperty) Set(instance reflect.Value, value reflect.Value) boo
 	return false
 }
 
+// textAs converts between string and []byte, since drivers may return text columns as any of them.
+// It returns false if the value or the type are not text.
+func textAs(value reflect.Value, typ reflect.Type) (reflect.Value, bool) {
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	target := typ
+	if target.Kind() == reflect.Ptr {
+		target = target.Elem()
+	}
+	if !isText(value.Type()) || !isText(target) {
+		return reflect.Value{}, false
+	}
+	text := value.Convert(target)
+	if typ.Kind() == reflect.Ptr {
+		p := reflect.New(target)
+		p.Elem().Set(text)
+		return p, true
+	}
+	return text, true
+}
+
+func isText(typ reflect.Type) bool {
+	return typ.Kind() == reflect.String ||
+		typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8
+}
+
+// creates the holder where the column value will be scanned into.
+// A field that implements sql.Scanner receives the scan directly, including NULL.
+func (this *EntityProperty) NewHolder() interface{} {
+	if this.Converter != nil {
+		return this.Converter.FromDbInstance()
+	}
+	if this.Scanner {
+		if this.Type.Kind() == reflect.Ptr {
+			return reflect.New(this.Type.Elem()).Interface()
+		}
+		return reflect.New(this.Type).Interface()
+	}
+	return this.New().Interface()
+}
+
+// converts the scanned holder, if there is a converter.
+// Converted values that are not pointers, slices or arrays are returned as pointers, as expected by Set.
+func (this *EntityProperty) FromDb(holder interface{}) (interface{}, error) {
+	if this.Converter == nil {
+		return holder, nil
+	}
+	value, err := this.Converter.FromDb(holder)
+	if err != nil {
+		return nil, err
+	}
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		// nil (NULL) is not set
+		return nil, nil
+	}
+	if k := v.Kind(); k != reflect.Ptr && k != reflect.Slice && k != reflect.Array {
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		return p.Interface(), nil
+	}
+	return value, nil
+}
+
 func (this *EntityProperty) Get(instance reflect.Value) reflect.Value {
 	if instance.Kind() == reflect.Ptr {
 		instance = instance.Elem()
@@ -97,7 +188,10 @@ func walkTreeStruct(prefix string, typ reflect.Type, attrs map[string]*EntityPro
 					ep.Type = reflect.PtrTo(p.Type)
 				}
 
-				if p.Type.Kind() == reflect.Slice || p.Type.Kind() == reflect.Array {
+				if p.Type.Kind() != reflect.Ptr && reflect.PtrTo(p.Type).Implements(scannerType) {
+					ep.Scanner = true
+				}
+				if (p.Type.Kind() == reflect.Slice || p.Type.Kind() == reflect.Array) && !isColumnValue(p.Type) {
 					ep.InnerType = p.Type.Elem()
 				}
 			}
@@ -102,6 +102,9 @@ func (this *EntityTransformer) PopulateMapping(tableAlias string, typ reflect.Ty
 
 		if bp != nil {
 			bp.Position = idx + 1
+			if ok {
+				bp.Converter = ch.GetColumn().GetConverter()
+			}
 		}
 	}
 
@@ -154,6 +157,7 @@ func (this *EntityTransformer) Transform(rows *sql.Rows) (interface{}, error) {
 	if err := rows.Scan(rowData...); err != nil {
 		return nil, err
 	}
+	dbx.NormalizeTime(this.Query.dba.GetLocation(), rowData...)
 
 	if _, err := this.Overrider.ToEntity(rowData, val, this.Properties, nil); err != nil {
 		return nil, err
@@ -190,8 +194,7 @@ func (this *EntityTransformer) InitRowData(
 	for _, bp := range properties {
 		if bp.Position > 0 {
 			position := bp.Position
-			ptr := bp.New().Interface()
-			row[position-1] = ptr
+			row[position-1] = bp.NewHolder()
 		}
 	}
 }
@@ -206,7 +209,10 @@ func (this *EntityTransformer) ToEntity(
 	for _, bp := range properties {
 		if bp.Position > 0 {
 			position := bp.Position
-			value := row[position-1]
+			value, err := bp.FromDb(row[position-1])
+			if err != nil {
+				return false, err
+			}
 			isPtr := false
 			v := reflect.ValueOf(value)
 			if v.Kind() == reflect.Ptr {
@@ -228,3 +234,13 @@ func (this *EntityTransformer) ToEntity(
 
 	return true, nil
 }
+
+// NewDeclaredMapTransformer creates a map transformer keyed by the declared names of the columns,
+// matching the column names returned by the database with the case folding of the translator.
+func NewDeclaredMapTransformer(translator Translator, columns ...*Column) *dbx.MapTransformer {
+	names := make([]string, len(columns))
+	for k, column := range columns {
+		names[k] = column.GetName()
+	}
+	return dbx.NewMapTransformer().Declared(translator.IdentifierCase(), names...)
+}
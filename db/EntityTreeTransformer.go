@@ -1,6 +1,7 @@
 package db
 
 import (
+	"github.com/quintans/goSQL/dbx"
 	tk "github.com/quintans/toolkit"
 	coll "github.com/quintans/toolkit/collection"
 	. "github.com/quintans/toolkit/ext"
@@ -9,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 )
 
 //extends EntityTransformer
@@ -20,6 +22,8 @@ type EntityTreeTransformer struct {
 	cachedEntityMappings map[string]map[string]*EntityProperty
 	// entity -> entity
 	entities coll.Map
+	// key values -> entity, to reuse the entities that are not a toolkit.Hasher. nil if disabled
+	keyed map[string]reflect.Value
 }
 
 func NewEntityTreeTransformer(query *Query, reuse bool, instance interface{}) *EntityTreeTransformer {
@@ -97,6 +101,7 @@ func (this *EntityTreeTransformer) Transform(rows *sql.Rows) (interface{}, error
 	if err := rows.Scan(rowData...); err != nil {
 		return nil, err
 	}
+	dbx.NormalizeTime(this.Query.dba.GetLocation(), rowData...)
 
 	instance, err := this.transformEntity(rowData, val, alias)
 	if err != nil {
@@ -107,8 +112,11 @@ func (this *EntityTreeTransformer) Transform(rows *sql.Rows) (interface{}, error
 		if H, isH := instance.(tk.Hasher); isH {
 			return H, nil
 		}
-	} else {
+	} else if !this.reuse {
 		this.Returner(val)
+	} else if instance != nil {
+		// the reused entity
+		this.Returner(reflect.ValueOf(instance))
 	}
 
 	return nil, nil
@@ -206,6 +214,23 @@ func (this *EntityTreeTransformer) transformEntity(
 			}
 		}
 		emptyBean = false
+	} else if this.keyed != nil {
+		valid, err = this.Overrider.ToEntity(row, parent, lastProps, &emptyBean)
+		if err != nil {
+			return nil, err
+		}
+		if valid {
+			key, err := entityKey(alias, parent, lastProps)
+			if err != nil {
+				return nil, err
+			}
+			if cached, ok := this.keyed[key]; ok {
+				parent = cached
+			} else {
+				this.keyed[key] = parent
+			}
+			entity = parent.Interface()
+		}
 	} else {
 		valid, err = this.Overrider.ToEntity(row, parent, lastProps, &emptyBean)
 		if err != nil {
@@ -255,7 +280,7 @@ func (this *EntityTreeTransformer) transformEntity(
 							sliceV = reflect.MakeSlice(bp.Type, 0, 10)
 						}
 
-						if !this.reuse || !tk.SliceContains(sliceV.Interface(), child) {
+						if !this.reuse || !containsEntity(sliceV, child) {
 							sliceV = reflect.Append(sliceV, childVal)
 						}
 
@@ -281,6 +306,47 @@ func (this *EntityTreeTransformer) transformEntity(
 	}
 }
 
+// checks if the slice has the entity. The entities that are not a toolkit.Hasher are compared by reference
+func containsEntity(slice reflect.Value, entity interface{}) bool {
+	if _, isHasher := entity.(tk.Hasher); isHasher {
+		return tk.SliceContains(slice.Interface(), entity)
+	}
+	for i := 0; i < slice.Len(); i++ {
+		if slice.Index(i).Interface() == entity {
+			return true
+		}
+	}
+	return false
+}
+
+// the key values of the entity, prefixed by the alias, in the order of the columns
+func entityKey(alias string, entity reflect.Value, properties map[string]*EntityProperty) (string, error) {
+	var keys []*EntityProperty
+	for _, bp := range properties {
+		if bp.Key && bp.Position > 0 {
+			keys = append(keys, bp)
+		}
+	}
+	if len(keys) == 0 {
+		return "", errors.New(
+			fmt.Sprintf("Key columns not found for %s."+
+				" When transforming to a object tree and reusing previous entities, "+
+				"the key columns must be declared in the select.",
+				entity.Type(),
+			),
+		)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Position < keys[j].Position
+	})
+
+	key := alias
+	for _, bp := range keys {
+		key += "|" + fmt.Sprint(reflect.Indirect(bp.Get(entity)).Interface())
+	}
+	return key, nil
+}
+
 func (this *EntityTreeTransformer) DiscardIfKeyIsNull() bool {
 	return true
 }
@@ -3,7 +3,6 @@ package db
 import (
 	coll "github.com/quintans/toolkit/collection"
 
-	"database/sql/driver"
 	"errors"
 	"reflect"
 	"time"
@@ -16,6 +15,8 @@ const (
 	AUTOKEY_BEFORE
 	AUTOKEY_RETURNING
 	AUTOKEY_AFTER
+	// the key is obtained from the driver result (sql.Result.LastInsertId)
+	AUTOKEY_LAST_INSERT_ID
 )
 
 type PreInserter interface {
@@ -63,11 +64,16 @@ func (this *Insert) ReturnId(returnId bool) *Insert {
 func (this *Insert) Set(col *Column, value interface{}) *Insert {
 	this.DmlCore.set(col, value)
 	if this.GetTable().GetSingleKeyColumn() != nil && col.IsKey() {
-		this.HasKeyValue = (value != nil)
+		this.HasKeyValue = (value != nil) && !isDefault(value)
 	}
 	return this
 }
 
+func isDefault(value interface{}) bool {
+	token, ok := value.(Tokener)
+	return ok && token.GetOperator() == TOKEN_DEFAULT
+}
+
 func (this *Insert) Columns(columns ...*Column) *Insert {
 	this.cols = columns
 	return this
@@ -136,6 +142,9 @@ func (this *Insert) Submit(instance interface{}) (int64, error) {
 	var version int64 = 1
 	for e := this.table.GetColumns().Enumerator(); e.HasNext(); {
 		column := e.Next().(*Column)
+		if column.IsVirtual() {
+			continue
+		}
 		if column.IsVersion() {
 			this.Set(column, version)
 		} else {
@@ -147,28 +156,34 @@ func (this *Insert) Submit(instance interface{}) (int64, error) {
 					if v.Kind() == reflect.Ptr && v.IsNil() {
 						this.Set(column, nil)
 					} else {
-						v := v.Interface()
 						var value interface{}
 						var err error
-						switch T := v.(type) {
-						case driver.Valuer:
-							value, err = T.Value()
+						if valuer := valuerOf(v); valuer != nil {
+							value, err = valuer.Value()
 							if err != nil {
 								return 0, err
 							}
-							this.Set(column, value)
-						default:
-							value = v
+						} else {
+							value = v.Interface()
 							// if it is a key column its value
 							// has to be diferent than the zero value
 							// to be included
-							if !column.IsKey() ||
-								value != reflect.Zero(reflect.TypeOf(value)).Interface() {
-								this.Set(column, value)
-							} else {
-								this.Set(column, nil)
+							if column.IsKey() &&
+								value == reflect.Zero(reflect.TypeOf(value)).Interface() {
+								value = nil
+							}
+						}
+						if value != nil && isZero(value) {
+							switch zeroMode(column, bp.Tag) {
+							case ZERO_OMIT:
+								// a reused insert may have it from a previous submit
+								this.unset(column)
+								continue
+							case ZERO_NULL:
+								value = nil
 							}
 						}
+						this.Set(column, value)
 					}
 				}
 			}
@@ -212,6 +227,62 @@ func (this *Insert) Submit(instance interface{}) (int64, error) {
 	return key, nil
 }
 
+// SortBatch makes SubmitBatch insert the instances ordered by primary key,
+// so that concurrent transactions acquire the locks in the same order, avoiding deadlocks.
+func (this *Insert) SortBatch(sort bool) *Insert {
+	this.sortBatch = sort
+	return this
+}
+
+// SubmitBatch inserts, with Submit, each struct pointer of the slice.
+// Returns the number of inserted instances.
+func (this *Insert) SubmitBatch(instances interface{}) (int64, error) {
+	return this.submitBatch(instances, func(instance interface{}) (int64, error) {
+		if _, err := this.Submit(instance); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	})
+}
+
+// SubmitChunks inserts, with Submit, the struct pointers of the slice in chunks of the given size,
+// reporting the inserted instances of each chunk, which chunk failed, if any,
+// and the instances that were not applied, so that a large import can be resumed with them.
+// In a transaction, a failed chunk is rolled back as a whole, keeping the previous chunks.
+func (this *Insert) SubmitChunks(instances interface{}, size int) (*BatchResult, error) {
+	return this.submitChunks(instances, size, func(instance interface{}) (int64, error) {
+		if _, err := this.Submit(instance); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	})
+}
+
+// the zero mode declared in the struct tag takes precedence over the column one
+func zeroMode(column *Column, tag reflect.StructTag) ZeroMode {
+	switch tag.Get(sqlOmitionKey) {
+	case sqlOmitZero:
+		return ZERO_OMIT
+	case sqlNullZero:
+		return ZERO_NULL
+	}
+	return column.GetZeroMode()
+}
+
+// InterpolatedSQL returns the SQL with the parameters values in place, for logging and debugging.
+// Secret parameters, by SECRET_SUFFIX, by SecretParameters or bound to a Secret column, are masked.
+// It is NOT SAFE to execute the returned SQL.
+func (this *Insert) InterpolatedSQL() string {
+	return this.interpolate(this.getCachedSql())
+}
+
+// GetCachedSQL returns the generated SQL, without executing it.
+// Failures generating the SQL are returned as errors.
+func (this *Insert) GetCachedSQL() (rsql *RawSql, err error) {
+	defer recoverSQL(&err)
+	return this.getCachedSql(), nil
+}
+
 func (this *Insert) getCachedSql() *RawSql {
 	if this.rawSQL == nil {
 		sql := this.db.GetTranslator().GetSqlForInsert(this)
@@ -223,6 +294,8 @@ func (this *Insert) getCachedSql() *RawSql {
 // returns the last inserted id
 func (this *Insert) Execute() (int64, error) {
 	table := this.GetTable()
+	this.stamp(table.GetCreatedColumn())
+	this.stamp(table.GetUpdatedColumn())
 	if table.PreInsertTrigger != nil {
 		table.PreInsertTrigger(this)
 	}
@@ -242,25 +315,36 @@ func (this *Insert) Execute() (int64, error) {
 		}
 		rsql := this.getCachedSql()
 		this.debugSQL(rsql.OriSql, 1)
+		var params []interface{}
+		if rsql, params, err = this.buildValues(rsql); err != nil {
+			return 0, err
+		}
 		now = time.Now()
-		_, err = this.dba.Insert(rsql.Sql, rsql.BuildValues(this.parameters)...)
+		_, err = this.dba.Insert(rsql.Sql, params...)
 		this.debugTime(now, 1)
 	case AUTOKEY_RETURNING:
 		rsql := this.getCachedSql()
 		this.debugSQL(rsql.OriSql, 1)
+		var params []interface{}
+		if rsql, params, err = this.buildValues(rsql); err != nil {
+			return 0, err
+		}
 		now = time.Now()
 		if this.HasKeyValue || singleKeyColumn == nil {
-			_, err = this.dba.Insert(rsql.Sql, rsql.BuildValues(this.parameters)...)
+			_, err = this.dba.Insert(rsql.Sql, params...)
 		} else {
-			params := rsql.BuildValues(this.parameters)
 			lastId, err = this.dba.InsertReturning(rsql.Sql, params...)
 		}
 		this.debugTime(now, 1)
 	case AUTOKEY_AFTER:
 		rsql := this.getCachedSql()
 		this.debugSQL(rsql.OriSql, 1)
+		var params []interface{}
+		if rsql, params, err = this.buildValues(rsql); err != nil {
+			return 0, err
+		}
 		now = time.Now()
-		_, err = this.dba.Insert(rsql.Sql, rsql.BuildValues(this.parameters)...)
+		_, err = this.dba.Insert(rsql.Sql, params...)
 		if err != nil {
 			return 0, err
 		}
@@ -270,9 +354,23 @@ func (this *Insert) Execute() (int64, error) {
 				return 0, err
 			}
 		}
+	case AUTOKEY_LAST_INSERT_ID:
+		rsql := this.getCachedSql()
+		this.debugSQL(rsql.OriSql, 1)
+		var params []interface{}
+		if rsql, params, err = this.buildValues(rsql); err != nil {
+			return 0, err
+		}
+		now = time.Now()
+		if this.returnId && !this.HasKeyValue && singleKeyColumn != nil {
+			lastId, err = this.dba.InsertWithLastId(rsql.Sql, params...)
+		} else {
+			_, err = this.dba.Insert(rsql.Sql, params...)
+		}
+		this.debugTime(now, 1)
 	}
 
-	logger.Debugf("The inserted Id was: %v", lastId)
+	this.debugf("The inserted Id was: %v", lastId)
 	return lastId, err
 }
 
@@ -12,6 +12,45 @@ type PathElement struct {
 	PreferredAlias string // user preferred alias
 }
 
+// JoinType is the type of the join of an association
+type JoinType int
+
+const (
+	INNER_JOIN JoinType = iota
+	OUTER_JOIN
+)
+
+// JoinOption configures how the current association path is joined.
+// ex: Join(WithJoinType(OUTER_JOIN), WithFetch())
+type JoinOption func(*joinOptions)
+
+type joinOptions struct {
+	fetch    bool
+	joinType *JoinType
+}
+
+func newJoinOptions(options []JoinOption) joinOptions {
+	var opts joinOptions
+	for _, option := range options {
+		option(&opts)
+	}
+	return opts
+}
+
+// WithFetch includes the columns of the tables of the path in the result, as with Fetch
+func WithFetch() JoinOption {
+	return func(opts *joinOptions) {
+		opts.fetch = true
+	}
+}
+
+// WithJoinType defines the join type of all the associations of the path
+func WithJoinType(joinType JoinType) JoinOption {
+	return func(opts *joinOptions) {
+		opts.joinType = &joinType
+	}
+}
+
 type Join struct {
 	associations []*PathElement
 	fetch        bool
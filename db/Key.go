@@ -0,0 +1,63 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Key holds the values of a, possibly composite, primary key by key column.
+// ex: Key{ORDER_LINE_C_ORDER_ID: 1, ORDER_LINE_C_LINE: 2}
+type Key map[*Column]interface{}
+
+// KeyCriteria builds the criterias matching all the key columns of the table.
+// The values are either in the order the key columns were declared, or a single Key.
+func KeyCriteria(table *Table, keys ...interface{}) ([]*Criteria, error) {
+	columns := table.GetKeyColumns().Elements()
+	if len(columns) == 0 {
+		return nil, errors.New(fmt.Sprintf("goSQL: The table %s has no key columns", table))
+	}
+
+	byColumn, _ := singleKey(keys)
+	if byColumn == nil && len(keys) != len(columns) {
+		return nil, errors.New(fmt.Sprintf("goSQL: The table %s has %v key columns but %v values were supplied",
+			table, len(columns), len(keys)))
+	}
+
+	criterias := make([]*Criteria, len(columns))
+	for k, c := range columns {
+		column := c.(*Column)
+		var value interface{}
+		if byColumn != nil {
+			v, ok := byColumn[column]
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("goSQL: No value for the key column %s", column))
+			}
+			value = v
+		} else {
+			value = keys[k]
+		}
+		if value == nil {
+			return nil, errors.New(fmt.Sprintf("goSQL: The value for the key column %s cannot be nil", column))
+		}
+		criterias[k] = column.Matches(value)
+	}
+	return criterias, nil
+}
+
+// returns the Key if it is the only value supplied
+func singleKey(keys []interface{}) (Key, bool) {
+	if len(keys) == 1 {
+		key, ok := keys[0].(Key)
+		return key, ok
+	}
+	return nil, false
+}
+
+// restricts to the row with the supplied key. Panics if the key does not match the key columns.
+func (this *DmlBase) whereKey(keys []interface{}) {
+	criterias, err := KeyCriteria(this.table, keys...)
+	if err != nil {
+		panic(err.Error())
+	}
+	this.where(criterias)
+}
@@ -154,6 +154,8 @@ func ToRawSql(sql string, translator Translator) *RawSql {
 	rawSql.OriSql = sql
 	parsedSql := ParseSqlStatement(sql)
 	rawSql.Names = parsedSql.Names
+	rawSql.Indexes = parsedSql.Indexes
+	rawSql.Placeholder = translator.GetPlaceholder
 	rawSql.Sql = SubstituteNamedParameters(parsedSql, translator)
 	return rawSql
 }
@@ -1,9 +1,11 @@
 package db
 
 type Order struct {
-	alias  string
-	column *ColumnHolder
-	asc    bool
+	alias      string
+	column     *ColumnHolder
+	asc        bool
+	collation  string
+	ignoreCase bool
 }
 
 func NewOrder(column *ColumnHolder) *Order {
@@ -36,3 +38,24 @@ func (this *Order) Asc(asc bool) *Order {
 func (this *Order) IsAsc() bool {
 	return this.asc
 }
+
+// Collate sorts with the collation with the supplied name.
+// The name is database specific.
+func (this *Order) Collate(collation string) *Order {
+	this.collation = collation
+	return this
+}
+
+func (this *Order) GetCollation() string {
+	return this.collation
+}
+
+// IgnoreCase sorts by the lower case value
+func (this *Order) IgnoreCase(ignoreCase bool) *Order {
+	this.ignoreCase = ignoreCase
+	return this
+}
+
+func (this *Order) IsIgnoreCase() bool {
+	return this.ignoreCase
+}
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strconv"
 	"time"
 )
 
@@ -20,6 +21,24 @@ type Group struct {
 const OFFSET_PARAM = "OFFSET_PARAM"
 const LIMIT_PARAM = "LIMIT_PARAM"
 
+// row locking of a SELECT
+type LockMode int
+
+const (
+	LOCK_NONE LockMode = iota
+	LOCK_FOR_UPDATE
+	LOCK_FOR_SHARE
+)
+
+// behaviour when the rows to lock are already locked
+type LockWait int
+
+const (
+	LOCK_WAIT LockWait = iota
+	LOCK_NOWAIT
+	LOCK_SKIP_LOCKED
+)
+
 type PostRetriver interface {
 	PostRetrive(store IDb)
 }
@@ -32,20 +51,44 @@ type Query struct {
 	subQueryAlias string
 	distinct      bool
 
-	orders []*Order
-	unions []*Union
+	orders       []*Order
+	unions       []*Union
+	commonTables []*CommonTable
 	// saves position of columnHolder
 	groupBy   []int
 	having    *Criteria
 	skip      int64
 	limit     int64
+	withTies  bool // the limit includes the rows tying with the last one
 	lastToken Tokener
 	lastOrder *Order
+	lockMode  LockMode
+	lockWait  LockWait
+	// reads from the primary connection even if there is a read replica
+	forcePrimary bool
+	// associations loaded with a second query
+	batches []*batchFetch
+	// rows read by each fetch of a server side cursor
+	fetchSize int
+	// an always false WHERE returns an empty result without hitting the database
+	shortCircuit bool
 }
 
 func NewQuery(db IDb, table *Table) *Query {
 	this := new(Query)
+	this.Super(db, table)
+	return this
+}
+
+func (this *Query) Super(db IDb, table *Table) {
 	this.DmlBase.Super(db, table)
+	this.dba = newDba(db, db.GetReadConnection())
+}
+
+// ForcePrimary executes this query in the primary connection, ignoring any read replica.
+func (this *Query) ForcePrimary() *Query {
+	this.forcePrimary = true
+	this.dba = newDba(this.db, this.db.GetConnection())
 	return this
 }
 
@@ -54,6 +97,18 @@ func (this *Query) Alias(alias string) *Query {
 	return this
 }
 
+// JoinAlias defines the prefix for the generated join aliases. See SetJoinAliasPrefix
+func (this *Query) JoinAlias(prefix string) *Query {
+	this.SetJoinAliasPrefix(prefix)
+	return this
+}
+
+// MaxJoinDepth defines the maximum number of associations of a join path. See SetMaxJoinDepth
+func (this *Query) MaxJoinDepth(depth int) *Query {
+	this.SetMaxJoinDepth(depth)
+	return this
+}
+
 func NewQueryQuery(subquery *Query) *Query {
 	return NewQueryQueryAs(subquery, "")
 }
@@ -82,6 +137,8 @@ func (this *Query) All() *Query {
 func (this *Query) Copy(other *Query) {
 	this.table = other.table
 	this.tableAlias = other.tableAlias
+	this.maxJoinDepth = other.maxJoinDepth
+	this.strictTypes = other.strictTypes
 
 	if other.GetJoins() != nil {
 		this.joins = make([]*Join, len(other.joins))
@@ -90,6 +147,10 @@ func (this *Query) Copy(other *Query) {
 	if other.criteria != nil {
 		this.criteria, _ = other.criteria.Clone().(*Criteria)
 	}
+	if other.restrictions != nil {
+		this.restrictions = make([]*Criteria, len(other.restrictions))
+		copy(this.restrictions, other.restrictions)
+	}
 	if this.parameters != nil {
 		for k, v := range other.parameters {
 			this.parameters[k] = v
@@ -116,6 +177,10 @@ func (this *Query) Copy(other *Query) {
 		this.unions = make([]*Union, len(other.unions))
 		copy(this.unions, other.unions)
 	}
+	if other.commonTables != nil {
+		this.commonTables = make([]*CommonTable, len(other.commonTables))
+		copy(this.commonTables, other.commonTables)
+	}
 	// saves position of columnHolder
 	if other.groupBy != nil {
 		this.groupBy = make([]int, len(other.groupBy))
@@ -124,10 +189,246 @@ func (this *Query) Copy(other *Query) {
 
 	this.skip = other.skip
 	this.limit = other.limit
+	this.withTies = other.withTies
+	this.lockMode = other.lockMode
+	this.lockWait = other.lockWait
+	this.batches = cloneBatches(newCloner(), other.batches)
+	this.fetchSize = other.fetchSize
+	this.shortCircuit = other.shortCircuit
 
 	this.rawSQL = other.rawSQL
 }
 
+// Clone creates a fully independent copy of this query.
+// Joins, criterias, columns, orders and parameters are deep copied,
+// so a prepared query can be cloned, per goroutine, and parameterized without affecting the original.
+func (this *Query) Clone() interface{} {
+	return this.clone(newCloner())
+}
+
+// CloneAs creates a fully independent copy of this query, as Clone, with the main table under another alias.
+// The columns, criterias and orders of the main table, and the join aliases generated from it, are remapped,
+// so that the copy can be combined with the original, like in a self-referencing subquery.
+//
+// ex: query.Where(Exists(query.CloneAs("b2").WhereIf(true, BOOK_C_PRICE.Lesser(BOOK_C_PRICE.For(query.GetTableAlias())))))
+func (this *Query) CloneAs(alias string) *Query {
+	if alias == "" {
+		panic("An empty alias is not allowed.")
+	}
+	return this.clone(newAliasCloner(&this.DmlBase, alias))
+}
+
+func (this *Query) clone(c *cloner) *Query {
+	other := new(Query)
+	other.Super(this.db, this.table)
+	c.dmlBase(&this.DmlBase, &other.DmlBase)
+
+	other.Columns = c.tokenList(this.Columns)
+	if this.subQuery != nil {
+		other.subQuery = this.subQuery.Clone().(*Query)
+	}
+	other.subQueryAlias = this.subQueryAlias
+	other.distinct = this.distinct
+	other.orders = c.orderList(this.orders)
+	if this.unions != nil {
+		other.unions = make([]*Union, len(this.unions))
+		for k, v := range this.unions {
+			other.unions[k] = &Union{v.Query.Clone().(*Query), v.All}
+		}
+	}
+	if this.commonTables != nil {
+		other.commonTables = make([]*CommonTable, len(this.commonTables))
+		for k, v := range this.commonTables {
+			other.commonTables[k] = &CommonTable{v.Table, v.Query.Clone().(*Query), v.Materialization}
+		}
+	}
+	if this.groupBy != nil {
+		other.groupBy = make([]int, len(this.groupBy))
+		copy(other.groupBy, this.groupBy)
+	}
+	other.having = c.criteria(this.having)
+	other.skip = this.skip
+	other.limit = this.limit
+	other.withTies = this.withTies
+	other.lockMode = this.lockMode
+	other.lockWait = this.lockWait
+	other.batches = cloneBatches(c, this.batches)
+	other.fetchSize = this.fetchSize
+	other.shortCircuit = this.shortCircuit
+	if this.forcePrimary {
+		other.ForcePrimary()
+	}
+	if this.lastToken != nil {
+		other.lastToken = c.token(this.lastToken)
+	}
+	other.lastOrder = c.order(this.lastOrder)
+
+	return other
+}
+
+func (this *Query) GetLockMode() LockMode {
+	return this.lockMode
+}
+
+func (this *Query) GetLockWait() LockWait {
+	return this.lockWait
+}
+
+// ForUpdate locks the selected rows for update (SELECT ... FOR UPDATE).
+// If the database does not support it, the translator will panic.
+func (this *Query) ForUpdate() *Query {
+	this.lockMode = LOCK_FOR_UPDATE
+	this.rawSQL = nil
+	return this
+}
+
+// ForShare locks the selected rows in shared mode.
+// If the database does not support it, the translator will panic.
+func (this *Query) ForShare() *Query {
+	this.lockMode = LOCK_FOR_SHARE
+	this.rawSQL = nil
+	return this
+}
+
+// NoWait fails immediately if the rows are already locked.
+// Must be called after ForUpdate or ForShare.
+func (this *Query) NoWait() *Query {
+	return this.lockWaiting(LOCK_NOWAIT)
+}
+
+// SkipLocked ignores the rows that are already locked, useful for job queues.
+// Must be called after ForUpdate or ForShare.
+func (this *Query) SkipLocked() *Query {
+	return this.lockWaiting(LOCK_SKIP_LOCKED)
+}
+
+func (this *Query) lockWaiting(wait LockWait) *Query {
+	if this.lockMode == LOCK_NONE {
+		panic("A lock mode must be defined first. Use ForUpdate or ForShare.")
+	}
+	this.lockWait = wait
+	this.rawSQL = nil
+	return this
+}
+
+// SetFetchSize reads the results in batches of size rows, with a server side cursor,
+// preventing the driver from buffering the entire result.
+// It is only applied inside a transaction, by the databases that support it (ex: Postgres),
+// when listing into structs, slices or closures.
+func (this *Query) SetFetchSize(size int) *Query {
+	this.fetchSize = size
+	return this
+}
+
+func (this *Query) GetFetchSize() int {
+	return this.fetchSize
+}
+
+// uses a server side cursor if a fetch size was defined.
+// The cursor is named by the transaction depth and by the number of open cursors,
+// so that the same statements are reused by the following queries.
+// The returned function must be called when the cursor is no longer used.
+func (this *Query) cursorDba(sql string) (*dbx.SimpleDBA, func()) {
+	if tx, ok := this.db.GetConnection().(*MyTx); ok && this.fetchSize > 0 && this.db.TxDepth() > 0 {
+		tx.cursors++
+		name := "gosql_cursor_" + strconv.Itoa(tx.depth) + "_" + strconv.Itoa(tx.cursors)
+		if cursor := this.db.GetTranslator().GetSqlForCursor(name, sql, this.fetchSize); cursor != nil {
+			return this.dba.WithCursor(cursor), func() { tx.cursors-- }
+		}
+		tx.cursors--
+	}
+	return this.dba, func() {}
+}
+
+// ShortCircuit returns an empty result, without executing the SQL,
+// when the WHERE can never be true, like an IN with an empty list of values.
+// ex: Where(BOOK_C_ID.In(ids...)) with no ids
+//
+// Queries with unions or with aggregations without GROUP BY are always executed.
+func (this *Query) ShortCircuit(enable bool) *Query {
+	this.shortCircuit = enable
+	return this
+}
+
+func (this *Query) IsShortCircuit() bool {
+	return this.shortCircuit
+}
+
+// checks if the query can be skipped
+func (this *Query) shortCircuited() bool {
+	if !this.shortCircuit || len(this.unions) > 0 || !this.alwaysFalse(this.criteria) {
+		return false
+	}
+	if len(this.groupBy) == 0 {
+		for _, column := range this.Columns {
+			if isAggregation(column) {
+				return false
+			}
+		}
+	}
+	this.debugf("query short-circuited: the WHERE is always false")
+	return true
+}
+
+// alwaysFalse checks if the criteria can never be true.
+// Only IN with no values, or with empty slice parameters, and tuple IN without rows are considered.
+func (this *Query) alwaysFalse(criteria *Criteria) bool {
+	if criteria == nil || criteria.IsNot {
+		return false
+	}
+	switch criteria.GetOperator() {
+	case TOKEN_AND:
+		for _, m := range criteria.GetMembers() {
+			if c, ok := m.(*Criteria); ok && this.alwaysFalse(c) {
+				return true
+			}
+		}
+		return false
+	case TOKEN_OR:
+		for _, m := range criteria.GetMembers() {
+			if c, ok := m.(*Criteria); !ok || !this.alwaysFalse(c) {
+				return false
+			}
+		}
+		return len(criteria.GetMembers()) > 0
+	case TOKEN_IN_TUPLE:
+		return len(criteria.GetMembers()) == 1
+	case TOKEN_IN:
+		members := criteria.GetMembers()
+		if len(members) == 0 {
+			return false
+		}
+		for _, m := range members[1:] {
+			if m == nil || m.GetOperator() != TOKEN_PARAM {
+				return false
+			}
+			v := reflect.ValueOf(this.parameters[m.GetValue().(string)])
+			if v.Kind() != reflect.Slice && v.Kind() != reflect.Array ||
+				v.Type().Elem().Kind() == reflect.Uint8 || v.Len() > 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func isAggregation(token Tokener) bool {
+	if token == nil {
+		return false
+	}
+	switch token.GetOperator() {
+	case TOKEN_COUNT, TOKEN_COUNT_COLUMN, TOKEN_COUNT_DISTINCT, TOKEN_SUM, TOKEN_MAX, TOKEN_MIN, TOKEN_STRING_AGG:
+		return true
+	}
+	for _, m := range token.GetMembers() {
+		if isAggregation(m) {
+			return true
+		}
+	}
+	return false
+}
+
 func (this *Query) GetSkip() int64 {
 	return this.skip
 }
@@ -138,6 +439,8 @@ func (this *Query) Skip(skip int64) *Query {
 	} else {
 		this.skip = skip
 	}
+	// the pagination depends on the combination of skip and limit
+	this.rawSQL = nil
 	return this
 }
 
@@ -151,9 +454,25 @@ func (this *Query) Limit(limit int64) *Query {
 	} else {
 		this.limit = limit
 	}
+	this.withTies = false
+	this.rawSQL = nil
+	return this
+}
+
+// LimitWithTies limits the result to the first rows, plus the rows tying with the last one in the ORDER BY.
+// ex: FETCH FIRST 10 ROWS WITH TIES
+// An ORDER BY is required and not all databases support it (ex: MySQL).
+func (this *Query) LimitWithTies(limit int64) *Query {
+	this.Limit(limit)
+	this.withTies = this.limit > 0
+	this.rawSQL = nil
 	return this
 }
 
+func (this *Query) IsWithTies() bool {
+	return this.withTies
+}
+
 func (this *Query) GetSubQuery() *Query {
 	return this.subQuery
 }
@@ -186,6 +505,25 @@ func (this *Query) Count(column interface{}) *Query {
 	return this.Column(Count(column))
 }
 
+// CountDistinct counts the distinct values of the column, so that joining to a one-to-many
+// does not inflate the count of the rows of the main table.
+// If the column is nil, the single key column of the main table is used.
+//
+// ex: Query(PUBLISHER).CountDistinct(nil).Inner(PUBLISHER_A_BOOKS).On(...).Join()
+func (this *Query) CountDistinct(column interface{}) *Query {
+	if column == nil {
+		var key *Column
+		if this.table != nil {
+			key = this.table.GetSingleKeyColumn()
+		}
+		if key == nil {
+			panic("goSQL: CountDistinct without a column needs a main table with a single key column")
+		}
+		column = key
+	}
+	return this.Column(CountDistinct(column))
+}
+
 func (this *Query) Column(columns ...interface{}) *Query {
 	for _, column := range columns {
 		this.lastToken = tokenizeOne(column)
@@ -215,6 +553,13 @@ func (this *Query) As(alias string) *Query {
 	return this
 }
 
+// IgnoreDiscriminators drops, for this query only, the discriminator conditions of the table,
+// so that the rows of all the subtypes are returned. ex: maintenance queries
+func (this *Query) IgnoreDiscriminators() *Query {
+	this.DmlBase.ignoreDiscriminators()
+	return this
+}
+
 // WHERE ===
 func (this *Query) Where(restriction ...*Criteria) *Query {
 	if len(restriction) > 0 {
@@ -223,6 +568,34 @@ func (this *Query) Where(restriction ...*Criteria) *Query {
 	return this
 }
 
+// WhereIf ANDs the restrictions with the ones of the previous Where, WhereIf or WhereIfSet, if the condition is true.
+//
+// ex: WhereIf(name != "", BOOK_C_NAME.Like(name))
+func (this *Query) WhereIf(condition bool, restriction ...*Criteria) *Query {
+	if condition {
+		this.DmlBase.andWhere(restriction)
+	}
+	return this
+}
+
+// WhereIfSet ANDs the restrictions with the ones of the previous Where, WhereIf or WhereIfSet,
+// ignoring the restrictions with a nil, empty or zero value.
+// Useful to list all the possible filters of a search, where only the filled ones are applied.
+//
+// ex: WhereIfSet(BOOK_C_NAME.Matches(form.Name), BOOK_C_PRICE.Lesser(form.MaxPrice))
+func (this *Query) WhereIfSet(restriction ...*Criteria) *Query {
+	this.DmlBase.whereIfSet(restriction)
+	return this
+}
+
+// WhereKey restricts to the row with the supplied primary key,
+// matching all the key columns, even if composite.
+// The values are either in the order the key columns were declared, or a single Key.
+func (this *Query) WhereKey(keys ...interface{}) *Query {
+	this.DmlBase.whereKey(keys)
+	return this
+}
+
 // ===
 
 // ORDER ===
@@ -294,7 +667,11 @@ func (this *Query) OrderBy(column *Column) *Query {
 	}
 }
 
-//Defines the column alias to order by.
+// OrderByAs orders by a column of the query, referred by its alias,
+// avoiding to repeat the expression of the column.
+// The translator decides if the alias or the expression is rendered.
+//
+// ex: query.Include(Sum(BOOK_C_PRICE)).As("total").OrderByAs("total").Desc()
 func (this *Query) OrderByAs(column string) *Query {
 	this.lastOrder = NewOrderAs(column).Asc(true)
 	this.orders = append(this.orders, this.lastOrder)
@@ -322,6 +699,29 @@ func (this *Query) Dir(asc bool) *Query {
 	return this
 }
 
+// Collate sets the collation for the last order by command.
+//
+// ex: query.OrderBy(BOOK_C_NAME).Collate("en_US")
+func (this *Query) Collate(collation string) *Query {
+	if this.lastOrder != nil {
+		this.lastOrder.Collate(collation)
+
+		this.rawSQL = nil
+	}
+	return this
+}
+
+// IgnoreCase orders the last order by command by the lower case value.
+// Useful for databases without case insensitive collations.
+func (this *Query) IgnoreCase() *Query {
+	if this.lastOrder != nil {
+		this.lastOrder.IgnoreCase(true)
+
+		this.rawSQL = nil
+	}
+	return this
+}
+
 func (this *Query) GetOrders() []*Order {
 	return this.orders
 }
@@ -333,7 +733,7 @@ func (this *Query) GetOrders() []*Order {
 // param: associations
 // return this query
 func (this *Query) Inner(associations ...*Association) *Query {
-	this.DmlBase.inner(true, associations...)
+	this.DmlBase.extendPath(INNER_JOIN, associations...)
 	this.lastToken = nil
 
 	return this
@@ -344,7 +744,7 @@ func (this *Query) Inner(associations ...*Association) *Query {
 // param associations
 // return
 func (this *Query) Outer(associations ...*Association) *Query {
-	this.DmlBase.inner(false, associations...)
+	this.DmlBase.extendPath(OUTER_JOIN, associations...)
 	this.lastToken = nil
 
 	return this
@@ -356,24 +756,53 @@ func (this *Query) Outer(associations ...*Association) *Query {
 //It will includes all the columns of all the tables referred by the association path,
 // except where columns were explicitly included.
 func (this *Query) Fetch() *Query {
-	if this.path != nil {
-		for _, pe := range this.path {
-			this.includeInPath(pe) // includes all columns
-		}
+	return this.Join(WithFetch())
+}
+
+// FetchBatch loads the current association with a second query, instead of a join,
+// avoiding the multiplication of rows of a one-to-many fetch.
+// The parents are listed first, then the children of all the parents are fetched with one IN query
+// and set in the parent field with the name of the association alias.
+//
+// Only one association, starting in the driving table and with a single column relation, is supported,
+// and it is only applied by List with a slice of structs.
+//
+// ex: store.Query(PUBLISHER).All().Outer(PUBLISHER_A_BOOKS).FetchBatch().List(&publishers)
+func (this *Query) FetchBatch() *Query {
+	if len(this.path) != 1 {
+		panic("goSQL: FetchBatch requires exactly one association")
+	}
+	pe := this.path[0]
+	association := pe.Base
+	if association.IsMany2Many() || len(association.GetRelations()) != 1 {
+		panic("goSQL: FetchBatch only supports associations with a single column relation. Got " + association.String())
+	}
+	if !association.GetTableFrom().Equals(this.table) {
+		panic("goSQL: FetchBatch association " + association.String() + " does not start in the table " + this.table.String())
 	}
 
-	this.join(true)
+	this.batches = append(this.batches, &batchFetch{association, pe.Columns, pe.Criteria})
+	this.path = nil
 
 	return this
 }
 
-//indicates that the path should be used to join only
-func (this *Query) Join() *Query {
-	this.join(false)
+// Join closes the current association path. Without options, the path is used to join only.
+//
+// ex: Join(WithJoinType(OUTER_JOIN), WithFetch()) fetches the path with outer joins
+func (this *Query) Join(options ...JoinOption) *Query {
+	this.join(newJoinOptions(options))
 	return this
 }
 
-func (this *Query) join(fetch bool) {
+func (this *Query) join(options joinOptions) {
+	fetch := options.fetch
+	if fetch && this.path != nil {
+		for _, pe := range this.path {
+			this.includeInPath(pe) // includes all columns
+		}
+	}
+
 	if this.path != nil {
 		tokens := make([]Tokener, 0)
 		for _, pe := range this.path {
@@ -392,7 +821,7 @@ func (this *Query) join(fetch bool) {
 	}
 
 	// only after this the joins will have the proper join table alias
-	this.DmlBase.joinTo(this.path, fetch)
+	this.DmlBase.joinTo(this.path, options)
 
 	// process pending orders
 	if this.path != nil {
@@ -433,6 +862,19 @@ func (this *Query) Include(columns ...interface{}) *Query {
 	return this
 }
 
+// IncludeIf includes the columns of the last defined association only if the condition is true,
+// allowing optional column sets in the same query builder.
+// ex: Outer(PUBLISHER_A_BOOKS).IncludeIf(full, BOOK_C_PRICE).Join()
+func (this *Query) IncludeIf(condition bool, columns ...interface{}) *Query {
+	if len(this.path) == 0 {
+		panic("There is no current join")
+	}
+	if condition {
+		return this.Include(columns...)
+	}
+	return this
+}
+
 func (this *Query) includeInPath(lastPath *PathElement, columns ...interface{}) {
 	if len(columns) > 0 || len(lastPath.Columns) == 0 {
 		if len(columns) == 0 {
@@ -449,26 +891,53 @@ func (this *Query) includeInPath(lastPath *PathElement, columns ...interface{})
 	}
 }
 
-//Restriction to apply to the previous association
+// Restriction to apply to the previous association, rendered in the ON of the join,
+// so that an outer join keeps returning the rows without a match.
+// Several calls are ANDed.
 func (this *Query) On(criteria ...*Criteria) *Query {
-	if len(this.path) > 0 {
-		var retriction *Criteria
-		if len(criteria) > 1 {
-			retriction = And(criteria...)
-		} else if len(criteria) == 1 {
-			retriction = criteria[0]
-		} else {
-			panic("nil or empty criterias was passed")
-		}
-		this.path[len(this.path)-1].Criteria = retriction
+	this.DmlBase.on(criteria)
+	return this
+}
 
-		this.rawSQL = nil
-	} else {
-		panic("There is no current join")
+// WITH ===
+
+// With defines a common table expression, rendered as WITH name (columns) AS (query),
+// named and with the columns of the table, that the query selects in the same order.
+// The main query, or a join, uses it by referring to the table.
+// The query should have a distinct alias, since the parameters are copied to the main query.
+//
+// ex:
+//
+//	CHEAP = TABLE("CHEAP")
+//	CHEAP_C_ID = CHEAP.KEY("ID")
+//	...
+//	cheap := store.Query(BOOK).Alias("c").Column(BOOK_C_ID).Where(BOOK_C_PRICE.Lesser(10))
+//	store.Query(CHEAP).With(CHEAP, cheap).All()...
+func (this *Query) With(table *Table, query *Query) *Query {
+	return this.WithMaterialization(table, query, MATERIALIZATION_DEFAULT)
+}
+
+// WithMaterialization defines a common table expression, as With, forcing or preventing its materialization.
+// The hint is only rendered by the databases that support it. ex: MATERIALIZED in Postgres 12+
+func (this *Query) WithMaterialization(table *Table, query *Query, materialization Materialization) *Query {
+	// copy the parameters of the subquery to the main query
+	for k, v := range query.GetParameters() {
+		this.SetParameter(k, v)
 	}
+	for k, v := range query.paramColumns {
+		this.paramColumns[k] = v
+	}
+	this.commonTables = append(this.commonTables, &CommonTable{table, query, materialization})
+
+	this.rawSQL = nil
+
 	return this
 }
 
+func (this *Query) GetCommonTables() []*CommonTable {
+	return this.commonTables
+}
+
 // UNIONS ===
 func (this *Query) Union(query *Query) *Query {
 	return this.unite(query, false)
@@ -653,6 +1122,7 @@ func (this *Query) ListSimple(closure func(), instances ...interface{}) error {
 		if err != nil {
 			return err
 		}
+		dbx.NormalizeTime(this.dba.GetLocation(), instances...)
 		closure()
 		return nil
 	})
@@ -697,15 +1167,28 @@ func (this *Query) listIntoClosure(transformer interface{}) ([]interface{}, erro
 		this.All()
 	}
 
+	if this.shortCircuited() {
+		return []interface{}{}, nil
+	}
+
 	rsql := this.getCachedSql()
 	this.debugSQL(rsql.OriSql, 2)
 
-	now := time.Now()
-	r, e := this.DmlBase.dba.QueryInto(rsql.Sql, transformer, rsql.BuildValues(this.DmlBase.parameters)...)
-	this.debugTime(now, 2)
+	rsqls, params, e := this.splitValues(rsql, this.splittable())
 	if e != nil {
 		return nil, e
 	}
+
+	now := time.Now()
+	var r []interface{}
+	for k, rsql := range rsqls {
+		part, e := this.DmlBase.dba.QueryInto(rsql.Sql, transformer, params[k]...)
+		if e != nil {
+			return nil, e
+		}
+		r = append(r, part...)
+	}
+	this.debugTime(now, 2)
 	return r, nil
 }
 
@@ -716,15 +1199,28 @@ func (this *Query) listClosure(transformer func(rows *sql.Rows) error) error {
 		this.All()
 	}
 
+	if this.shortCircuited() {
+		return nil
+	}
+
 	rsql := this.getCachedSql()
 	this.debugSQL(rsql.OriSql, 2)
 
-	now := time.Now()
-	e := this.DmlBase.dba.QueryClosure(rsql.Sql, transformer, rsql.BuildValues(this.DmlBase.parameters)...)
-	this.debugTime(now, 2)
+	rsqls, params, e := this.splitValues(rsql, this.splittable())
 	if e != nil {
 		return e
 	}
+
+	now := time.Now()
+	for k, rsql := range rsqls {
+		dba, done := this.cursorDba(rsql.Sql)
+		e = dba.QueryClosure(rsql.Sql, transformer, params[k]...)
+		done()
+		if e != nil {
+			return e
+		}
+	}
+	this.debugTime(now, 2)
 	return nil
 }
 
@@ -734,15 +1230,28 @@ func (this *Query) listSimpleTransformer(transformer func(rows *sql.Rows) (inter
 		this.All()
 	}
 
+	if this.shortCircuited() {
+		return []interface{}{}, nil
+	}
+
 	rsql := this.getCachedSql()
 	this.debugSQL(rsql.OriSql, 2)
 
-	now := time.Now()
-	list, e := this.DmlBase.dba.Query(rsql.Sql, transformer, rsql.BuildValues(this.DmlBase.parameters)...)
-	this.debugTime(now, 2)
+	rsqls, params, e := this.splitValues(rsql, this.splittable())
 	if e != nil {
 		return nil, e
 	}
+
+	now := time.Now()
+	var list []interface{}
+	for k, rsql := range rsqls {
+		part, e := this.DmlBase.dba.Query(rsql.Sql, transformer, params[k]...)
+		if e != nil {
+			return nil, e
+		}
+		list = append(list, part...)
+	}
+	this.debugTime(now, 2)
 	return list, nil
 }
 
@@ -754,18 +1263,54 @@ func (this *Query) list(rowMapper dbx.IRowTransformer) (coll.Collection, error)
 		this.All()
 	}
 
+	if this.shortCircuited() {
+		list := rowMapper.BeforeAll()
+		rowMapper.AfterAll(list)
+		return list, nil
+	}
+
 	rsql := this.getCachedSql()
 	this.debugSQL(rsql.OriSql, 2)
 
-	now := time.Now()
-	list, e := this.DmlBase.dba.QueryCollection(rsql.Sql, rowMapper, rsql.BuildValues(this.DmlBase.parameters)...)
-	this.debugTime(now, 2)
+	rsqls, params, e := this.splitValues(rsql, this.splittable())
 	if e != nil {
 		return nil, e
 	}
+
+	now := time.Now()
+	var list coll.Collection
+	for k, rsql := range rsqls {
+		dba, done := this.cursorDba(rsql.Sql)
+		part, e := dba.QueryCollection(rsql.Sql, rowMapper, params[k]...)
+		done()
+		if e != nil {
+			return nil, e
+		}
+		if list == nil {
+			list = part
+		} else {
+			list.Add(part.Elements()...)
+		}
+	}
+	this.debugTime(now, 2)
 	return list, nil
 }
 
+// a query can be split in several, due to the maximum of parameters, if their results can just be concatenated.
+// The results are not combined as with an OR: a row matched by several parts is repeated
+func (this *Query) splittable() bool {
+	if len(this.orders) > 0 || this.limit > 0 || this.skip > 0 || this.distinct ||
+		len(this.groupBy) > 0 || len(this.unions) > 0 {
+		return false
+	}
+	for _, column := range this.Columns {
+		if isAggregation(column) {
+			return false
+		}
+	}
+	return true
+}
+
 //Executes a query and transform the results to the struct type passed as parameter,
 //matching the alias with struct property name. If no alias is supplied, it is used the default column alias.
 //
@@ -774,6 +1319,53 @@ func (this *Query) ListOf(template interface{}) (coll.Collection, error) {
 	return this.list(NewEntityTransformer(this, template))
 }
 
+// Executes a query and transform each row into a map, keyed by the column alias.
+// Columns without alias, like an unnamed function, are keyed by COL_<position>.
+func (this *Query) ListMaps() ([]map[string]interface{}, error) {
+	// if no columns were added, add all columns of the driving table
+	if len(this.Columns) == 0 {
+		this.All()
+	}
+
+	list, err := this.list(dbx.NewMapTransformer().Keys(this.mapKeys()...))
+	if err != nil {
+		return nil, err
+	}
+
+	maps := make([]map[string]interface{}, 0, list.Size())
+	for _, v := range list.Elements() {
+		maps = append(maps, v.(map[string]interface{}))
+	}
+	return maps, nil
+}
+
+// Executes a query and transform each row into an OrderedRow, with the values in the select order.
+// The keys are the same as in ListMaps.
+func (this *Query) ListOrderedMaps() ([]*dbx.OrderedRow, error) {
+	// if no columns were added, add all columns of the driving table
+	if len(this.Columns) == 0 {
+		this.All()
+	}
+
+	list, err := this.list(dbx.NewMapTransformer().Keys(this.mapKeys()...).Ordered(true))
+	if err != nil {
+		return nil, err
+	}
+	return dbx.OrderedRows(list), nil
+}
+
+// the column alias or, for columns without alias, COL_<position>
+func (this *Query) mapKeys() []string {
+	keys := make([]string, len(this.Columns))
+	for k, token := range this.Columns {
+		keys[k] = token.GetAlias()
+		if keys[k] == "" {
+			keys[k] = "COL_" + strconv.Itoa(k+1)
+		}
+	}
+	return keys
+}
+
 // Executes a query and transform the results into a tree with the passed struct type as the head.
 // It matches the alias with struct property name, building a struct tree.
 // If the transformed data matches a previous converted entity the previous one is reused.
@@ -794,6 +1386,27 @@ func (this *Query) List(target interface{}) error {
 	}
 
 	if isStruct {
+		if len(this.batches) > 0 {
+			var parents []reflect.Value
+			collect := caller
+			caller = func(val reflect.Value) reflect.Value {
+				parents = append(parents, val)
+				return collect(val)
+			}
+			if _, err := this.list(NewEntityFactoryTransformer(this, typ, caller)); err != nil {
+				return err
+			}
+			if err := this.fetchBatches(parents); err != nil {
+				return err
+			}
+			// the elements of a slice of structs are copies, taken before the children were set
+			if slice := reflect.ValueOf(target).Elem(); slice.Type().Elem().Kind() == reflect.Struct {
+				for k, parent := range parents {
+					slice.Index(k).Set(parent.Elem())
+				}
+			}
+			return nil
+		}
 		_, err := this.list(NewEntityFactoryTransformer(this, typ, caller))
 		return err
 	} else {
@@ -802,6 +1415,7 @@ func (this *Query) List(target interface{}) error {
 			if err := rows.Scan(holder); err != nil {
 				return err
 			}
+			dbx.NormalizeTime(this.dba.GetLocation(), holder)
 			caller(reflect.ValueOf(holder).Elem())
 			return nil
 		})
@@ -916,6 +1530,38 @@ func (this *Query) ListFlatTreeOf(template interface{}) (coll.Collection, error)
 	return this.list(NewEntityTreeTransformer(this, false, template))
 }
 
+// ListTree executes the query and builds a struct tree, putting the heads in the slice, passed as an argument.
+// The rows of the same entity, identified by the values of the key columns, are merged into one struct,
+// collecting the one-to-many children into the slice fields, so the structs do not need to implement toolkit.Hasher.
+// The key columns of all the fetched tables must be in the select.
+// The argument must be a slice like *[]*struct.
+//
+// ex: store.Query(PUBLISHER).All().Outer(PUBLISHER_A_BOOKS).Fetch().ListTree(&publishers)
+func (this *Query) ListTree(target interface{}) error {
+	caller, typ, isStruct, ok := checkSlice(target)
+	// the heads are changed by the following rows, so the slice must hold pointers
+	if !ok || !isStruct || reflect.TypeOf(target).Elem().Elem().Kind() != reflect.Ptr {
+		return errors.New(fmt.Sprintf("goSQL: Expected a slice of type *[]*struct. Got %T", target))
+	}
+
+	// each head is only added once
+	heads := make(map[interface{}]bool)
+	transformer := NewEntityTreeFactoryTransformer(this, typ, func(val reflect.Value) reflect.Value {
+		head := val.Interface()
+		if heads[head] {
+			return reflect.Value{}
+		}
+		heads[head] = true
+		return caller(val)
+	})
+	transformer.reuse = true
+	transformer.entities = coll.NewHashMap()
+	transformer.keyed = make(map[string]reflect.Value)
+
+	_, err := this.list(transformer)
+	return err
+}
+
 //Executes a query, putting the result in a slice, passed as an argument or
 //delegating the responsability of building the result to a processor function.
 //The argument must be a function with the signature func(<<*>struct>) or a slice like *[]<*>struct.
@@ -941,11 +1587,20 @@ func (this *Query) SelectInto(dest ...interface{}) (bool, error) {
 		this.All()
 	}
 
+	if this.shortCircuited() {
+		return false, nil
+	}
+
 	rsql := this.getCachedSql()
 	this.debugSQL(rsql.OriSql, 1)
 
+	rsql, params, e := this.buildValues(rsql)
+	if e != nil {
+		return false, e
+	}
+
 	now := time.Now()
-	found, e := this.dba.QueryRow(rsql.Sql, rsql.BuildValues(this.DmlBase.parameters), dest...)
+	found, e := this.dba.QueryRow(rsql.Sql, params, dest...)
 	this.debugTime(now, 1)
 	if e != nil {
 		return false, e
@@ -953,6 +1608,93 @@ func (this *Query) SelectInto(dest ...interface{}) (bool, error) {
 	return found, nil
 }
 
+// Max selects the greatest value of the column into dest, a pointer whose type defines the type of the value.
+// The columns of the query are replaced by the aggregate.
+// Returns false, leaving dest unchanged, if there are no values.
+//
+// ex:
+//
+//	var price float64
+//	found, err := store.Query(BOOK).Where(BOOK_C_PUBLISHER_ID.Matches(2)).Max(BOOK_C_PRICE, &price)
+func (this *Query) Max(column interface{}, dest interface{}) (bool, error) {
+	return this.selectAggregate(Max(column), dest)
+}
+
+// Min selects the least value of the column into dest, as Max.
+func (this *Query) Min(column interface{}, dest interface{}) (bool, error) {
+	return this.selectAggregate(Min(column), dest)
+}
+
+func (this *Query) selectAggregate(aggregate *Token, dest interface{}) (bool, error) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return false, errors.New(fmt.Sprintf("goSQL: Expected a pointer as the destination of the aggregate. Got %T", dest))
+	}
+
+	this.ColumnsReset()
+	this.Column(aggregate)
+
+	// the aggregate of no rows is NULL, so it is scanned into a pointer of the type of the destination
+	holder := reflect.New(v.Type())
+	found, err := this.SelectInto(holder.Interface())
+	if err != nil || !found || holder.Elem().IsNil() {
+		return false, err
+	}
+	v.Elem().Set(holder.Elem().Elem())
+	return true, nil
+}
+
+// IntoTable creates the table with the result of the query, rendered as CREATE TABLE name (columns) AS SELECT ...
+// The table is named and has the columns of the declared table, that the query selects in the same order.
+// An error is returned if the database does not support it.
+// ex: Firebird, or Oracle with parameters, since Oracle does not accept bind variables in DDL.
+// Some databases commit the ongoing transaction.
+//
+// ex:
+//
+//	CHEAP = TABLE("CHEAP")
+//	CHEAP_C_ID = CHEAP.KEY("ID")
+//	CHEAP_C_NAME = CHEAP.COLUMN("NAME")
+//	...
+//	store.Query(BOOK).Column(BOOK_C_ID, BOOK_C_NAME).Where(BOOK_C_PRICE.Lesser(10)).IntoTable(CHEAP)
+func (this *Query) IntoTable(table *Table) (affected int64, err error) {
+	// if no columns were added, add all columns of the driving table
+	if len(this.Columns) == 0 {
+		this.All()
+	}
+
+	rsql, err := this.createTableAsSql(table)
+	if err != nil {
+		return 0, err
+	}
+	this.debugSQL(rsql.OriSql, 1)
+
+	rsql, params, e := this.buildValues(rsql)
+	if e != nil {
+		return 0, e
+	}
+
+	now := time.Now()
+	result, e := this.dba.Exec(rsql.Sql, params...)
+	this.debugTime(now, 1)
+	if e != nil {
+		return 0, e
+	}
+	// not every driver reports the created rows
+	affected, _ = result.RowsAffected()
+	return affected, nil
+}
+
+func (this *Query) createTableAsSql(table *Table) (rsql *RawSql, err error) {
+	defer recoverSQL(&err)
+	// if the discriminator conditions have not yet been processed, apply them now
+	if this.discriminatorCriterias != nil && this.criteria == nil {
+		this.DmlBase.where(nil)
+	}
+	tx := this.db.GetTranslator()
+	return ToRawSql(tx.GetSqlForCreateTableAs(this, table), tx), nil
+}
+
 //Returns a struct tree. When reuse is true the supplied template instance must implement
 //the toolkit.Hasher interface.
 //
@@ -997,6 +1739,30 @@ func (this *Query) SelectTo(instance interface{}) (bool, error) {
 	return false, nil
 }
 
+// LoadInto puts the first result of the query in the supplied struct pointer, scanning onto the instance
+// instead of replacing it, so that only the fields of the selected columns are overwritten. ex: read-modify-write
+// Returns true if a result was found, false if no result
+func (this *Query) LoadInto(instance interface{}) (bool, error) {
+	val := reflect.ValueOf(instance)
+	if val.Kind() != reflect.Ptr || val.IsNil() || val.Elem().Kind() != reflect.Struct {
+		return false, errors.New(fmt.Sprintf("goSQL: Expected a non nil struct pointer to load into, but got %T", instance))
+	}
+
+	transformer := NewEntityTransformer(this, instance)
+	transformer.Factory = func() reflect.Value {
+		return val
+	}
+	res, err := this.selectTransformer(transformer)
+	if err != nil || res == nil {
+		return false, err
+	}
+	// the instance now reflects the database
+	if t, ok := instance.(Markable); ok {
+		t.Unmark()
+	}
+	return true, nil
+}
+
 //Executes the query and builds a struct tree, reusing previously obtained entities,
 //putting the first element in the supplied struct pointer.
 //Since the struct instances are going to be reused it is mandatory that all the structs
@@ -1046,9 +1812,11 @@ func (this *Query) selectTreeTo(instance interface{}, reuse bool) (bool, error)
 }
 
 func (this *Query) selectTransformer(rowMapper dbx.IRowTransformer) (interface{}, error) {
-	oldMax := this.limit
+	oldMax, oldTies := this.limit, this.withTies
 	this.Limit(1)
-	defer this.Limit(oldMax)
+	defer func() {
+		this.limit, this.withTies = oldMax, oldTies
+	}()
 
 	list, err := this.list(rowMapper)
 	if err != nil {
@@ -1061,6 +1829,66 @@ func (this *Query) selectTransformer(rowMapper dbx.IRowTransformer) (interface{}
 	return list.Enumerator().Next(), nil // first one
 }
 
+// Compile returns the generated SQL, so that it can be executed repeatedly
+// with different parameters, without going through the SQL generation.
+// The parameters must include all the query parameters, so the ones returned by GetParameters()
+// can be copied as a starting point, since they also hold the parameters for values and pagination.
+//
+//	rsql := query.Compile()
+//	params := query.GetParameters()
+//	params["name"] = "Geek"
+//	list, err := query.GetDba().QueryCompiled(rsql, params, transformer)
+func (this *Query) Compile() *RawSql {
+	return this.getCachedSql()
+}
+
+// Fingerprint returns the structure of the query, with the parameters and the literals replaced by ?,
+// so that the executions of the queries with the same shape, but different values, can be grouped.
+// See dbx.Fingerprint
+func (this *Query) Fingerprint() string {
+	// if no columns were added, add all columns of the driving table
+	if len(this.Columns) == 0 {
+		this.All()
+	}
+	return dbx.Fingerprint(this.getCachedSql().OriSql)
+}
+
+// InterpolatedSQL returns the SQL with the parameters values in place, for logging and debugging.
+// Secret parameters, by SECRET_SUFFIX, by SecretParameters or bound to a Secret column, are masked.
+// It is NOT SAFE to execute the returned SQL.
+func (this *Query) InterpolatedSQL() string {
+	return this.interpolate(this.getCachedSql())
+}
+
+// GetCachedSQL returns the generated SQL, without executing it.
+// Failures generating the SQL are returned as errors.
+func (this *Query) GetCachedSQL() (rsql *RawSql, err error) {
+	defer recoverSQL(&err)
+	// if no columns were added, add all columns of the driving table
+	if len(this.Columns) == 0 {
+		this.All()
+	}
+	return this.getCachedSql(), nil
+}
+
+// FromSQL returns the FROM, JOIN and WHERE portion of the query, and the ordered values of its parameters,
+// to be reused in a larger statement that the builder cannot express. ex: a correlated subquery or a view definition.
+// rsql.OriSql has the named parameters and rsql.Sql the placeholders of the database.
+//
+// Queries with common tables (WITH) are rejected, since the WITH clause cannot be part of the FROM.
+func (this *Query) FromSQL() (rsql *RawSql, values []interface{}, err error) {
+	defer recoverSQL(&err)
+	if len(this.commonTables) > 0 {
+		return nil, nil, errors.New("goSQL: FromSQL does not support queries with common tables (WITH)")
+	}
+	// if the discriminator conditions have not yet been processed, apply them now
+	if this.discriminatorCriterias != nil && this.criteria == nil {
+		this.DmlBase.where(nil)
+	}
+	tx := this.db.GetTranslator()
+	return this.buildValues(ToRawSql(tx.GetSqlForFrom(this), tx))
+}
+
 // SQL String. It is cached for multiple access
 func (this *Query) getCachedSql() *RawSql {
 	if this.rawSQL == nil {
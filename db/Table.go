@@ -13,13 +13,18 @@ type Table struct {
 	columnsMap     coll.Map        // Str -> Column
 	associationMap coll.Map        // Str -> Association
 	name           string          // table name
+	schema         string          // table schema. empty for the default schema
 	Alias          string          // table alias
 	columns        coll.Collection // column set
 	keys           coll.Collection // key column set
 	singleKey      *Column         // single key
 	version        *Column         // column version
 	deletion       *Column         // logic deletion column
+	created        *Column         // creation timestamp column
+	updated        *Column         // modification timestamp column
+	timestampInSQL bool            // timestamps are generated by the database
 	discriminators []Discriminator //
+	combiner       DiscriminatorCombiner
 
 	PreInsertTrigger func(*Insert)
 	PreUpdateTrigger func(*Update)
@@ -53,6 +58,17 @@ func (this *Table) GetName() string {
 	return this.name
 }
 
+// Schema declares the schema of the table, rendered as schema.table.
+// The schema can be mapped to another one, per store, with IDb.MapSchema.
+func (this *Table) Schema(schema string) *Table {
+	this.schema = schema
+	return this
+}
+
+func (this *Table) GetSchema() string {
+	return this.schema
+}
+
 func (this *Table) COLUMN(name string) *Column {
 	col := new(Column)
 	col.name = name
@@ -84,6 +100,41 @@ func (this *Table) DELETION(name string) *Column {
 	return this.COLUMN(name).Deletion()
 }
 
+// VIRTUAL declares a column computed by an expression over the other columns of this table.
+// It can be used in the select list and is mapped by the transformers like any other column,
+// but it cannot be inserted or updated.
+//
+// ex: BOOK.VIRTUAL("DOUBLE_PRICE", db.Multiply(BOOK_C_PRICE, 2))
+func (this *Table) VIRTUAL(name string, expression interface{}) *Column {
+	if expression == nil {
+		panic("Null for the expression of the virtual column " + name + " is not allowed.")
+	}
+	col := this.COLUMN(name)
+	col.virtual = tokenizeOne(expression)
+	return col
+}
+
+// CREATED declares the column that is set with the current time on insert
+func (this *Table) CREATED(name string) *Column {
+	col := this.COLUMN(name)
+	this.created = col
+	return col
+}
+
+// UPDATED declares the column that is set with the current time on insert and on update
+func (this *Table) UPDATED(name string) *Column {
+	col := this.COLUMN(name)
+	this.updated = col
+	return col
+}
+
+// TimestampInSQL generates the CREATED and UPDATED values with the database CURRENT_TIMESTAMP,
+// instead of the Go time.
+func (this *Table) TimestampInSQL() *Table {
+	this.timestampInSQL = true
+	return this
+}
+
 func (this *Table) addKey(col *Column) {
 	this.keys.Add(col)
 	if this.keys.Size() == 1 {
@@ -112,6 +163,17 @@ func (this *Table) With(column string, value interface{}) *Table {
 	return this
 }
 
+// CombineDiscriminators defines how the discriminators are combined with the where restrictions.
+// By default everything is ANDed.
+func (this *Table) CombineDiscriminators(combiner DiscriminatorCombiner) *Table {
+	this.combiner = combiner
+	return this
+}
+
+func (this *Table) GetDiscriminatorCombiner() DiscriminatorCombiner {
+	return this.combiner
+}
+
 func (this *Table) ASSOCIATE(from ...*Column) ColGroup {
 	// all columns must be from this table.
 	for _, source := range from {
@@ -161,6 +223,18 @@ func (this *Table) GetVersionColumn() *Column {
 	return this.version
 }
 
+func (this *Table) GetCreatedColumn() *Column {
+	return this.created
+}
+
+func (this *Table) GetUpdatedColumn() *Column {
+	return this.updated
+}
+
+func (this *Table) IsTimestampInSQL() bool {
+	return this.timestampInSQL
+}
+
 func (this *Table) GetDeletionColumn() *Column {
 	return this.deletion
 }
@@ -173,7 +247,8 @@ func (this *Table) Equals(obj interface{}) bool {
 	switch t := obj.(type) { //type switch
 	case *Table:
 		return this.Alias == t.Alias &&
-			strings.ToUpper(this.name) == strings.ToUpper(t.GetName())
+			strings.ToUpper(this.name) == strings.ToUpper(t.GetName()) &&
+			strings.ToUpper(this.schema) == strings.ToUpper(t.GetSchema())
 	}
 
 	return false
@@ -106,6 +106,28 @@ func (this *Token) SetAlias(alias string) {
 	this.Alias = alias
 }
 
+// As defines the output name of the token when used in the select list.
+// ex: Sum(BOOK_C_PRICE).As("total")
+func (this *Token) As(alias string) *Token {
+	this.Alias = alias
+	return this
+}
+
+// Filter restricts the rows aggregated by this aggregate token to the ones matching the criteria.
+// Rendered as FILTER (WHERE ...) where supported, otherwise the aggregated value is wrapped in a CASE.
+// Panics if the token is not an aggregate.
+// ex: Count(nil).Filter(BOOK_C_PRICE.Lesser(20)).As("cheap")
+func (this *Token) Filter(criteria *Criteria) *Token {
+	switch this.Operator {
+	case TOKEN_COUNT, TOKEN_COUNT_COLUMN, TOKEN_COUNT_DISTINCT, TOKEN_SUM, TOKEN_MAX, TOKEN_MIN, TOKEN_STRING_AGG:
+	default:
+		panic("goSQL: Filter only applies to aggregates. Got " + this.Operator)
+	}
+	filter := NewToken(TOKEN_FILTER, this, criteria)
+	filter.Alias = this.Alias
+	return filter
+}
+
 // Propagates table alias
 func (this *Token) SetTableAlias(tableAlias string) {
 	this.tableAlias = tableAlias
@@ -1,6 +1,10 @@
 package db
 
-import ()
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
 
 func Col(column *Column) *ColumnHolder {
 	return NewColumnHolder(column)
@@ -8,28 +12,46 @@ func Col(column *Column) *ColumnHolder {
 
 // CRITERIA ===========================
 
-func criteriasToInterface(operations []*Criteria) []interface{} {
-	toks := make([]interface{}, len(operations))
-	for k, v := range operations {
-		toks[k] = v
-	}
-	return toks
-}
-
+// Or combines the criterias with OR.
+// nil criterias are ignored and nested ORs are flattened.
+// If no criteria remains, nil is returned, that Where ignores.
 func Or(operations ...*Criteria) *Criteria {
-	if len(operations) == 1 {
-		return operations[0]
-	}
-
-	return NewCriteria(TOKEN_OR, criteriasToInterface(operations)...)
+	return combine(TOKEN_OR, operations)
 }
 
+// And combines the criterias with AND.
+// nil criterias are ignored and nested ANDs are flattened.
+// If no criteria remains, nil is returned, that Where ignores.
 func And(operations ...*Criteria) *Criteria {
-	if len(operations) == 1 {
-		return operations[0]
+	return combine(TOKEN_AND, operations)
+}
+
+func combine(operator string, operations []*Criteria) *Criteria {
+	var members []interface{}
+	var last *Criteria
+	for _, c := range operations {
+		if c == nil {
+			continue
+		}
+		last = c
+		if c.GetOperator() == operator && !c.IsNot {
+			for _, m := range c.Members {
+				members = append(members, m)
+			}
+		} else {
+			members = append(members, c)
+		}
 	}
 
-	return NewCriteria(TOKEN_AND, criteriasToInterface(operations)...)
+	switch len(members) {
+	case 0:
+		return nil
+	case 1:
+		if last != nil && last.GetOperator() != operator {
+			return last
+		}
+	}
+	return NewCriteria(operator, members...)
 }
 
 func Greater(left, right interface{}) *Criteria {
@@ -83,6 +105,87 @@ func In(column interface{}, values ...interface{}) *Criteria {
 	return NewCriteria(TOKEN_IN, vals...)
 }
 
+// InTuple matches the values of several columns with any of the rows of values.
+// Every row must have one value for each column.
+// ex: InTuple([]*Column{A, B}, []interface{}{1, 2}, []interface{}{3, 4}) -> (A, B) IN ((1, 2), (3, 4))
+func InTuple(columns []*Column, rows ...[]interface{}) *Criteria {
+	cols := make([]interface{}, len(columns))
+	for k, c := range columns {
+		cols[k] = c
+	}
+	vals := []interface{}{NewToken(TOKEN_TUPLE, cols...)}
+	for _, row := range rows {
+		if len(row) != len(columns) {
+			panic(fmt.Sprintf("Expected %v values for the tuple but got %v", len(columns), len(row)))
+		}
+		vals = append(vals, NewToken(TOKEN_TUPLE, row...))
+	}
+	return NewCriteria(TOKEN_IN_TUPLE, vals...)
+}
+
+// InStructs matches the values of several columns with the fields of each struct, or struct pointer, of the slice.
+// A field is mapped to a column by its sql tag or by its name, as the column name or alias.
+// If not every column is mapped, the first exported fields are used, in the order they are declared.
+// ex: InStructs([]*Column{BOOK_C_ID, BOOK_C_PUBLISHER_ID}, []BookKey{{1, 1}, {3, 2}})
+func InStructs(columns []*Column, structs interface{}) *Criteria {
+	v := reflect.ValueOf(structs)
+	if v.Kind() != reflect.Slice {
+		panic(fmt.Sprintf("Expected a slice of structs but got %T", structs))
+	}
+	typ := v.Type().Elem()
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("Expected a slice of structs but got %T", structs))
+	}
+
+	fields := columnFields(typ, columns)
+	rows := make([][]interface{}, v.Len())
+	for i := range rows {
+		e := reflect.Indirect(v.Index(i))
+		row := make([]interface{}, len(fields))
+		for k, f := range fields {
+			row[k] = e.FieldByIndex(f).Interface()
+		}
+		rows[i] = row
+	}
+	return InTuple(columns, rows...)
+}
+
+// the index of the struct field of each column
+func columnFields(typ reflect.Type, columns []*Column) [][]int {
+	var exported [][]int
+	named := make(map[string][]int)
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		exported = append(exported, f.Index)
+		named[strings.ToUpper(f.Name)] = f.Index
+		if tag := strings.Split(f.Tag.Get("sql"), ",")[0]; tag != "" && tag != sqlOmitionVal {
+			named[strings.ToUpper(tag)] = f.Index
+		}
+	}
+
+	fields := make([][]int, len(columns))
+	for k, column := range columns {
+		f, ok := named[strings.ToUpper(column.GetName())]
+		if !ok {
+			f, ok = named[strings.ToUpper(column.GetAlias())]
+		}
+		if !ok {
+			if len(exported) < len(columns) {
+				panic(fmt.Sprintf("Expected %v exported fields in %s but got %v", len(columns), typ, len(exported)))
+			}
+			return exported[:len(columns)]
+		}
+		fields[k] = f
+	}
+	return fields
+}
+
 func IMatches(left, right interface{}) *Criteria {
 	return NewCriteria(TOKEN_IEQ, left, right)
 }
@@ -99,10 +202,20 @@ func Different(left, right interface{}) *Criteria {
 	return NewCriteria(TOKEN_NEQ, left, right)
 }
 
+// Exists checks if the subquery returns any row.
+// To correlate with the outer query, the subquery must have a different table alias,
+// and refer the outer columns with For(), ex: PUBLISHER_C_ID.For("t0")
 func Exists(token interface{}) *Criteria {
 	return NewCriteria(TOKEN_EXISTS, token)
 }
 
+// NotExists checks if the subquery does not return any row.
+func NotExists(token interface{}) *Criteria {
+	return Exists(token).Not()
+}
+
+// Not negates any criteria, including compound ones, wrapping it in NOT (...).
+// ex: Not(BOOK_C_PRICE.Greater(10).Or(BOOK_C_NAME.Like("%book")))
 func Not(token interface{}) *Criteria {
 	return NewCriteria(TOKEN_NOT, token)
 }
@@ -112,10 +225,21 @@ func Param(str string) *Token {
 	return NewEndToken(TOKEN_PARAM, str) // RAW info
 }
 
+// Now is the current timestamp of the database
+func Now() *Token {
+	return NewEndToken(TOKEN_NOW, nil)
+}
+
 func Null() *Token {
 	return NewEndToken(TOKEN_NULL, nil)
 }
 
+// Default is the column default of the database, rendered as the DEFAULT keyword.
+// Unlike Null, the database decides the value, eg: a sequence or the current time.
+func Default() *Token {
+	return NewEndToken(TOKEN_DEFAULT, nil)
+}
+
 func Raw(o interface{}) *Token {
 	return NewEndToken(TOKEN_RAW, o) // RAW info
 }
@@ -156,6 +280,11 @@ func Count(column interface{}) *Token {
 	return NewToken(TOKEN_COUNT_COLUMN, column)
 }
 
+// CountDistinct counts the distinct values of the column
+func CountDistinct(column interface{}) *Token {
+	return NewToken(TOKEN_COUNT_DISTINCT, column)
+}
+
 func Rtrim(token interface{}) *Token {
 	return NewToken(TOKEN_RTRIM, token)
 }
@@ -179,6 +308,18 @@ func SubQuery(sq *Query) *Token {
 	return NewEndToken(TOKEN_SUBQUERY, sq)
 }
 
+// AnyOf compares with the values of the subquery, being true if the comparison is true for any of them.
+// ex: BOOK_C_PRICE.Matches(AnyOf(subquery))
+func AnyOf(sq *Query) *Token {
+	return NewToken(TOKEN_ANY, sq)
+}
+
+// AllOf compares with the values of the subquery, being true if the comparison is true for all of them.
+// ex: BOOK_C_PRICE.Greater(AllOf(subquery))
+func AllOf(sq *Query) *Token {
+	return NewToken(TOKEN_ALL, sq)
+}
+
 /*
 	func Tokener autoNumber(DbNUM o) {
 		return NewToken(TOKEN_AUTONUM, NewColumnHolder(o));
@@ -189,6 +330,32 @@ func Coalesce(values ...interface{}) *Token {
 	return NewToken(TOKEN_COALESCE, values...)
 }
 
+// Greatest is the largest of the values, that can be Columns, Tokens or primitives.
+// ex: Greatest(BOOK_C_PRICE, AsIs(20))
+func Greatest(values ...interface{}) *Token {
+	if len(values) < 2 {
+		panic("Greatest needs at least two values")
+	}
+	return NewToken(TOKEN_GREATEST, values...)
+}
+
+// Least is the smallest of the values, that can be Columns, Tokens or primitives.
+func Least(values ...interface{}) *Token {
+	if len(values) < 2 {
+		panic("Least needs at least two values")
+	}
+	return NewToken(TOKEN_LEAST, values...)
+}
+
+// StringAgg concatenates the values of a group, separated by separator,
+// ordered ascending by the orderBy values, if any.
+// It is rendered as STRING_AGG, GROUP_CONCAT, LISTAGG or LIST, depending on the database.
+// ex: StringAgg(BOOK_C_NAME, ", ", BOOK_C_NAME)
+func StringAgg(value interface{}, separator string, orderBy ...interface{}) *Token {
+	members := []interface{}{value, AsIs("'" + strings.Replace(separator, "'", "''", -1) + "'")}
+	return NewToken(TOKEN_STRING_AGG, append(members, orderBy...)...)
+}
+
 func If(criteria *Criteria) *SearchedWhen {
 	return NewSearchedCase().If(criteria)
 }
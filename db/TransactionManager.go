@@ -5,31 +5,137 @@ import (
 	"github.com/quintans/toolkit/cache"
 	. "github.com/quintans/toolkit/ext"
 
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
 )
 
 var _ dbx.IConnection = &MyTx{}
 var _ dbx.IConnection = &NoTx{}
+var _ dbx.StatementKeeper = &MyTx{}
+var _ dbx.CommentPreparer = &MyTx{}
+
+// the statements prepared in a transaction, shared by its executions until the transaction ends
+type txStatements struct {
+	sync.Mutex
+	byKey map[string]*sql.Stmt
+	kept  map[*sql.Stmt]bool
+}
+
+func newTxStatements() *txStatements {
+	return &txStatements{
+		byKey: make(map[string]*sql.Stmt),
+		kept:  make(map[*sql.Stmt]bool),
+	}
+}
 
 type MyTx struct {
 	*sql.Tx
 	stmtCache *cache.LRUCache
+	// if the trailing comment is part of the statement cache key
+	commentInKey bool
+	// transaction nesting level. The outermost transaction is 1
+	depth int
+	// statements shared in the transaction. nil if disabled
+	txStmts *txStatements
+	// server side cursors still open at this depth
+	cursors int
+}
+
+func (this *MyTx) Depth() int {
+	return this.depth
+}
+
+// inSavepoint runs fn inside the savepoint with the passed name, so that its changes
+// can be undone without ending the transaction.
+// If fn fails or panics, or the savepoint cannot be released, the transaction is rolled back to the savepoint.
+// A failed rollback is reported with the error that caused it.
+func (this *MyTx) inSavepoint(translator Translator, name string, fn func() error) (err error) {
+	if _, err = this.Exec(translator.GetSqlForSavepoint(name)); err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			this.Exec(translator.GetSqlForRollbackTo(name))
+			panic(r) // up you go
+		}
+	}()
+
+	if err = fn(); err == nil {
+		if sql := translator.GetSqlForReleaseSavepoint(name); sql != "" {
+			_, err = this.Exec(sql)
+		}
+		if err == nil {
+			return nil
+		}
+	}
+	if _, e := this.Exec(translator.GetSqlForRollbackTo(name)); e != nil {
+		return fmt.Errorf("goSQL: Unable to rollback to the savepoint %s (%s) after: %w", name, e, err)
+	}
+	return err
 }
 
 // The implementor of Prepare should cache the prepared statements
 func (this *MyTx) Prepare(query string) (*sql.Stmt, error) {
+	return this.prepareKeyed(query, query)
+}
+
+// PrepareCommented prepares the query, that ends with the comment of SetComment.
+// If the comment is not part of the cache key, the statements only differing in it are shared.
+func (this *MyTx) PrepareCommented(query string, comment string) (*sql.Stmt, error) {
+	key := query
+	if !this.commentInKey {
+		key = dbx.StripComment(query, comment)
+	}
+	return this.prepareKeyed(query, key)
+}
+
+func (this *MyTx) prepareKeyed(query string, key string) (*sql.Stmt, error) {
+	if this.txStmts == nil {
+		return this.prepare(query, key)
+	}
+
+	this.txStmts.Lock()
+	defer this.txStmts.Unlock()
+	if stmt := this.txStmts.byKey[key]; stmt != nil {
+		return stmt, nil
+	}
+	stmt, err := this.prepare(query, key)
+	if err == nil {
+		this.txStmts.byKey[key] = stmt
+		this.txStmts.kept[stmt] = true
+	}
+	return stmt, err
+}
+
+// Keeps tells if the statement is kept by the statement cache of the transaction.
+// These statements are closed when the transaction ends.
+func (this *MyTx) Keeps(stmt *sql.Stmt) bool {
+	if this.txStmts == nil {
+		return false
+	}
+	this.txStmts.Lock()
+	defer this.txStmts.Unlock()
+	return this.txStmts.kept[stmt]
+}
+
+func (this *MyTx) prepare(query string, key string) (*sql.Stmt, error) {
 	var err error
 	var stmt *sql.Stmt
 	if this.stmtCache == nil {
 		stmt, err = this.Tx.Prepare(query)
 	} else {
-		s, _ := this.stmtCache.GetIfPresent(query)
+		s, _ := this.stmtCache.GetIfPresent(key)
 		stmt, _ = s.(*sql.Stmt)
 		if stmt == nil {
 			stmt, err = this.Tx.Prepare(query)
 			if err == nil {
-				this.stmtCache.Put(query, stmt)
+				this.stmtCache.Put(key, stmt)
 			}
 		} else {
 			stmt = this.Tx.Stmt(stmt)
@@ -73,6 +179,9 @@ func (this *NoTx) Prepare(query string) (*sql.Stmt, error) {
 
 type ITransactionManager interface {
 	Transaction(handler func(db IDb) error) error
+	// TransactionWith runs the handler in a transaction with the isolation level and the read only flag of the options
+	TransactionWith(opts *sql.TxOptions, handler func(db IDb) error) error
+	NestedTransaction(db IDb, handler func(db IDb) error) error
 	NoTransaction(handler func(db IDb) error) error
 	Store() IDb
 }
@@ -81,8 +190,25 @@ var _ ITransactionManager = &TransactionManager{}
 
 type TransactionManager struct {
 	database  *sql.DB
+	replica   *sql.DB
 	dbFactory func(inTx *bool, c dbx.IConnection) IDb
 	stmtCache *cache.LRUCache
+	// interceptors for every created IDb
+	interceptors []dbx.Interceptor
+	// logger for every created IDb. If nil, the package logger is used
+	logger dbx.Logger
+	// location of the times for every created IDb. If nil, the times are not converted
+	location *time.Location
+	// maximum wait for a pool connection when beginning a transaction. Zero waits forever
+	acquireTimeout time.Duration
+	// comment for every created IDb
+	comment string
+	// if the comment is part of the statement cache key
+	commentInKey bool
+	// if the statements are shared in each transaction
+	txStmtCache bool
+	// server side limit of the execution time of the statements of each transaction. Zero means no limit
+	statementTimeout time.Duration
 }
 
 // NewTransactionManager creates a new Transaction Manager
@@ -96,20 +222,189 @@ func NewTransactionManager(database *sql.DB, dbFactory func(inTx *bool, c dbx.IC
 	if capacity > 1 {
 		this.stmtCache = cache.NewLRUCache(capacity)
 	}
+	this.commentInKey = true
+	return this
+}
+
+// SetReplica defines the connection pool of a read replica.
+// Queries outside of a transaction will be executed against it.
+func (this *TransactionManager) SetReplica(replica *sql.DB) *TransactionManager {
+	this.replica = replica
+	return this
+}
+
+// AddInterceptor registers interceptors for all the SQL executed by the IDb created by this manager.
+func (this *TransactionManager) AddInterceptor(interceptors ...dbx.Interceptor) *TransactionManager {
+	this.interceptors = append(this.interceptors, interceptors...)
+	return this
+}
+
+// SetLogger routes the goSQL logs, of this manager and of the IDb created by it, to the supplied logger.
+// ex: a logger adding a request correlation id.
+func (this *TransactionManager) SetLogger(logger dbx.Logger) *TransactionManager {
+	this.logger = logger
+	return this
+}
+
+// SetLocation converts, for the IDb created by this manager, the time parameters to the location
+// before binding them and the scanned times to the location, avoiding shifts between UTC and local time
+// that depend on the driver.
+func (this *TransactionManager) SetLocation(location *time.Location) *TransactionManager {
+	this.location = location
+	return this
+}
+
+// SetComment appends the comment to all the SQL executed by the IDb created by this manager.
+// ex: app=billing. Each IDb can override it with its own SetComment.
+func (this *TransactionManager) SetComment(comment string) *TransactionManager {
+	this.comment = comment
+	return this
+}
+
+// SetCommentInCacheKey defines if the comment, of SetComment, is part of the key of the statement cache.
+// By default it is, so the executed statements always have their own comment,
+// but comments varying by request defeat the cache.
+// Excluding it, statements only differing in the comment share the prepared statement,
+// that keeps the comment of when it was prepared.
+func (this *TransactionManager) SetCommentInCacheKey(include bool) *TransactionManager {
+	this.commentInKey = include
+	return this
+}
+
+// SetTxStatementCache defines if the statements prepared in a transaction are shared
+// by the repeated executions of the same SQL in that transaction.
+// They are closed, and discarded, when the transaction commits or rolls back, since they cannot outlive it.
+// It complements the statement cache of the manager.
+func (this *TransactionManager) SetTxStatementCache(enabled bool) *TransactionManager {
+	this.txStmtCache = enabled
+	return this
+}
+
+// SetStatementTimeout limits, server side, the execution time of the statements of every transaction,
+// as IDb.SetStatementTimeout, killing runaway queries even if no context deadline is in place.
+// Beginning a transaction fails if the database has no such limit. Zero means no limit.
+func (this *TransactionManager) SetStatementTimeout(timeout time.Duration) *TransactionManager {
+	if timeout < 0 {
+		panic("A negative statement timeout is not allowed.")
+	}
+	this.statementTimeout = timeout
+	return this
+}
+
+// SetMaxOpenConns sets the maximum number of open connections of the pool. See sql.DB
+func (this *TransactionManager) SetMaxOpenConns(n int) *TransactionManager {
+	this.database.SetMaxOpenConns(n)
+	return this
+}
+
+// SetMaxIdleConns sets the maximum number of idle connections of the pool. See sql.DB
+func (this *TransactionManager) SetMaxIdleConns(n int) *TransactionManager {
+	this.database.SetMaxIdleConns(n)
+	return this
+}
+
+// SetConnMaxLifetime sets the maximum time a connection of the pool may be reused. See sql.DB
+func (this *TransactionManager) SetConnMaxLifetime(d time.Duration) *TransactionManager {
+	this.database.SetConnMaxLifetime(d)
+	return this
+}
+
+// Stats returns the statistics of the connection pool
+func (this *TransactionManager) Stats() sql.DBStats {
+	return this.database.Stats()
+}
+
+// SetAcquireTimeout limits the wait for a connection of the pool when beginning a transaction,
+// with Transaction or TransactionWith, failing fast when the pool is exhausted.
+// The execution of the transaction is not limited.
+// NoTransaction and the statements of Store are not limited, since they take a connection of the pool for each statement.
+// Zero, the default, waits forever.
+func (this *TransactionManager) SetAcquireTimeout(timeout time.Duration) *TransactionManager {
+	this.acquireTimeout = timeout
 	return this
 }
 
+// begins a transaction, with the options, if any, waiting at most the acquire timeout for a connection.
+// The returned function releases the connection after the transaction ends.
+func (this *TransactionManager) begin(opts *sql.TxOptions) (*sql.Tx, func(), error) {
+	if this.acquireTimeout <= 0 {
+		tx, err := this.database.BeginTx(context.Background(), opts)
+		return tx, func() {}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), this.acquireTimeout)
+	defer cancel()
+	conn, err := this.database.Conn(ctx)
+	if err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("goSQL: Unable to acquire a connection in %s: %s", this.acquireTimeout, err))
+	}
+	// the context of the transaction must outlive the acquisition
+	tx, err := conn.BeginTx(context.Background(), opts)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return tx, func() { conn.Close() }, nil
+}
+
+func (this *TransactionManager) newDb(inTx *bool, c dbx.IConnection) IDb {
+	store := this.dbFactory(inTx, c)
+	if len(this.interceptors) > 0 {
+		store.AddInterceptor(this.interceptors...)
+	}
+	if this.logger != nil {
+		store.SetLogger(this.logger)
+	}
+	if this.location != nil {
+		store.SetLocation(this.location)
+	}
+	if this.comment != "" {
+		store.SetComment(this.comment)
+	}
+	return store
+}
+
+func (this *TransactionManager) debugf(format string, args ...interface{}) {
+	if this.logger != nil {
+		if this.logger.IsDebug() {
+			this.logger.Debugf(format, args...)
+		}
+	} else {
+		logger.Debugf(format, args...)
+	}
+}
+
+// creates a IDb outside of a transaction, routing the reads to the replica, if any
+func (this *TransactionManager) noTxDb(inTx *bool, c dbx.IConnection) IDb {
+	store := this.newDb(inTx, c)
+	if this.replica != nil {
+		store.SetReadConnection(this.replica)
+	}
+	return store
+}
+
 func (this *TransactionManager) Transaction(handler func(db IDb) error) error {
-	logger.Debugf("Transaction begin")
-	tx, err := this.database.Begin()
+	return this.TransactionWith(nil, handler)
+}
+
+// TransactionWith runs the handler in a transaction with the options, as with Transaction.
+// The options define the isolation level and if the transaction is read only.
+// A nil options uses the defaults of the driver.
+// The driver returns an error if it does not support the options.
+//
+// ex: TM.TransactionWith(&sql.TxOptions{Isolation: sql.LevelSerializable}, func(store IDb) error { ... })
+func (this *TransactionManager) TransactionWith(opts *sql.TxOptions, handler func(db IDb) error) error {
+	this.debugf("Transaction begin")
+	tx, release, err := this.begin(opts)
 
 	if err != nil {
 		return err
 	}
+	defer release()
 	defer func() {
 		err := recover()
 		if err != nil {
-			logger.Debug("Transaction end in panic: ROLLBACK")
+			this.debugf("Transaction end in panic: ROLLBACK")
 			tx.Rollback()
 			panic(err) // up you go
 		}
@@ -118,27 +413,84 @@ func (this *TransactionManager) Transaction(handler func(db IDb) error) error {
 	var myTx = new(MyTx)
 	myTx.Tx = tx
 	myTx.stmtCache = this.stmtCache
+	myTx.commentInKey = this.commentInKey
+	myTx.depth = 1
+	if this.txStmtCache {
+		myTx.txStmts = newTxStatements()
+	}
 
 	inTx := new(bool)
 	*inTx = true
-	err = handler(this.dbFactory(inTx, myTx))
+	store := this.newDb(inTx, myTx)
+	if this.statementTimeout > 0 {
+		err = store.SetStatementTimeout(this.statementTimeout)
+	}
+	if err == nil {
+		err = handler(store)
+	}
 	*inTx = false
 	if err == nil {
-		logger.Debug("Transaction end: COMMIT")
+		this.debugf("Transaction end: COMMIT")
 		tx.Commit()
 	} else {
-		logger.Debug("Transaction end: ROLLBACK")
+		this.debugf("Transaction end: ROLLBACK")
 		tx.Rollback()
 	}
+	// the statements of the transaction were closed by its end
+	myTx.txStmts = nil
+	return err
+}
+
+// NestedTransaction joins the transaction of the passed IDb, using a savepoint,
+// so that the handler changes can be rolled back independently.
+// The outermost transaction still decides the final commit or rollback.
+// If the passed IDb is not in a transaction, a new transaction is started.
+func (this *TransactionManager) NestedTransaction(store IDb, handler func(db IDb) error) error {
+	outer, ok := store.GetConnection().(*MyTx)
+	if !ok || !store.InTransaction() {
+		return this.Transaction(handler)
+	}
+
+	savepoint := "SP_" + strconv.Itoa(outer.depth)
+	this.debugf("Nested transaction begin: %s", savepoint)
+
+	var myTx = new(MyTx)
+	myTx.Tx = outer.Tx
+	myTx.stmtCache = outer.stmtCache
+	myTx.commentInKey = outer.commentInKey
+	myTx.depth = outer.depth + 1
+	myTx.txStmts = outer.txStmts
+
+	inTx := new(bool)
+	err := outer.inSavepoint(store.GetTranslator(), savepoint, func() error {
+		defer func() {
+			*inTx = false
+			if r := recover(); r != nil {
+				this.debugf("Nested transaction end in panic: ROLLBACK TO %s", savepoint)
+				panic(r) // up you go
+			}
+		}()
+		*inTx = true
+		return handler(this.newDb(inTx, myTx))
+	})
+	if err == nil {
+		this.debugf("Nested transaction end: RELEASE %s", savepoint)
+	} else {
+		this.debugf("Nested transaction end: ROLLBACK TO %s", savepoint)
+	}
 	return err
 }
 
 func (this *TransactionManager) NoTransaction(handler func(db IDb) error) error {
-	logger.Debugf("TransactionLESS Begin")
+	this.debugf("TransactionLESS Begin")
 	defer func() {
 		err := recover()
 		if err != nil {
-			logger.Fatalf("TransactionLESS error: %s\n%s", err, debug.Stack())
+			if this.logger != nil {
+				this.logger.Errorf("TransactionLESS error: %s\n%s", err, debug.Stack())
+			} else {
+				logger.Fatalf("TransactionLESS error: %s\n%s", err, debug.Stack())
+			}
 			panic(err) // up you go
 		}
 	}()
@@ -149,9 +501,9 @@ func (this *TransactionManager) NoTransaction(handler func(db IDb) error) error
 
 	inTx := new(bool)
 	*inTx = true
-	err := handler(this.dbFactory(inTx, myTx))
+	err := handler(this.noTxDb(inTx, myTx))
 	*inTx = false
-	logger.Debugf("TransactionLESS End")
+	this.debugf("TransactionLESS End")
 	return err
 }
 
@@ -163,5 +515,5 @@ func (this TransactionManager) WithoutTransaction(handler func(db IDb) error) er
 */
 
 func (this *TransactionManager) Store() IDb {
-	return this.dbFactory(Bool(false), this.database)
+	return this.noTxDb(Bool(false), this.database)
 }
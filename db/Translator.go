@@ -1,5 +1,11 @@
 package db
 
+import (
+	"time"
+
+	"github.com/quintans/goSQL/dbx"
+)
+
 //import (
 //	tk "github.com/quintans/toolkit"
 //)
@@ -20,17 +26,49 @@ type Translator interface {
 	GetSqlForInsert(insert *Insert) string
 	// QUERY
 	GetSqlForQuery(query *Query) string
+	// the FROM, JOIN and WHERE portion of the query
+	GetSqlForFrom(query *Query) string
+	// CREATE TABLE ... AS SELECT. Panics if not supported
+	GetSqlForCreateTableAs(query *Query, table *Table) string
 	// UPDATE
 	GetSqlForUpdate(update *Update) string
+	// the update returning the columns of the updated rows. An empty string means that the database has no RETURNING
+	GetSqlForUpdateReturning(update *Update, columns []*Column) string
 	// DELTE
 	GetSqlForDelete(del *Delete) string
+	// TRUNCATE. Rendered as a DELETE where the truncate is not available
+	GetSqlForTruncate(truncate *Truncate) string
+	// the trivial query used to check that the database is reachable. ex: SELECT 1
+	GetSqlForPing() string
+	// SAVEPOINT
+	GetSqlForSavepoint(name string) string
+	GetSqlForRollbackTo(name string) string
+	// an empty string means that the database has no release
+	GetSqlForReleaseSavepoint(name string) string
+	// the statement limiting, server side, the execution time of the statements of the ongoing transaction.
+	// An empty string means that the database has no such limit
+	GetSqlForStatementTimeout(timeout time.Duration) string
+	// the statements of a server side cursor for the query. nil if not supported
+	GetSqlForCursor(name string, sql string, fetchSize int) *dbx.Cursor
 	// GetSqlForSequence(sequence *Sequence, nextValue bool) string
 	GetAutoNumberQuery(column *Column) string
 	//	GetMaxTableChars() int
 	PaginateSQL(query *Query, sql string) string
+	// appends the row locking clause. Panics if the lock is not supported.
+	LockSQL(query *Query, sql string) string
 	Translate(dmlType DmlType, token Tokener) string
 	TableName(table *Table) string
+	// the schema name, as it prefixes a table name
+	SchemaName(schema string) string
 	ColumnName(column *Column) string
 	ColumnAlias(token Tokener, position int) string
+	// applies the collation to an order by expression
+	Collate(expression string, collation string) string
 	IgnoreNullKeys() bool
+	// the maximum number of parameters of a statement. Zero means no maximum
+	GetMaxParameters() int
+	// the maximum number of values of an IN list. Zero means no maximum
+	GetMaxInValues() int
+	// how the database folds the column names returned by a query
+	IdentifierCase() dbx.IdentifierCase
 }
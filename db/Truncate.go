@@ -0,0 +1,96 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/quintans/goSQL/dbx"
+	"github.com/quintans/toolkit/log"
+)
+
+// Truncate removes all the rows of a table.
+// It is rendered as TRUNCATE TABLE, ignoring the delete triggers of the table, or,
+// where the database has no truncate or where the truncate would commit the ongoing transaction,
+// as DELETE FROM, that fires them.
+//
+// ex: store.Truncate(BOOK).RestartIdentity().Execute()
+type Truncate struct {
+	db              IDb
+	table           *Table
+	cascade         bool
+	restartIdentity bool
+}
+
+func NewTruncate(db IDb, table *Table) *Truncate {
+	this := new(Truncate)
+	this.db = db
+	this.table = table
+	return this
+}
+
+func (this *Truncate) GetDb() IDb {
+	return this.db
+}
+
+func (this *Truncate) GetTable() *Table {
+	return this.table
+}
+
+// Cascade also truncates the tables referencing this one.
+// The translator panics if the database does not support it.
+func (this *Truncate) Cascade() *Truncate {
+	this.cascade = true
+	return this
+}
+
+func (this *Truncate) IsCascade() bool {
+	return this.cascade
+}
+
+// RestartIdentity resets the identity columns of the table.
+// The translator panics if the database does not support it.
+func (this *Truncate) RestartIdentity() *Truncate {
+	this.restartIdentity = true
+	return this
+}
+
+func (this *Truncate) IsRestartIdentity() bool {
+	return this.restartIdentity
+}
+
+// GetSql returns the SQL for this truncate.
+// An option not supported by the database is returned as an error.
+func (this *Truncate) GetSql() (sql string, err error) {
+	defer recoverSQL(&err)
+	sql = this.db.GetTranslator().GetSqlForTruncate(this)
+	return sql, nil
+}
+
+func (this *Truncate) Execute() error {
+	sql, err := this.GetSql()
+	if err != nil {
+		return err
+	}
+
+	dba := newDba(this.db, this.db.GetConnection())
+	debugf(dba, 1, "\n\t%T SQL: %s", this, sql)
+	now := time.Now()
+	if _, err = dba.Exec(sql); err != nil {
+		return err
+	}
+	debugf(dba, 1, "executed in: %f secs", time.Since(now).Seconds())
+	return nil
+}
+
+// debugf logs to the logger of the dba, or else to the package logger
+func debugf(dba *dbx.SimpleDBA, depth int, format string, args ...interface{}) {
+	if l := dba.GetLogger(); l != nil {
+		if l.IsDebug() {
+			l.Debugf(format, args...)
+		}
+	} else if lgr.IsActive(log.DEBUG) {
+		lgr.CallerAt(depth + 1).Debug(func() string {
+			return fmt.Sprintf(format, args...)
+		})
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"github.com/quintans/goSQL/dbx"
 	coll "github.com/quintans/toolkit/collection"
 
-	"database/sql/driver"
+	"database/sql"
 	"errors"
 	"fmt"
 	"reflect"
@@ -40,6 +40,61 @@ func (this *Update) Set(col *Column, value interface{}) *Update {
 	return this
 }
 
+// SetMap sets each column of the map to its value, as with Set, in the order of the table columns.
+// If a column does not belong to the table an error is returned and no column is set.
+//
+// ex: err := update.SetMap(map[*Column]interface{}{BOOK_C_NAME: "X", BOOK_C_PRICE: 10})
+func (this *Update) SetMap(values map[*Column]interface{}) error {
+	columns := make([]*Column, 0, len(values))
+	for e := this.table.GetColumns().Enumerator(); e.HasNext(); {
+		column := e.Next().(*Column)
+		if _, ok := values[column]; ok {
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) != len(values) {
+		for column := range values {
+			if !column.GetTable().Equals(this.table) {
+				return errors.New(fmt.Sprintf("goSQL: The column %s does not belong to the table %s", column, this.table))
+			}
+		}
+		return errors.New(fmt.Sprintf("goSQL: There are columns that do not belong to the table %s", this.table))
+	}
+	for _, column := range columns {
+		this.Set(column, values[column])
+	}
+	return nil
+}
+
+// SetNamed sets the columns, identified by name or by alias (struct field name), to the values of the map.
+// Useful to apply a patch payload. If there is an unknown name, or a key or version column,
+// an error is returned and no column is set.
+func (this *Update) SetNamed(values map[string]interface{}) error {
+	columns := make(map[*Column]interface{}, len(values))
+	for name, value := range values {
+		column := this.namedColumn(name)
+		if column == nil {
+			return errors.New(fmt.Sprintf("goSQL: There is no column named %s in the table %s", name, this.table))
+		}
+		if column.IsKey() || column.IsVersion() {
+			return errors.New(fmt.Sprintf("goSQL: The key or version column %s cannot be set by name", column))
+		}
+		columns[column] = value
+	}
+	return this.SetMap(columns)
+}
+
+// the column of the table with the alias or the name, nil if there is none
+func (this *Update) namedColumn(name string) *Column {
+	for e := this.table.GetColumns().Enumerator(); e.HasNext(); {
+		column := e.Next().(*Column)
+		if !column.IsVirtual() && (column.GetAlias() == name || column.GetName() == name) {
+			return column
+		}
+	}
+	return nil
+}
+
 func (this *Update) Columns(columns ...*Column) *Update {
 	this.cols = columns
 	return this
@@ -53,6 +108,31 @@ func (this *Update) Values(vals ...interface{}) *Update {
 //Updates all the columns of the table to matching struct fields.
 //Returns the number of affected rows
 func (this *Update) Submit(instance interface{}) (int64, error) {
+	var marks map[string]bool
+	if markable, isMarkable := instance.(Markable); isMarkable {
+		marks = markable.Marks()
+	}
+	return this.submit(instance, marks, true)
+}
+
+// SubmitChanged updates only the columns in the supplied set of changed columns, from the matching struct fields,
+// avoiding the overwrite of the columns changed by others. The keys are used in the where
+// and the version, if any, is still incremented. The marks of a Markable are ignored and kept.
+// Returns the number of affected rows
+func (this *Update) SubmitChanged(instance interface{}, changed ...*Column) (int64, error) {
+	if len(changed) == 0 {
+		return 0, errors.New("goSQL: At least one changed column is required")
+	}
+	marks := make(map[string]bool, len(changed))
+	for _, column := range changed {
+		marks[column.GetAlias()] = true
+	}
+	return this.submit(instance, marks, false)
+}
+
+// updates the columns of the marked fields or, if there is no mark, all the columns.
+// The marks of a Markable are cleared if unmark is set
+func (this *Update) submit(instance interface{}, marks map[string]bool, unmark bool) (int64, error) {
 	var invalid bool
 	typ := reflect.TypeOf(instance)
 	if typ.Kind() == reflect.Ptr {
@@ -90,15 +170,14 @@ func (this *Update) Submit(instance interface{}) (int64, error) {
 		elem = elem.Elem()
 	}
 
-	var marks map[string]bool
 	markable, isMarkable := instance.(Markable)
-	if isMarkable {
-		marks = markable.Marks()
-	}
 	useMarks := len(marks) > 0
 
 	for e := this.table.GetColumns().Enumerator(); e.HasNext(); {
 		column := e.Next().(*Column)
+		if column.IsVirtual() {
+			continue
+		}
 		alias := column.GetAlias()
 		bp := mappings[alias]
 		if bp != nil {
@@ -157,21 +236,30 @@ func (this *Update) Submit(instance interface{}) (int64, error) {
 					}
 
 					if !isNil {
-						v := val.Interface()
-						switch T := v.(type) {
-						case driver.Valuer:
-							value, err := T.Value()
-							if err != nil {
+						value := val.Interface()
+						if valuer := valuerOf(val); valuer != nil {
+							var err error
+							if value, err = valuer.Value(); err != nil {
 								return 0, err
 							}
-							if marked || acceptField(bp.Tag, value) {
-								this.Set(column, value)
-							}
-						default:
-							if marked || acceptField(bp.Tag, v) {
-								this.Set(column, v)
+						}
+						if !marked && !acceptField(bp.Tag, value) {
+							continue
+						}
+						if value != nil && isZero(value) {
+							switch zeroMode(column, bp.Tag) {
+							case ZERO_OMIT:
+								// the current value is kept, unless the field was explicitly marked
+								if !marked {
+									// a reused update may have it from a previous submit
+									this.unset(column)
+									continue
+								}
+							case ZERO_NULL:
+								value = nil
 							}
 						}
+						this.Set(column, value)
 					}
 				}
 			}
@@ -211,31 +299,234 @@ func (this *Update) Submit(instance interface{}) (int64, error) {
 		t.PostUpdate(this.GetDb())
 	}
 
-	if isMarkable {
+	if isMarkable && unmark {
 		markable.Unmark()
 	}
 
 	return affectedRows, nil
 }
 
+// SortBatch makes SubmitBatch update the instances ordered by primary key,
+// so that concurrent transactions acquire the row locks in the same order, avoiding deadlocks.
+func (this *Update) SortBatch(sort bool) *Update {
+	this.sortBatch = sort
+	return this
+}
+
+// SubmitBatch updates, with Submit, each struct pointer of the slice.
+// Returns the total number of affected rows.
+func (this *Update) SubmitBatch(instances interface{}) (int64, error) {
+	return this.submitBatch(instances, this.Submit)
+}
+
+// SubmitChunks updates, with Submit, the struct pointers of the slice in chunks of the given size,
+// reporting the affected rows of each chunk, which chunk failed, if any, and the instances that were not applied.
+// In a transaction, a failed chunk is rolled back as a whole, keeping the previous chunks.
+func (this *Update) SubmitChunks(instances interface{}, size int) (*BatchResult, error) {
+	return this.submitChunks(instances, size, this.Submit)
+}
+
 // returns the number of affected rows
 func (this *Update) Execute() (int64, error) {
+	result, e := this.execute(1)
+	if e != nil {
+		return 0, e
+	}
+	return result.RowsAffected()
+}
+
+// ExecuteResult executes the update returning the driver result.
+// Some drivers also supply the last inserted id.
+func (this *Update) ExecuteResult() (sql.Result, error) {
+	return this.execute(1)
+}
+
+// depth is the number of the calling frames to skip when logging
+func (this *Update) execute(depth int) (sql.Result, error) {
+	this.beforeExecute()
+	return this.run(depth + 1)
+}
+
+// stamps the update time and calls the pre update trigger
+func (this *Update) beforeExecute() {
 	table := this.GetTable()
+	this.stamp(table.GetUpdatedColumn())
 	if table.PreUpdateTrigger != nil {
 		table.PreUpdateTrigger(this)
 	}
+}
 
+func (this *Update) run(depth int) (sql.Result, error) {
 	rsql := this.getCachedSql()
-	this.debugSQL(rsql.OriSql, 1)
+	this.debugSQL(rsql.OriSql, depth+1)
+
+	rsqls, params, e := this.splitValues(rsql, true)
+	if e != nil {
+		return nil, e
+	}
 
 	now := time.Now()
-	affectedRows, e := this.DmlBase.dba.Update(rsql.Sql, rsql.BuildValues(this.DmlBase.parameters)...)
-	this.debugTime(now, 1)
+	results := make(splitResult, 0, len(rsqls))
+	e = this.execParts(len(rsqls), func(dba *dbx.SimpleDBA, k int) error {
+		result, e := dba.Exec(rsqls[k].Sql, params[k]...)
+		if e != nil {
+			return e
+		}
+		results = append(results, result)
+		return nil
+	})
 	if e != nil {
-		return 0, e
+		return nil, e
 	}
+	this.debugTime(now, depth+1)
 
-	return affectedRows, nil
+	if len(results) == 1 {
+		return results[0], nil
+	}
+	return results, nil
+}
+
+// the result of an update split in several statements
+type splitResult []sql.Result
+
+func (this splitResult) LastInsertId() (int64, error) {
+	return this[len(this)-1].LastInsertId()
+}
+
+func (this splitResult) RowsAffected() (int64, error) {
+	var affected int64
+	for _, result := range this {
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		affected += n
+	}
+	return affected, nil
+}
+
+// UpdateAndFetch executes the update and returns the updated rows transformed by the row transformer.
+// The rows have all the, not virtual, columns of the table in the order they were declared.
+// The databases with RETURNING (ex: PostgreSQL) do it in one statement.
+// For the others, the keys of the rows to update are selected, FOR UPDATE, before the update
+// and the rows are selected by those keys after it, so it should be executed in a transaction,
+// and the key columns cannot be set.
+func (this *Update) UpdateAndFetch(rt dbx.IRowTransformer) (coll.Collection, error) {
+	table := this.GetTable()
+	var columns []*Column
+	for it := table.GetColumns().Enumerator(); it.HasNext(); {
+		if column := it.Next().(*Column); !column.IsVirtual() {
+			columns = append(columns, column)
+		}
+	}
+
+	this.beforeExecute()
+	// applies any pending discriminator conditions
+	this.getCachedSql()
+
+	tx := this.db.GetTranslator()
+	if sql := tx.GetSqlForUpdateReturning(this, columns); sql != "" {
+		rsql := ToRawSql(sql, tx)
+		this.debugSQL(rsql.OriSql, 1)
+		rsql, params, e := this.buildValues(rsql)
+		if e != nil {
+			return nil, e
+		}
+		now := time.Now()
+		list, e := this.dba.QueryCollection(rsql.Sql, rt, params...)
+		this.debugTime(now, 1)
+		if e != nil {
+			return nil, e
+		}
+		return list, nil
+	}
+
+	if len(this.joins) > 0 {
+		return nil, errors.New(fmt.Sprintf("goSQL: UpdateAndFetch with joins in the table %s requires a database with RETURNING", table))
+	}
+	keyColumns := make([]*Column, 0)
+	for it := table.GetKeyColumns().Enumerator(); it.HasNext(); {
+		keyColumns = append(keyColumns, it.Next().(*Column))
+	}
+	if len(keyColumns) == 0 {
+		return nil, errors.New(fmt.Sprintf("goSQL: The table %s has no key columns", table))
+	}
+	// the updated rows are selected by the keys they had before the update
+	for _, column := range keyColumns {
+		if _, ok := this.vals.Get(column); ok {
+			return nil, errors.New(fmt.Sprintf("goSQL: UpdateAndFetch cannot set the key column %s without RETURNING", column))
+		}
+	}
+
+	keys, e := this.updatingKeys(keyColumns)
+	if e != nil {
+		return nil, e
+	}
+	if _, e = this.run(1); e != nil {
+		return nil, e
+	}
+	if len(keys) == 0 {
+		list := rt.BeforeAll()
+		rt.AfterAll(list)
+		return list, nil
+	}
+
+	query := this.db.Query(table)
+	for _, column := range columns {
+		query.Column(column)
+	}
+	if len(keyColumns) == 1 {
+		values := make([]interface{}, len(keys))
+		for k, key := range keys {
+			values[k] = key[0]
+		}
+		query.Where(keyColumns[0].In(values...))
+	} else {
+		query.Where(InTuple(keyColumns, keys...))
+	}
+	return query.list(rt)
+}
+
+// selects the keys of the rows matching the update restrictions,
+// locking the rows so that, in a transaction, no other rows match the update before it runs
+func (this *Update) updatingKeys(keyColumns []*Column) ([][]interface{}, error) {
+	query := this.db.Query(this.GetTable()).Alias(this.tableAlias).ForUpdate()
+	for _, column := range keyColumns {
+		query.Column(column)
+	}
+	if this.criteria != nil {
+		query.Where(this.criteria)
+	}
+	params, e := this.convertParameters()
+	if e != nil {
+		return nil, e
+	}
+	for k, v := range params {
+		query.SetParameter(k, v)
+	}
+	rows, e := query.ListOrderedMaps()
+	if e != nil {
+		return nil, e
+	}
+	keys := make([][]interface{}, len(rows))
+	for k, row := range rows {
+		keys[k] = row.Values
+	}
+	return keys, nil
+}
+
+// InterpolatedSQL returns the SQL with the parameters values in place, for logging and debugging.
+// Secret parameters, by SECRET_SUFFIX, by SecretParameters or bound to a Secret column, are masked.
+// It is NOT SAFE to execute the returned SQL.
+func (this *Update) InterpolatedSQL() string {
+	return this.interpolate(this.getCachedSql())
+}
+
+// GetCachedSQL returns the generated SQL, without executing it.
+// Failures generating the SQL are returned as errors.
+func (this *Update) GetCachedSQL() (rsql *RawSql, err error) {
+	defer recoverSQL(&err)
+	return this.getCachedSql(), nil
 }
 
 func (this *Update) getCachedSql() *RawSql {
@@ -264,9 +555,62 @@ func (this *Update) getCachedSql() *RawSql {
 
 //// WHERE ===
 
+// Inner includes the associations as inner joins, so that the SET values and the restrictions
+// can refer the joined tables. The path must be closed with Join.
+// Only some databases support it. ex: Postgres (FROM) and MySQL.
+//
+// ex: store.Update(BOOK).Inner(BOOK_A_PUBLISHER).Join().Set(BOOK_C_NAME, PUBLISHER_C_NAME).Execute()
+func (this *Update) Inner(associations ...*Association) *Update {
+	this.DmlBase.extendPath(INNER_JOIN, associations...)
+	return this
+}
+
+// On is the restriction to apply to the last association. Several calls are ANDed.
+func (this *Update) On(criteria ...*Criteria) *Update {
+	this.DmlBase.on(criteria)
+	return this
+}
+
+// Join closes the current association path.
+// Columns of the joined tables, used afterwards, are resolved to the join alias.
+func (this *Update) Join() *Update {
+	this.DmlBase.joinTo(this.path, joinOptions{})
+	this.path = nil
+	this.rawSQL = nil
+	return this
+}
+
 func (this *Update) Where(restriction ...*Criteria) *Update {
 	if len(restriction) > 0 {
 		this.DmlBase.where(restriction)
 	}
 	return this
 }
+
+// WhereIf ANDs the restrictions with the ones of the previous Where, WhereIf or WhereIfSet, if the condition is true.
+//
+// ex: WhereIf(name != "", BOOK_C_NAME.Like(name))
+func (this *Update) WhereIf(condition bool, restriction ...*Criteria) *Update {
+	if condition {
+		this.DmlBase.andWhere(restriction)
+	}
+	return this
+}
+
+// WhereIfSet ANDs the restrictions with the ones of the previous Where, WhereIf or WhereIfSet,
+// ignoring the restrictions with a nil, empty or zero value.
+// Useful to list all the possible filters of a search, where only the filled ones are applied.
+//
+// ex: WhereIfSet(BOOK_C_NAME.Matches(form.Name), BOOK_C_PRICE.Lesser(form.MaxPrice))
+func (this *Update) WhereIfSet(restriction ...*Criteria) *Update {
+	this.DmlBase.whereIfSet(restriction)
+	return this
+}
+
+// WhereKey restricts to the row with the supplied primary key,
+// matching all the key columns, even if composite.
+// The values are either in the order the key columns were declared, or a single Key.
+func (this *Update) WhereKey(keys ...interface{}) *Update {
+	this.DmlBase.whereKey(keys)
+	return this
+}
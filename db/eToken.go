@@ -19,6 +19,7 @@ var TOKEN_ILTEQ = "ILTEQ"
 var TOKEN_ILIKE = "ILIKE"
 
 var TOKEN_IN = "IN"
+var TOKEN_IN_TUPLE = "IN_TUPLE"
 var TOKEN_RANGE = "RANGE"
 var TOKEN_VALUERANGE = "VALUERANGE"
 var TOKEN_BOUNDEDRANGE = "BOUNDEDRANGE"
@@ -30,19 +31,24 @@ var TOKEN_EXISTS = "EXISTS"
 var TOKEN_NOT = "NOT"
 
 // FUNCTIONS
-var TOKEN_PARAM = "PARAM" // parameter
-var TOKEN_NULL = "NULL"   // sets a predefined value
-var TOKEN_RAW = "RAW"     // sets a predefined value
-var TOKEN_ASIS = "VAL"    // value is injected to the SQL as is.
+var TOKEN_PARAM = "PARAM"     // parameter
+var TOKEN_NULL = "NULL"       // sets a predefined value
+var TOKEN_DEFAULT = "DEFAULT" // the column default
+var TOKEN_RAW = "RAW"         // sets a predefined value
+var TOKEN_ASIS = "VAL"        // value is injected to the SQL as is.
 var TOKEN_ALIAS = "ALIAS"
-var TOKEN_COUNT = "COUNT"               // COUNT(*)
-var TOKEN_COUNT_COLUMN = "COUNT_COLUMN" // COUNT(COLUMN)
+var TOKEN_COUNT = "COUNT"                   // COUNT(*)
+var TOKEN_COUNT_COLUMN = "COUNT_COLUMN"     // COUNT(COLUMN)
+var TOKEN_COUNT_DISTINCT = "COUNT_DISTINCT" // COUNT(DISTINCT COLUMN)
 var TOKEN_SUM = "SUM"
 var TOKEN_MAX = "MAX"
 var TOKEN_MIN = "MIN"
+var TOKEN_STRING_AGG = "STRING_AGG" // STRING_AGG(COLUMN, ',')
+var TOKEN_FILTER = "FILTER"         // aggregate FILTER (WHERE criteria)
 var TOKEN_RTRIM = "RTRIM"
 var TOKEN_UPPER = "UPPER"
 var TOKEN_LOWER = "LOWER"
+var TOKEN_NOW = "NOW" // CURRENT_TIMESTAMP
 
 var TOKEN_MULTIPLY = "MULTIPLY"
 var TOKEN_DIVIDE = "DIVIDE"
@@ -50,8 +56,13 @@ var TOKEN_ADD = "ADD"
 var TOKEN_MINUS = "MINUS"
 
 var TOKEN_SUBQUERY = "SUBQUERY"
+var TOKEN_ANY = "ANY"
+var TOKEN_ALL = "ALL"
+var TOKEN_TUPLE = "TUPLE" // (a, b)
 
 var TOKEN_COALESCE = "COALESCE"
+var TOKEN_GREATEST = "GREATEST"
+var TOKEN_LEAST = "LEAST"
 var TOKEN_CASE = "CASE"
 var TOKEN_CASE_WHEN = "CASE_WHEN"
 var TOKEN_CASE_ELSE = "CASE_ELSE"
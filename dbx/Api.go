@@ -5,6 +5,18 @@ import (
 	coll "github.com/quintans/toolkit/collection"
 )
 
+// StatementKeeper is implemented by the connections that keep the prepared statements open,
+// like a transaction scoped cache, so that they are not closed after each execution.
+type StatementKeeper interface {
+	Keeps(stmt *sql.Stmt) bool
+}
+
+// CommentPreparer is implemented by the connections that cache the prepared statements
+// knowing the comment, of SetComment, that was appended to the SQL.
+type CommentPreparer interface {
+	PrepareCommented(query string, comment string) (*sql.Stmt, error)
+}
+
 type IConnection interface {
 	Exec(query string, args ...interface{}) (sql.Result, error)
 	// The implementor of Prepare should cache the prepared statements
@@ -13,6 +25,19 @@ type IConnection interface {
 	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
+// Interceptor can rewrite the SQL and its parameters just before being executed.
+// ex: add a comment to tag the query or redact parameters.
+type Interceptor func(sql string, params []interface{}) (string, []interface{})
+
+// Logger receives the goSQL log messages, replacing the package logger.
+// Debug messages are only built if IsDebug returns true.
+type Logger interface {
+	IsDebug() bool
+	Debugf(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
 type IRowTransformer interface {
 	// Initializes the collection that will hold the results
 	// return Creates a Collection
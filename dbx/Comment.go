@@ -0,0 +1,18 @@
+package dbx
+
+import "strings"
+
+// appends the comment to the SQL, as a trailing comment. ex: SELECT ... /* app=billing,req=abc123 */
+func appendComment(sql string, comment string) string {
+	if comment == "" {
+		return sql
+	}
+	// the comment must not close before the end
+	return sql + " /* " + strings.Replace(comment, "*/", "* /", -1) + " */"
+}
+
+// StripComment removes the comment, appended by SetComment, from the end of the SQL.
+// Other comments are kept.
+func StripComment(sql string, comment string) string {
+	return strings.TrimSuffix(sql, appendComment("", comment))
+}
@@ -0,0 +1,129 @@
+package dbx
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+)
+
+// Statement is a SQL statement, with its parameters, that would have been executed
+type Statement struct {
+	Sql    string
+	Params []interface{}
+}
+
+// DryRun records the statements instead of executing them.
+// Queries return no rows and updates affect no rows.
+// Since no database is needed, it can be used to snapshot the generated SQL in unit tests.
+//
+// ex:
+//
+//	dryRun := dbx.NewDryRun()
+//	store.SetDryRun(dryRun)
+//	store.Query(BOOK).All().List(&books)
+//	sql := dryRun.Statements()[0].Sql
+type DryRun struct {
+	mu         sync.Mutex
+	statements []Statement
+}
+
+func NewDryRun() *DryRun {
+	return new(DryRun)
+}
+
+// Statements returns the recorded statements, in the order they were issued
+func (this *DryRun) Statements() []Statement {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	statements := make([]Statement, len(this.statements))
+	copy(statements, this.statements)
+	return statements
+}
+
+// Reset discards the recorded statements
+func (this *DryRun) Reset() {
+	this.mu.Lock()
+	this.statements = nil
+	this.mu.Unlock()
+}
+
+func (this *DryRun) add(sql string, params []interface{}) {
+	this.mu.Lock()
+	this.statements = append(this.statements, Statement{sql, params})
+	this.mu.Unlock()
+}
+
+var dryRunOnce sync.Once
+var dryRunDB *sql.DB
+
+// the statements are prepared in a driver that does nothing,
+// so that the callers get real, but empty, results.
+func dryRunConnection() *sql.DB {
+	dryRunOnce.Do(func() {
+		sql.Register("gosql-dryrun", dryRunDriver{})
+		dryRunDB, _ = sql.Open("gosql-dryrun", "")
+	})
+	return dryRunDB
+}
+
+type dryRunDriver struct{}
+
+func (dryRunDriver) Open(name string) (driver.Conn, error) {
+	return dryRunConn{}, nil
+}
+
+type dryRunConn struct{}
+
+func (dryRunConn) Prepare(query string) (driver.Stmt, error) {
+	return dryRunStmt{}, nil
+}
+
+func (dryRunConn) Close() error {
+	return nil
+}
+
+func (dryRunConn) Begin() (driver.Tx, error) {
+	return dryRunConn{}, nil
+}
+
+func (dryRunConn) Commit() error {
+	return nil
+}
+
+func (dryRunConn) Rollback() error {
+	return nil
+}
+
+type dryRunStmt struct{}
+
+func (dryRunStmt) Close() error {
+	return nil
+}
+
+// the number of parameters is not checked
+func (dryRunStmt) NumInput() int {
+	return -1
+}
+
+func (dryRunStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+
+func (dryRunStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return dryRunRows{}, nil
+}
+
+type dryRunRows struct{}
+
+func (dryRunRows) Columns() []string {
+	return nil
+}
+
+func (dryRunRows) Close() error {
+	return nil
+}
+
+func (dryRunRows) Next(dest []driver.Value) error {
+	return io.EOF
+}
@@ -1,12 +1,21 @@
 package dbx
 
-import tk "github.com/quintans/toolkit"
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+
+	tk "github.com/quintans/toolkit"
+)
 
 const FAULT_PREP_STATEMENT = "STMT01"
 const FAULT_EXEC_STATEMENT = "STMT02"
 const FAULT_PARSE_STATEMENT = "STMT03"
 const FAULT_VALUES_STATEMENT = "STMT04"
 const FAULT_QUERY = "QRY01"
+const FAULT_SCAN = "QRY02"
 const FAULT_TRANSFORM = "TRF01"
 const FAULT_OPTIMISTIC_LOCK = "OPT_LOCK"
 
@@ -14,6 +23,19 @@ var _ error = &PersistenceFail{}
 
 type PersistenceFail struct {
 	*tk.Fail
+	// the error of the driver, if any
+	Cause error
+}
+
+// Unwrap returns the error of the driver, so that it can be inspected with errors.As
+func (this *PersistenceFail) Unwrap() error {
+	return this.Cause
+}
+
+// Constraint returns the name of the violated constraint, parsed from the error of the driver.
+// Empty if unknown.
+func (this *PersistenceFail) Constraint() string {
+	return CONSTRAINT_PARSER(this.Cause)
 }
 
 func NewPersistenceFail(code string, message string) *PersistenceFail {
@@ -37,3 +59,201 @@ func NewOptimisticLockFail(message string) *OptimisticLockFail {
 	fail.Fail.Message = message
 	return fail
 }
+
+// ErrorCategory is a database independent classification of an error
+type ErrorCategory int
+
+const (
+	CATEGORY_UNKNOWN ErrorCategory = iota
+	CATEGORY_TIMEOUT
+	CATEGORY_UNIQUE_VIOLATION
+	CATEGORY_FOREIGN_KEY_VIOLATION
+	CATEGORY_NOT_NULL_VIOLATION
+	CATEGORY_DEADLOCK
+)
+
+// ErrorClassifier classifies the error of the driver, cause, raised in the fault code.
+// The cause can be nil.
+type ErrorClassifier func(code string, cause error) ErrorCategory
+
+// ERROR_CLASSIFIER classifies the errors for Classify and the Is... predicates.
+// It can be replaced to recognize other drivers, or wrap the default one.
+var ERROR_CLASSIFIER ErrorClassifier = DefaultErrorClassifier
+
+// Classify returns the category of the error, using ERROR_CLASSIFIER
+func Classify(err error) ErrorCategory {
+	if err == nil {
+		return CATEGORY_UNKNOWN
+	}
+	var fail *PersistenceFail
+	if errors.As(err, &fail) {
+		return ERROR_CLASSIFIER(fail.Code, fail.Cause)
+	}
+	return ERROR_CLASSIFIER("", err)
+}
+
+func IsTimeout(err error) bool {
+	return Classify(err) == CATEGORY_TIMEOUT
+}
+
+func IsUniqueViolation(err error) bool {
+	return Classify(err) == CATEGORY_UNIQUE_VIOLATION
+}
+
+func IsForeignKeyViolation(err error) bool {
+	return Classify(err) == CATEGORY_FOREIGN_KEY_VIOLATION
+}
+
+func IsNotNullViolation(err error) bool {
+	return Classify(err) == CATEGORY_NOT_NULL_VIOLATION
+}
+
+func IsDeadlock(err error) bool {
+	return Classify(err) == CATEGORY_DEADLOCK
+}
+
+// SQLSTATE classes
+var sqlStates = map[string]ErrorCategory{
+	"23505": CATEGORY_UNIQUE_VIOLATION,
+	"23503": CATEGORY_FOREIGN_KEY_VIOLATION,
+	"23502": CATEGORY_NOT_NULL_VIOLATION,
+	"40P01": CATEGORY_DEADLOCK,
+	"57014": CATEGORY_TIMEOUT, // query canceled
+}
+
+// MySQL error numbers
+var mysqlNumbers = map[uint64]ErrorCategory{
+	1062: CATEGORY_UNIQUE_VIOLATION,
+	1451: CATEGORY_FOREIGN_KEY_VIOLATION,
+	1452: CATEGORY_FOREIGN_KEY_VIOLATION,
+	1048: CATEGORY_NOT_NULL_VIOLATION,
+	1364: CATEGORY_NOT_NULL_VIOLATION,
+	1213: CATEGORY_DEADLOCK,
+	1205: CATEGORY_TIMEOUT, // lock wait timeout
+	3024: CATEGORY_TIMEOUT, // max execution time
+}
+
+// Oracle and Firebird messages
+var errorMessages = []struct {
+	text     string
+	category ErrorCategory
+}{
+	{"ORA-00001", CATEGORY_UNIQUE_VIOLATION},
+	{"ORA-02291", CATEGORY_FOREIGN_KEY_VIOLATION},
+	{"ORA-02292", CATEGORY_FOREIGN_KEY_VIOLATION},
+	{"ORA-01400", CATEGORY_NOT_NULL_VIOLATION},
+	{"ORA-00060", CATEGORY_DEADLOCK},
+	{"ORA-01013", CATEGORY_TIMEOUT},
+	{"violation of PRIMARY or UNIQUE KEY constraint", CATEGORY_UNIQUE_VIOLATION},
+	{"violation of FOREIGN KEY constraint", CATEGORY_FOREIGN_KEY_VIOLATION},
+	{"value \"*** null ***\"", CATEGORY_NOT_NULL_VIOLATION},
+	{"deadlock", CATEGORY_DEADLOCK},
+}
+
+// DefaultErrorClassifier recognizes, without depending on the drivers, the SQLSTATE of the Postgres drivers
+// (pq Error.Code or pgx SQLState()), the error number of the MySQL driver (MySQLError.Number),
+// the Oracle and Firebird messages, and the context deadline.
+func DefaultErrorClassifier(code string, cause error) ErrorCategory {
+	if cause == nil {
+		return CATEGORY_UNKNOWN
+	}
+	if errors.Is(cause, context.DeadlineExceeded) {
+		return CATEGORY_TIMEOUT
+	}
+
+	var state interface{ SQLState() string }
+	if errors.As(cause, &state) {
+		return sqlStates[state.SQLState()]
+	}
+
+	// the driver error is inspected by its fields
+	for err := cause; err != nil; err = errors.Unwrap(err) {
+		v := reflect.ValueOf(err)
+		for v.Kind() == reflect.Ptr && !v.IsNil() {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+		if f := v.FieldByName("Code"); f.IsValid() && f.Kind() == reflect.String && len(f.String()) == 5 {
+			return sqlStates[f.String()]
+		}
+		if f := v.FieldByName("Number"); f.IsValid() && f.Kind() >= reflect.Uint && f.Kind() <= reflect.Uint64 {
+			return mysqlNumbers[f.Uint()]
+		}
+	}
+
+	msg := cause.Error()
+	for _, m := range errorMessages {
+		if strings.Contains(msg, m.text) {
+			return m.category
+		}
+	}
+	return CATEGORY_UNKNOWN
+}
+
+// ConstraintParser extracts the name of the violated constraint from the error of the driver, cause.
+// The cause can be nil.
+type ConstraintParser func(cause error) string
+
+// CONSTRAINT_PARSER extracts the constraint names for Constraint and PersistenceFail.Constraint.
+// It can be replaced to recognize other drivers, or wrap the default one.
+var CONSTRAINT_PARSER ConstraintParser = DefaultConstraintParser
+
+// Constraint returns the name of the constraint violated by the error, using CONSTRAINT_PARSER.
+// Empty if unknown.
+func Constraint(err error) string {
+	if err == nil {
+		return ""
+	}
+	var fail *PersistenceFail
+	if errors.As(err, &fail) {
+		return CONSTRAINT_PARSER(fail.Cause)
+	}
+	return CONSTRAINT_PARSER(err)
+}
+
+var constraintMessages = []*regexp.Regexp{
+	// Postgres. ex: duplicate key value violates unique constraint "publisher_pkey"
+	regexp.MustCompile(`violates [a-z -]*constraint "([^"]+)"`),
+	// MySQL. ex: Duplicate entry '1' for key 'publisher.PRIMARY'
+	regexp.MustCompile(`Duplicate entry '.*' for key '(?:[^'.]+\.)?([^'.]+)'`),
+	// MySQL. ex: a foreign key constraint fails (`db`.`book`, CONSTRAINT `FK_BOOK_PUBLISHER` FOREIGN KEY ...
+	regexp.MustCompile("CONSTRAINT `([^`]+)`"),
+	// Oracle. ex: ORA-00001: unique constraint (SCHEMA.PK_PUBLISHER) violated
+	regexp.MustCompile(`ORA-\d+: [a-z ]*constraint \((?:[^.)]+\.)?([^)]+)\)`),
+	// Firebird. ex: violation of PRIMARY or UNIQUE KEY constraint "INTEG_5" on table "PUBLISHER"
+	regexp.MustCompile(`violation of [A-Za-z ]+ constraint "([^"]+)"`),
+}
+
+// DefaultConstraintParser recognizes, without depending on the drivers, the constraint fields of the Postgres drivers
+// (pq Error.Constraint or pgx PgError.ConstraintName) and the messages of Postgres, MySQL, Oracle and Firebird.
+func DefaultConstraintParser(cause error) string {
+	if cause == nil {
+		return ""
+	}
+
+	// the driver error is inspected by its fields
+	for err := cause; err != nil; err = errors.Unwrap(err) {
+		v := reflect.ValueOf(err)
+		for v.Kind() == reflect.Ptr && !v.IsNil() {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+		for _, name := range []string{"Constraint", "ConstraintName"} {
+			if f := v.FieldByName(name); f.IsValid() && f.Kind() == reflect.String && f.String() != "" {
+				return f.String()
+			}
+		}
+	}
+
+	msg := cause.Error()
+	for _, re := range constraintMessages {
+		if m := re.FindStringSubmatch(msg); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
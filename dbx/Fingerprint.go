@@ -0,0 +1,174 @@
+package dbx
+
+import (
+	"regexp"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+var fingerprintLists = regexp.MustCompile(`\?( ?, ?\?)+`)
+
+// Fingerprint returns the structure of the SQL, replacing the literals and the placeholders by ?
+// and collapsing lists of them into a single ?.
+// Statements that only differ in their values have the same fingerprint.
+//
+// ex: SELECT * FROM BOOK WHERE ID IN ($1, $2) AND NAME = 'X' -> SELECT * FROM BOOK WHERE ID IN (?) AND NAME = ?
+func Fingerprint(sql string) string {
+	out := make([]byte, 0, len(sql))
+	space := false
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			space = len(out) > 0
+			continue
+		}
+		if space {
+			out = append(out, ' ')
+			space = false
+		}
+
+		switch {
+		case c == '\'':
+			// string literal. A quote is escaped by doubling it
+			for i++; i < len(sql); i++ {
+				if sql[i] == '\'' {
+					if i+1 < len(sql) && sql[i+1] == '\'' {
+						i++
+					} else {
+						break
+					}
+				}
+			}
+			out = append(out, '?')
+		case c == '"' || c == '`':
+			// quoted identifier
+			j := i + 1
+			for j < len(sql) && sql[j] != c {
+				j++
+			}
+			if j == len(sql) {
+				j--
+			}
+			out = append(out, sql[i:j+1]...)
+			i = j
+		case isDigit(c) && !endsWithIdentifier(out):
+			for i+1 < len(sql) && (isDigit(sql[i+1]) || sql[i+1] == '.') {
+				i++
+			}
+			out = append(out, '?')
+		case (c == '$' || c == ':' || c == '@') && i+1 < len(sql) && isIdentifier(sql[i+1]) &&
+			(len(out) == 0 || out[len(out)-1] != ':'):
+			// numbered or named placeholder. ex: $1, :name, @p1
+			for i+1 < len(sql) && isIdentifier(sql[i+1]) {
+				i++
+			}
+			out = append(out, '?')
+		default:
+			out = append(out, c)
+		}
+	}
+	return fingerprintLists.ReplaceAllString(string(out), "?")
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentifier(c byte) bool {
+	return c == '_' || isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func endsWithIdentifier(out []byte) bool {
+	return len(out) > 0 && isIdentifier(out[len(out)-1])
+}
+
+type repetition struct {
+	since  time.Time
+	count  int
+	warned bool
+}
+
+// NPlusOneDetector warns, with a stack trace, when structurally identical queries
+// are executed repeatedly within a short time window, which usually means
+// that an association is being fetched with one query per parent.
+// It is a diagnostic tool, meant for development.
+//
+// ex: TM.AddInterceptor(dbx.NewNPlusOneDetector(5, time.Second).Interceptor())
+type NPlusOneDetector struct {
+	threshold int
+	window    time.Duration
+	logger    Logger
+	mu        sync.Mutex
+	seen      map[string]*repetition
+}
+
+// NewNPlusOneDetector creates a detector that warns when the same query
+// is executed threshold times within window.
+func NewNPlusOneDetector(threshold int, window time.Duration) *NPlusOneDetector {
+	if threshold < 2 {
+		panic("The threshold for the N+1 detection must be at least 2")
+	}
+	this := new(NPlusOneDetector)
+	this.threshold = threshold
+	this.window = window
+	this.seen = make(map[string]*repetition)
+	return this
+}
+
+// SetLogger defines the logger for the warnings. If nil, the package logger is used.
+func (this *NPlusOneDetector) SetLogger(logger Logger) *NPlusOneDetector {
+	this.logger = logger
+	return this
+}
+
+// Interceptor returns the interceptor that feeds this detector. The SQL is not changed.
+func (this *NPlusOneDetector) Interceptor() Interceptor {
+	return func(sql string, params []interface{}) (string, []interface{}) {
+		this.Check(sql)
+		return sql, params
+	}
+}
+
+// Check registers the execution of the SQL, warning if the threshold is reached.
+// It returns true if a warning was issued.
+func (this *NPlusOneDetector) Check(sql string) bool {
+	fingerprint := Fingerprint(sql)
+	now := time.Now()
+
+	this.mu.Lock()
+	r := this.seen[fingerprint]
+	if r == nil || now.Sub(r.since) > this.window {
+		if r == nil && len(this.seen) > 1000 {
+			this.prune(now)
+		}
+		r = &repetition{since: now}
+		this.seen[fingerprint] = r
+	}
+	r.count++
+	warn := r.count >= this.threshold && !r.warned
+	if warn {
+		r.warned = true
+	}
+	count := r.count
+	this.mu.Unlock()
+
+	if warn {
+		format := "Possible N+1 query: executed %d times in %s\n\t%s\n%s"
+		if this.logger != nil {
+			this.logger.Warnf(format, count, this.window, fingerprint, debug.Stack())
+		} else {
+			logger.Warnf(format, count, this.window, fingerprint, debug.Stack())
+		}
+	}
+	return warn
+}
+
+// removes the expired entries
+func (this *NPlusOneDetector) prune(now time.Time) {
+	for k, v := range this.seen {
+		if now.Sub(v.since) > this.window {
+			delete(this.seen, k)
+		}
+	}
+}
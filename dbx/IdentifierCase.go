@@ -0,0 +1,28 @@
+package dbx
+
+import "strings"
+
+// IdentifierCase is how a database folds the identifiers, like the column names returned by a query.
+type IdentifierCase int
+
+const (
+	CASE_PRESERVE IdentifierCase = iota
+	CASE_LOWER
+	CASE_UPPER
+)
+
+// Fold applies the case folding to the name
+func (this IdentifierCase) Fold(name string) string {
+	switch this {
+	case CASE_LOWER:
+		return strings.ToLower(name)
+	case CASE_UPPER:
+		return strings.ToUpper(name)
+	}
+	return name
+}
+
+// Equal compares a name returned by the database with a declared name, after folding the declared one.
+func (this IdentifierCase) Equal(returned string, declared string) bool {
+	return returned == this.Fold(declared)
+}
@@ -0,0 +1,285 @@
+package dbx
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	coll "github.com/quintans/toolkit/collection"
+)
+
+var _ IRowTransformer = &MapTransformer{}
+
+// MapTransformer transforms each row into a map[string]interface{},
+// keyed by the column names returned by the driver,
+// or, if ordered, into an *OrderedRow, keeping the select order.
+// Byte values of character columns are converted to string.
+type MapTransformer struct {
+	keys     []string
+	declared []string
+	folding  IdentifierCase
+	ordered  bool
+	columns  []string
+	types    []*sql.ColumnType
+}
+
+// OrderedRow holds the values of a row in the select order.
+type OrderedRow struct {
+	// the column names, shared by all the rows of the result
+	Columns []string
+	Values  []interface{}
+}
+
+// Get returns the value of the column
+func (this *OrderedRow) Get(column string) (interface{}, bool) {
+	for k, c := range this.Columns {
+		if c == column {
+			return this.Values[k], true
+		}
+	}
+	return nil, false
+}
+
+// Map converts the row into a map, losing the order
+func (this *OrderedRow) Map() map[string]interface{} {
+	m := make(map[string]interface{}, len(this.Values))
+	for k, v := range this.Values {
+		m[this.Columns[k]] = v
+	}
+	return m
+}
+
+func NewMapTransformer() *MapTransformer {
+	return new(MapTransformer)
+}
+
+// Keys overrides the driver column names, by position, as the map keys.
+func (this *MapTransformer) Keys(keys ...string) *MapTransformer {
+	this.keys = keys
+	return this
+}
+
+// Declared uses the declared names as the map keys, instead of the driver column names,
+// matching them after the case folding of the database. ex: PRICE or price is returned as Price.
+func (this *MapTransformer) Declared(folding IdentifierCase, names ...string) *MapTransformer {
+	this.folding = folding
+	this.declared = names
+	return this
+}
+
+// Ordered makes each row an *OrderedRow, with the columns in the select order, instead of a map.
+// Useful when the order matters, like in a CSV export.
+func (this *MapTransformer) Ordered(ordered bool) *MapTransformer {
+	this.ordered = ordered
+	return this
+}
+
+func (this *MapTransformer) BeforeAll() coll.Collection {
+	this.columns = nil
+	this.types = nil
+	return coll.NewArrayList()
+}
+
+func (this *MapTransformer) Transform(rows *sql.Rows) (interface{}, error) {
+	values, err := this.scan(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if this.ordered {
+		return &OrderedRow{this.columns, values}, nil
+	}
+	m := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		m[this.columns[k]] = v
+	}
+	return m, nil
+}
+
+func (this *MapTransformer) OnTransformation(result coll.Collection, instance interface{}) {
+	if instance != nil {
+		result.Add(instance)
+	}
+}
+
+func (this *MapTransformer) AfterAll(result coll.Collection) {
+}
+
+// scan reads the current row, returning the column values in the select order.
+func (this *MapTransformer) scan(rows *sql.Rows) ([]interface{}, error) {
+	if this.columns == nil {
+		var err error
+		if this.columns, err = rows.Columns(); err != nil {
+			return nil, err
+		}
+		for k, column := range this.columns {
+			if k < len(this.keys) && this.keys[k] != "" {
+				this.columns[k] = this.keys[k]
+				continue
+			}
+			for _, name := range this.declared {
+				if this.folding.Equal(column, name) {
+					this.columns[k] = name
+					break
+				}
+			}
+		}
+		// not all drivers supply column types
+		this.types, _ = rows.ColumnTypes()
+	}
+
+	values := make([]interface{}, len(this.columns))
+	holders := make([]interface{}, len(this.columns))
+	for k := range values {
+		holders[k] = &values[k]
+	}
+	if err := rows.Scan(holders...); err != nil {
+		return nil, err
+	}
+
+	for k, v := range values {
+		if b, ok := v.([]byte); ok {
+			switch this.kindOf(k) {
+			case kindText, kindNumber:
+				values[k] = string(b)
+			default:
+				// the driver may reuse the buffer
+				values[k] = append([]byte(nil), b...)
+			}
+		}
+	}
+	return values, nil
+}
+
+const (
+	kindBinary = iota
+	kindText
+	kindNumber
+)
+
+// kindOf uses the column metadata to decide how to represent a byte value.
+// Without metadata, bytes are assumed to be text.
+func (this *MapTransformer) kindOf(column int) int {
+	if column >= len(this.types) || this.types[column] == nil {
+		return kindText
+	}
+	name := strings.ToUpper(this.types[column].DatabaseTypeName())
+	switch {
+	case name == "":
+		return kindText
+	case strings.Contains(name, "BLOB"),
+		strings.Contains(name, "BINARY"),
+		strings.Contains(name, "BYTEA"),
+		strings.Contains(name, "RAW"):
+		return kindBinary
+	case strings.Contains(name, "NUMERIC"),
+		strings.Contains(name, "DECIMAL"),
+		strings.Contains(name, "NUMBER"):
+		return kindNumber
+	}
+	return kindText
+}
+
+// writeJSON writes the current values as a JSON object, keeping the column order.
+func (this *MapTransformer) writeJSON(w io.Writer, values []interface{}) error {
+	buf := new(bytes.Buffer)
+	buf.WriteByte('{')
+	for k, v := range values {
+		if k > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(this.columns[k])
+		buf.Write(key)
+		buf.WriteByte(':')
+
+		var b []byte
+		var err error
+		switch t := v.(type) {
+		case time.Time:
+			b, err = json.Marshal(t.Format(time.RFC3339Nano))
+		case string:
+			if this.kindOf(k) == kindNumber && isJSONNumber(t) {
+				b = []byte(t)
+			} else {
+				// ex: NaN or a locale formatted number are not valid JSON numbers
+				b, err = json.Marshal(t)
+			}
+		case float64:
+			b, err = marshalFloat(t, 64)
+		case float32:
+			b, err = marshalFloat(float64(t), 32)
+		default:
+			// []byte is encoded as base64
+			b, err = json.Marshal(t)
+		}
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+	buf.WriteByte('}')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func isJSONNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	_, err := json.Marshal(json.Number(s))
+	return err == nil
+}
+
+// NaN and Inf have no JSON representation, so they are written as strings
+func marshalFloat(f float64, bitSize int) ([]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return json.Marshal(strconv.FormatFloat(f, 'g', -1, bitSize))
+	}
+	return json.Marshal(f)
+}
+
+// CSVOptions defines how QueryCSV writes the values.
+type CSVOptions struct {
+	// field delimiter. If zero, a comma is used
+	Comma rune
+	// layout of the time values. If empty, time.RFC3339 is used
+	TimeLayout string
+	// written for NULL values
+	Null string
+}
+
+// csvRecord formats the current values as CSV fields.
+// Binary values are encoded in base64.
+func (this *MapTransformer) csvRecord(values []interface{}, opts CSVOptions) []string {
+	record := make([]string, len(values))
+	for k, v := range values {
+		switch t := v.(type) {
+		case nil:
+			record[k] = opts.Null
+		case string:
+			record[k] = t
+		case []byte:
+			record[k] = base64.StdEncoding.EncodeToString(t)
+		case time.Time:
+			layout := opts.TimeLayout
+			if layout == "" {
+				layout = time.RFC3339
+			}
+			record[k] = t.Format(layout)
+		case float32:
+			record[k] = strconv.FormatFloat(float64(t), 'f', -1, 32)
+		case float64:
+			record[k] = strconv.FormatFloat(t, 'f', -1, 64)
+		default:
+			record[k] = fmt.Sprint(t)
+		}
+	}
+	return record
+}
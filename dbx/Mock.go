@@ -0,0 +1,322 @@
+package dbx
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var _ IConnection = &MockConnection{}
+
+// MockConnection is an IConnection, for unit tests, that answers the statements with scripted results,
+// so that SimpleDBA, and the builders using it, can be tested without a database.
+// The statements must be executed in the order they were expected.
+//
+// ex:
+//
+//	mock := dbx.NewMockConnection()
+//	mock.Expect("SELECT NAME FROM BOOK WHERE ID = ?").
+//		WithParams(1).
+//		WillReturnRows(dbx.NewRowSet("NAME").AddRow("Cookbook"))
+//	dba := dbx.NewSimpleDBA(mock)
+//	...
+//	if err := mock.Verify(); err != nil {
+//		t.Fatal(err)
+//	}
+type MockConnection struct {
+	*sql.DB
+	// the data source name of the mock driver
+	name         string
+	mu           sync.Mutex
+	expectations []*Expectation
+	// the index of the next expectation
+	next  int
+	calls []Statement
+}
+
+// Expectation is a statement expected by a MockConnection and its scripted answer
+type Expectation struct {
+	sql          string
+	params       []interface{}
+	checkParams  bool
+	rows         *RowSet
+	lastInsertId int64
+	rowsAffected int64
+	err          error
+}
+
+// WithParams defines the expected parameters. If not called, any parameters are accepted.
+func (this *Expectation) WithParams(params ...interface{}) *Expectation {
+	this.params = params
+	this.checkParams = true
+	return this
+}
+
+// WillReturnRows defines the rows returned by a query
+func (this *Expectation) WillReturnRows(rows *RowSet) *Expectation {
+	this.rows = rows
+	return this
+}
+
+// WillReturnResult defines the result of an insert, update or delete
+func (this *Expectation) WillReturnResult(lastInsertId int64, rowsAffected int64) *Expectation {
+	this.lastInsertId = lastInsertId
+	this.rowsAffected = rowsAffected
+	return this
+}
+
+// WillReturnError makes the execution of the statement fail with the error
+func (this *Expectation) WillReturnError(err error) *Expectation {
+	this.err = err
+	return this
+}
+
+// RowSet holds the columns and the rows returned by a mocked query
+type RowSet struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+// NewRowSet creates an empty row set with the columns
+func NewRowSet(columns ...string) *RowSet {
+	this := new(RowSet)
+	this.columns = columns
+	return this
+}
+
+// AddRow adds a row with the values in the order of the columns.
+// Panics if the number of values is different from the number of columns
+// or if a value is not supported by the database/sql drivers.
+func (this *RowSet) AddRow(values ...interface{}) *RowSet {
+	if len(values) != len(this.columns) {
+		panic(fmt.Sprintf("Expected %v values for the row but got %v", len(this.columns), len(values)))
+	}
+	row := make([]driver.Value, len(values))
+	for k, v := range values {
+		value, err := driver.DefaultParameterConverter.ConvertValue(v)
+		if err != nil {
+			panic(fmt.Sprintf("Invalid value for the column %s: %s", this.columns[k], err))
+		}
+		row[k] = value
+	}
+	this.rows = append(this.rows, row)
+	return this
+}
+
+var mockOnce sync.Once
+var mockMu sync.Mutex
+var mockId int
+var mocks = make(map[string]*MockConnection)
+
+// NewMockConnection creates a connection without expectations
+func NewMockConnection() *MockConnection {
+	mockOnce.Do(func() {
+		sql.Register("gosql-mock", mockDriver{})
+	})
+	this := new(MockConnection)
+
+	mockMu.Lock()
+	mockId++
+	name := strconv.Itoa(mockId)
+	mocks[name] = this
+	mockMu.Unlock()
+
+	this.name = name
+	this.DB, _ = sql.Open("gosql-mock", name)
+	return this
+}
+
+// Close closes the connection and releases it from the mock driver
+func (this *MockConnection) Close() error {
+	mockMu.Lock()
+	delete(mocks, this.name)
+	mockMu.Unlock()
+	return this.DB.Close()
+}
+
+// Expect adds the next expected statement. The SQL is compared ignoring repeated white spaces.
+func (this *MockConnection) Expect(sql string) *Expectation {
+	e := new(Expectation)
+	e.sql = sql
+	this.mu.Lock()
+	this.expectations = append(this.expectations, e)
+	this.mu.Unlock()
+	return e
+}
+
+// Calls returns the executed statements, in the order they were executed
+func (this *MockConnection) Calls() []Statement {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	calls := make([]Statement, len(this.calls))
+	copy(calls, this.calls)
+	return calls
+}
+
+// Verify returns an error if some expected statements were not executed
+func (this *MockConnection) Verify() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.next < len(this.expectations) {
+		return fmt.Errorf("goSQL: %v expected statements were not executed. The next was: %s",
+			len(this.expectations)-this.next, this.expectations[this.next].sql)
+	}
+	return nil
+}
+
+// matches the statement with the next expectation
+func (this *MockConnection) answer(query string, args []driver.Value) (*Expectation, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	params := make([]interface{}, len(args))
+	for k, v := range args {
+		params[k] = v
+	}
+	this.calls = append(this.calls, Statement{query, params})
+
+	if this.next >= len(this.expectations) {
+		return nil, fmt.Errorf("goSQL: Unexpected statement: %s", query)
+	}
+	e := this.expectations[this.next]
+	if normalizeSpaces(e.sql) != normalizeSpaces(query) {
+		return nil, fmt.Errorf("goSQL: Expected the statement %s but got %s", e.sql, query)
+	}
+	if e.checkParams {
+		if err := matchParams(e.params, args); err != nil {
+			return nil, fmt.Errorf("goSQL: %s, for the statement %s", err, query)
+		}
+	}
+	this.next++
+	return e, e.err
+}
+
+func normalizeSpaces(sql string) string {
+	return strings.Join(strings.Fields(sql), " ")
+}
+
+func matchParams(expected []interface{}, args []driver.Value) error {
+	if len(expected) != len(args) {
+		return fmt.Errorf("Expected %v parameters but got %v", len(expected), len(args))
+	}
+	for k, e := range expected {
+		value, err := driver.DefaultParameterConverter.ConvertValue(e)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(value, args[k]) {
+			return fmt.Errorf("Expected the parameter %v to be %v but got %v", k+1, value, args[k])
+		}
+	}
+	return nil
+}
+
+type mockDriver struct{}
+
+func (mockDriver) Open(name string) (driver.Conn, error) {
+	mockMu.Lock()
+	defer mockMu.Unlock()
+	mock := mocks[name]
+	if mock == nil {
+		return nil, fmt.Errorf("goSQL: No mock connection %s", name)
+	}
+	return mockConn{mock}, nil
+}
+
+type mockConn struct {
+	mock *MockConnection
+}
+
+func (this mockConn) Prepare(query string) (driver.Stmt, error) {
+	return mockStmt{this.mock, query}, nil
+}
+
+func (mockConn) Close() error {
+	return nil
+}
+
+func (this mockConn) Begin() (driver.Tx, error) {
+	return this, nil
+}
+
+func (mockConn) Commit() error {
+	return nil
+}
+
+func (mockConn) Rollback() error {
+	return nil
+}
+
+type mockStmt struct {
+	mock  *MockConnection
+	query string
+}
+
+func (mockStmt) Close() error {
+	return nil
+}
+
+// the number of parameters is not checked
+func (mockStmt) NumInput() int {
+	return -1
+}
+
+func (this mockStmt) Exec(args []driver.Value) (driver.Result, error) {
+	e, err := this.mock.answer(this.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return mockResult{e.lastInsertId, e.rowsAffected}, nil
+}
+
+func (this mockStmt) Query(args []driver.Value) (driver.Rows, error) {
+	e, err := this.mock.answer(this.query, args)
+	if err != nil {
+		return nil, err
+	}
+	if e.rows == nil {
+		return &mockRows{set: NewRowSet()}, nil
+	}
+	return &mockRows{set: e.rows}, nil
+}
+
+type mockResult struct {
+	lastInsertId int64
+	rowsAffected int64
+}
+
+func (this mockResult) LastInsertId() (int64, error) {
+	return this.lastInsertId, nil
+}
+
+func (this mockResult) RowsAffected() (int64, error) {
+	return this.rowsAffected, nil
+}
+
+type mockRows struct {
+	set *RowSet
+	// the index of the next row
+	next int
+}
+
+func (this *mockRows) Columns() []string {
+	return this.set.columns
+}
+
+func (this *mockRows) Close() error {
+	return nil
+}
+
+func (this *mockRows) Next(dest []driver.Value) error {
+	if this.next >= len(this.set.rows) {
+		return io.EOF
+	}
+	copy(dest, this.set.rows[this.next])
+	this.next++
+	return nil
+}
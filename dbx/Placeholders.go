@@ -0,0 +1,74 @@
+package dbx
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// CHECK_PLACEHOLDERS enables, for debugging, the validation of the number of parameters
+// against the placeholders of the SQL, before executing it,
+// returning a clear error instead of the error of the driver.
+var CHECK_PLACEHOLDERS = false
+
+// CountPlaceholders counts the parameters expected by the placeholders of the SQL,
+// ignoring the literals, the quoted identifiers and the comments.
+// Each ? expects a parameter, numbered placeholders, like $1 or :1, expect as many parameters as the highest number,
+// and named placeholders, like :name, expect a parameter by distinct name.
+func CountPlaceholders(sql string) int {
+	count := 0
+	highest := 0
+	names := make(map[string]bool)
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// literal or quoted identifier. A quote is escaped by doubling it
+			for i++; i < len(sql); i++ {
+				if sql[i] == c {
+					if i+1 < len(sql) && sql[i+1] == c {
+						i++
+					} else {
+						break
+					}
+				}
+			}
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			for i += 2; i < len(sql) && !(sql[i] == '/' && sql[i-1] == '*'); i++ {
+			}
+		case c == '?':
+			count++
+		case c == ':' && i+1 < len(sql) && sql[i+1] == ':':
+			// cast. ex: ::int
+			i++
+		case (c == '$' && i+1 < len(sql) && isDigit(sql[i+1]) || c == ':' && i+1 < len(sql) && isIdentifier(sql[i+1])) &&
+			(i == 0 || !isIdentifier(sql[i-1])):
+			// not part of an identifier. ex: RDB$DATABASE
+			j := i + 1
+			for j < len(sql) && isIdentifier(sql[j]) {
+				j++
+			}
+			name := sql[i+1 : j]
+			if n, err := strconv.Atoi(name); err == nil {
+				if n > highest {
+					highest = n
+				}
+			} else {
+				names[name] = true
+			}
+			i = j - 1
+		}
+	}
+	return count + highest + len(names)
+}
+
+func checkPlaceholders(sql string, params []interface{}) error {
+	if expected := CountPlaceholders(sql); expected != len(params) {
+		cause := fmt.Errorf("goSQL: The SQL has placeholders for %v parameters, but %v were supplied", expected, len(params))
+		return rethrow(FAULT_VALUES_STATEMENT, cause, sql, params...)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package dbx
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	tk "github.com/quintans/toolkit"
+)
+
+type RawSql struct {
+	// original sql
+	OriSql string
+	// the converted SQL with the Database specific placeholders
+	Sql string
+	// the parameters values
+	Names []string
+	// start and end positions of each named parameter in OriSql
+	Indexes [][]int
+	// renders the Database specific placeholder
+	Placeholder func(index int, name string) string
+}
+
+// Expand rewrites the named parameters bound to a slice into a list of parameters,
+// one for each element, in the list of a IN clause.
+// An empty slice is rendered as NULL.
+// A slice parameter anywhere else, ex: in a SET clause, is an error, since it would render invalid SQL.
+// If there are no slice parameters, the same RawSql and parameters are returned.
+func (this *RawSql) Expand(paramMap map[string]interface{}) (*RawSql, map[string]interface{}, error) {
+	if this.Placeholder == nil || len(this.Indexes) != len(this.Names) {
+		return this, paramMap, nil
+	}
+
+	paramMap = ResolveParameters(paramMap)
+	expand := false
+	for _, name := range this.Names {
+		if isExpandable(paramMap[name]) {
+			expand = true
+			break
+		}
+	}
+	if !expand {
+		return this, paramMap, nil
+	}
+
+	other := new(RawSql)
+	other.Placeholder = this.Placeholder
+	params := make(map[string]interface{}, len(paramMap))
+	for k, v := range paramMap {
+		params[k] = v
+	}
+
+	oriSql := tk.NewStrBuffer()
+	sql := tk.NewStrBuffer()
+	last := 0
+	for i, name := range this.Names {
+		idx := this.Indexes[i]
+		oriSql.Add(this.OriSql[last:idx[0]])
+		sql.Add(this.OriSql[last:idx[0]])
+		last = idx[1]
+
+		value := paramMap[name]
+		if !isExpandable(value) {
+			oriSql.Add(this.OriSql[idx[0]:idx[1]])
+			sql.Add(other.add(name))
+			continue
+		}
+
+		if !inList(this.OriSql, idx[0]) {
+			return nil, nil, fmt.Errorf("goSQL: The slice parameter '%s' is only supported in the list of a IN. SQL: %s", name, this.OriSql)
+		}
+		slice := reflect.ValueOf(value)
+		if slice.Len() == 0 {
+			oriSql.Add("NULL")
+			sql.Add("NULL")
+			continue
+		}
+		for k := 0; k < slice.Len(); k++ {
+			if k > 0 {
+				oriSql.Add(", ")
+				sql.Add(", ")
+			}
+			item := name + "_" + strconv.Itoa(k)
+			params[item] = slice.Index(k).Interface()
+			oriSql.Add(":", item)
+			sql.Add(other.add(item))
+		}
+	}
+	oriSql.Add(this.OriSql[last:])
+	sql.Add(this.OriSql[last:])
+
+	other.OriSql = oriSql.String()
+	other.Sql = sql.String()
+	return other, params, nil
+}
+
+// inList checks if the position is inside the parenthesis of a IN list, ex: IN (:a, :ids)
+func inList(sql string, pos int) bool {
+	i := pos - 1
+	for ; i >= 0 && sql[i] != '('; i-- {
+		// a nested expression or a subquery
+		if sql[i] == ')' {
+			return false
+		}
+	}
+	if i < 0 || strings.Contains(strings.ToUpper(sql[i:pos]), "SELECT") {
+		return false
+	}
+	before := strings.ToUpper(strings.TrimRight(sql[:i], " \t\r\n"))
+	return strings.HasSuffix(before, "IN") &&
+		(len(before) == 2 || !isIdentifier(before[len(before)-3]))
+}
+
+// adds a parameter name and returns its placeholder
+func (this *RawSql) add(name string) string {
+	this.Names = append(this.Names, name)
+	return this.Placeholder(len(this.Names)-1, name)
+}
+
+// slices, except []byte and driver values (ex: pq.Array), are expanded
+func isExpandable(value interface{}) bool {
+	if value == nil {
+		return false
+	}
+	if _, ok := value.(driver.Valuer); ok {
+		return false
+	}
+	if _, ok := value.([]byte); ok {
+		return false
+	}
+	k := reflect.TypeOf(value).Kind()
+	return k == reflect.Slice || k == reflect.Array
+}
+
+// Convert a Map of named parameter values to a corresponding array.
+// Deferred values are evaluated.
+//
+// return the array of values
+func (this *RawSql) BuildValues(paramMap map[string]interface{}) []interface{} {
+	paramArray := make([]interface{}, len(this.Names))
+	for i, name := range this.Names {
+		v, ok := paramMap[name]
+		if !ok {
+			panic(fmt.Sprintf("[%s] No value supplied for the SQL parameter '%s' for the SQL %s",
+				FAULT_VALUES_STATEMENT, name, this.OriSql))
+		}
+		paramArray[i] = resolveValue(v)
+	}
+	return paramArray
+}
+
+// Convert a Map of named parameter values to a corresponding array.
+// Deferred values are evaluated.
+// Instead of panicking, it returns an error listing all the parameters without value.
+//
+// return the array of values
+func (this *RawSql) BuildValuesSafe(paramMap map[string]interface{}) ([]interface{}, error) {
+	paramArray := make([]interface{}, len(this.Names))
+	var missing []string
+	for i, name := range this.Names {
+		v, ok := paramMap[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		paramArray[i] = resolveValue(v)
+	}
+	if len(missing) > 0 {
+		return nil, NewPersistenceFail(FAULT_VALUES_STATEMENT,
+			fmt.Sprintf("No value supplied for the SQL parameters '%s' for the SQL %s",
+				strings.Join(missing, "', '"), this.OriSql))
+	}
+	return paramArray, nil
+}
+
+// ResolveParameters returns the parameters with the deferred values evaluated.
+// A deferred value is a func() interface{}, called only when the statement is executed,
+// allowing a single query to resolve dynamic values, like the current tenant, on each execution.
+// If there are no deferred values, the same map is returned.
+func ResolveParameters(paramMap map[string]interface{}) map[string]interface{} {
+	var resolved map[string]interface{}
+	for k, v := range paramMap {
+		if f, ok := v.(func() interface{}); ok {
+			if resolved == nil {
+				resolved = make(map[string]interface{}, len(paramMap))
+				for name, p := range paramMap {
+					resolved[name] = p
+				}
+			}
+			resolved[k] = f()
+		}
+	}
+	if resolved == nil {
+		return paramMap
+	}
+	return resolved
+}
+
+// evaluates the value if it is deferred
+func resolveValue(v interface{}) interface{} {
+	if f, ok := v.(func() interface{}); ok {
+		return f()
+	}
+	return v
+}
+
+// evaluates the deferred values. The original slice is not changed.
+func resolveParams(params []interface{}) []interface{} {
+	var resolved []interface{}
+	for k, v := range params {
+		if f, ok := v.(func() interface{}); ok {
+			if resolved == nil {
+				resolved = make([]interface{}, len(params))
+				copy(resolved, params)
+			}
+			resolved[k] = f()
+		}
+	}
+	if resolved == nil {
+		return params
+	}
+	return resolved
+}
+
+func (this *RawSql) Clone() interface{} {
+	other := new(RawSql)
+	other.OriSql = this.OriSql
+	other.Sql = this.Sql
+	if this.Names != nil {
+		other.Names = make([]string, len(this.Names))
+		copy(other.Names, this.Names)
+	}
+	// the indexes are never changed
+	other.Indexes = this.Indexes
+	other.Placeholder = this.Placeholder
+	return other
+}
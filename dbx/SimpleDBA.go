@@ -1,9 +1,14 @@
 package dbx
 
 import (
+	"context"
 	"database/sql"
+	"encoding/csv"
 	"fmt"
+	"io"
 	"reflect"
+	"strings"
+	"time"
 
 	tk "github.com/quintans/toolkit"
 	coll "github.com/quintans/toolkit/collection"
@@ -16,6 +21,43 @@ var logger = log.LoggerFor("github.com/quintans/goSQL/dbx")
 type SimpleDBA struct {
 	// The connection to execute the query in.
 	connection IConnection
+	// executed in order before each statement
+	interceptors []Interceptor
+	// QueryRow scans only the first columns, ignoring the extra ones
+	ignoreExtraColumns bool
+	// if nil, the package logger is used
+	logger Logger
+	// if defined, the queries are read in batches with a server side cursor
+	cursor *Cursor
+	// if defined, the statements are recorded instead of executed
+	dryRun *DryRun
+	// decides, for each row that fails to be transformed, if the query is aborted
+	onScanError ScanErrorHandler
+	// if defined, the time parameters and the scanned times are converted to this location
+	location *time.Location
+	// trailing comment of every statement
+	comment string
+	// the buffer of the channel of QueryChannel
+	channelBuffer int
+	// how the database folds the returned column names
+	identifierCase IdentifierCase
+}
+
+// ScanErrorHandler receives the error of a row that failed to be scanned or transformed.
+// Returning nil skips the row and the query continues.
+// Returning an error aborts the query with that error.
+type ScanErrorHandler func(err error) error
+
+// Cursor holds the statements to read a query result in batches, with a server side cursor,
+// so that the driver does not buffer the entire result.
+type Cursor struct {
+	// declares the cursor for the query. Receives the query parameters
+	Declare string
+	// fetches the next batch
+	Fetch string
+	Close string
+	// the number of rows of each fetch
+	FetchSize int
 }
 
 func NewSimpleDBA(connection IConnection) *SimpleDBA {
@@ -24,7 +66,143 @@ func NewSimpleDBA(connection IConnection) *SimpleDBA {
 	return this
 }
 
-func closeResources(rows *sql.Rows, stmt *sql.Stmt) error {
+// AddInterceptor adds interceptors that are applied, in the order they were added,
+// to every SQL before being executed.
+func (this *SimpleDBA) AddInterceptor(interceptors ...Interceptor) *SimpleDBA {
+	this.interceptors = append(this.interceptors, interceptors...)
+	return this
+}
+
+// IgnoreExtraColumns makes QueryRow scan only the first len(dest) columns,
+// instead of failing when the query returns more columns than destinations.
+func (this *SimpleDBA) IgnoreExtraColumns(ignore bool) *SimpleDBA {
+	this.ignoreExtraColumns = ignore
+	return this
+}
+
+// SetLogger defines the logger for this instance. If nil, the package logger is used.
+func (this *SimpleDBA) SetLogger(logger Logger) *SimpleDBA {
+	this.logger = logger
+	return this
+}
+
+func (this *SimpleDBA) GetLogger() Logger {
+	return this.logger
+}
+
+// WithCursor returns a copy of this SimpleDBA that reads the results of
+// QueryCollection and QueryClosure in batches with the cursor.
+// The cursor statements must refer the query being executed and, for most databases, be executed in a transaction.
+func (this *SimpleDBA) WithCursor(cursor *Cursor) *SimpleDBA {
+	other := *this
+	other.cursor = cursor
+	return &other
+}
+
+// SetDryRun records, in dryRun, the statements instead of executing them. If nil, they are executed.
+func (this *SimpleDBA) SetDryRun(dryRun *DryRun) *SimpleDBA {
+	this.dryRun = dryRun
+	return this
+}
+
+func (this *SimpleDBA) GetDryRun() *DryRun {
+	return this.dryRun
+}
+
+// OnScanError installs a handler that decides, row by row, if a transformation error
+// skips the row or aborts the query. If nil, the first error aborts the query.
+//
+// ex: collecting the errors and continuing
+//
+//	dba.OnScanError(func(err error) error {
+//		errs = append(errs, err)
+//		return nil
+//	})
+func (this *SimpleDBA) OnScanError(handler ScanErrorHandler) *SimpleDBA {
+	this.onScanError = handler
+	return this
+}
+
+func (this *SimpleDBA) GetOnScanError() ScanErrorHandler {
+	return this.onScanError
+}
+
+// SetLocation converts the time parameters to the location before binding them
+// and the times scanned by this SimpleDBA to the location. If nil, the times are not converted.
+func (this *SimpleDBA) SetLocation(location *time.Location) *SimpleDBA {
+	this.location = location
+	return this
+}
+
+func (this *SimpleDBA) GetLocation() *time.Location {
+	return this.location
+}
+
+// SetIdentifierCase defines how the database folds the returned column names,
+// when matching them with the sql tags of the struct fields.
+func (this *SimpleDBA) SetIdentifierCase(folding IdentifierCase) *SimpleDBA {
+	this.identifierCase = folding
+	return this
+}
+
+// SetComment appends, to every statement, the comment, making it visible to the database tools.
+// ex: app=billing,req=abc123 -> SELECT ... /* app=billing,req=abc123 */
+// The comment is appended after the interceptors. If empty, nothing is appended.
+func (this *SimpleDBA) SetComment(comment string) *SimpleDBA {
+	this.comment = comment
+	return this
+}
+
+func (this *SimpleDBA) GetComment() string {
+	return this.comment
+}
+
+// SetChannelBuffer defines the number of transformed rows that QueryChannel reads ahead of the consumer.
+// By default the channel is unbuffered.
+func (this *SimpleDBA) SetChannelBuffer(size int) *SimpleDBA {
+	this.channelBuffer = size
+	return this
+}
+
+// scanError returns nil if the row is to be skipped, otherwise the error that aborts the query
+func (this *SimpleDBA) scanError(code string, err error, sql string, params []interface{}) error {
+	if this.onScanError != nil {
+		if err = this.onScanError(err); err == nil {
+			return nil
+		}
+	}
+	return rethrow(code, err, sql, params...)
+}
+
+// prepares the statement in the connection or, in a dry run, records it
+func (this *SimpleDBA) prepare(sql string, params []interface{}) (*sql.Stmt, error) {
+	if this.dryRun != nil {
+		this.dryRun.add(sql, params)
+		return dryRunConnection().Prepare(sql)
+	}
+	if preparer, ok := this.connection.(CommentPreparer); ok && this.comment != "" {
+		return preparer.PrepareCommented(sql, this.comment)
+	}
+	return this.connection.Prepare(sql)
+}
+
+func (this *SimpleDBA) errorf(format string, args ...interface{}) {
+	if this.logger != nil {
+		this.logger.Errorf(format, args...)
+	} else {
+		logger.Errorf(format, args...)
+	}
+}
+
+func (this *SimpleDBA) intercept(sql string, params []interface{}) (string, []interface{}) {
+	for _, interceptor := range this.interceptors {
+		sql, params = interceptor(sql, params)
+	}
+	return sql, params
+}
+
+// closes the rows and the statement, unless the statement is kept by the connection
+func (this *SimpleDBA) closeResources(rows *sql.Rows, stmt *sql.Stmt) error {
 	var err error
 	if rows != nil {
 		err = rows.Close()
@@ -34,6 +212,9 @@ func closeResources(rows *sql.Rows, stmt *sql.Stmt) error {
 	}
 
 	if stmt != nil {
+		if keeper, ok := this.connection.(StatementKeeper); ok && keeper.Keeps(stmt) {
+			return nil
+		}
 		err = stmt.Close()
 		if err != nil {
 			return err
@@ -44,16 +225,24 @@ func closeResources(rows *sql.Rows, stmt *sql.Stmt) error {
 }
 
 func (this *SimpleDBA) fetchRows(sql string, params ...interface{}) (*sql.Rows, *sql.Stmt, error) {
-	stmt, err := this.connection.Prepare(sql)
+	sql, params = this.intercept(sql, resolveParams(params))
+	sql = appendComment(sql, this.comment)
+	params = localizeParams(this.location, params)
+	if CHECK_PLACEHOLDERS {
+		if err := checkPlaceholders(sql, params); err != nil {
+			return nil, nil, err
+		}
+	}
+	stmt, err := this.prepare(sql, params)
 	if err != nil {
-		logger.Errorf("%T.fetchRows PREPARE %s", this, err)
+		this.errorf("%T.fetchRows PREPARE %s", this, err)
 		return nil, nil, rethrow(FAULT_PREP_STATEMENT, err, sql, params...)
 	}
 
 	rows, err := stmt.Query(params...)
 	if err != nil {
-		stmt.Close()
-		logger.Errorf("%T.fetchRows QUERY %s: %s %s", this, err, sql, params)
+		this.closeResources(nil, stmt)
+		this.errorf("%T.fetchRows QUERY %s: %s %s", this, err, sql, params)
 		return nil, nil, rethrow(FAULT_QUERY, err, sql, params...)
 	}
 
@@ -63,20 +252,37 @@ func (this *SimpleDBA) fetchRows(sql string, params ...interface{}) (*sql.Rows,
 // Execute an SQL SELECT with named replacement parameters.<br>
 // The caller is responsible for closing the connection.
 //
-// param sql: The query to execute.
+// param query: The query to execute.
 // param params: The replacement parameters.
 // param rt: The handler that converts the results into an object.
 // return The Collection returned by the handler and a Fail if a database access error occurs
 func (this *SimpleDBA) QueryCollection(
-	sql string,
+	query string,
 	rt IRowTransformer,
 	params ...interface{},
 ) (coll.Collection, error) {
-	rows, stmt, fail := this.fetchRows(sql, params...)
+	if this.cursor != nil {
+		result := rt.BeforeAll()
+		defer rt.AfterAll(result)
+		err := this.fetchCursor(func(rows *sql.Rows) error {
+			instance, err := rt.Transform(rows)
+			if err != nil {
+				return this.scanError(FAULT_TRANSFORM, err, query, params)
+			}
+			rt.OnTransformation(result, instance)
+			return nil
+		}, params...)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	rows, stmt, fail := this.fetchRows(query, params...)
 	if fail != nil {
 		return nil, fail
 	}
-	defer closeResources(rows, stmt)
+	defer this.closeResources(rows, stmt)
 
 	result := rt.BeforeAll()
 	defer rt.AfterAll(result)
@@ -84,7 +290,10 @@ func (this *SimpleDBA) QueryCollection(
 	for rows.Next() {
 		instance, err := rt.Transform(rows)
 		if err != nil {
-			return nil, rethrow(FAULT_TRANSFORM, err, sql, params...)
+			if err = this.scanError(FAULT_TRANSFORM, err, query, params); err != nil {
+				return nil, err
+			}
+			continue
 		}
 		rt.OnTransformation(result, instance)
 	}
@@ -92,6 +301,24 @@ func (this *SimpleDBA) QueryCollection(
 	return result, nil
 }
 
+// Executes a precompiled SQL SELECT, binding the supplied named parameters.
+// The parameter map must hold a value for every parameter name of the RawSql.
+func (this *SimpleDBA) QueryCompiled(
+	rsql *RawSql,
+	params map[string]interface{},
+	rt IRowTransformer,
+) (coll.Collection, error) {
+	rsql, params, err := rsql.Expand(params)
+	if err != nil {
+		return nil, err
+	}
+	values, err := rsql.BuildValuesSafe(params)
+	if err != nil {
+		return nil, err
+	}
+	return this.QueryCollection(rsql.Sql, rt, values...)
+}
+
 func (this *SimpleDBA) Query(
 	sql string,
 	transformer func(rows *sql.Rows) (interface{}, error),
@@ -101,13 +328,16 @@ func (this *SimpleDBA) Query(
 	if fail != nil {
 		return nil, fail
 	}
-	defer closeResources(rows, stmt)
+	defer this.closeResources(rows, stmt)
 
 	results := make([]interface{}, 0, 10)
 	for rows.Next() {
 		result, err := transformer(rows)
 		if err != nil {
-			return nil, rethrow(FAULT_PARSE_STATEMENT, err, sql, params...)
+			if err = this.scanError(FAULT_PARSE_STATEMENT, err, sql, params); err != nil {
+				return nil, err
+			}
+			continue
 		}
 		results = append(results, result)
 	}
@@ -121,22 +351,267 @@ func (this *SimpleDBA) QueryClosure(
 	transformer func(rows *sql.Rows) error,
 	params ...interface{},
 ) error {
+	if this.cursor != nil {
+		return this.fetchCursor(func(rows *sql.Rows) error {
+			if err := transformer(rows); err != nil {
+				return this.scanError(FAULT_PARSE_STATEMENT, err, query, params)
+			}
+			return nil
+		}, params...)
+	}
+
 	rows, stmt, fail := this.fetchRows(query, params...)
 	if fail != nil {
 		return fail
 	}
-	defer closeResources(rows, stmt)
+	defer this.closeResources(rows, stmt)
 
 	for rows.Next() {
 		err := transformer(rows)
 		if err != nil {
-			return rethrow(FAULT_PARSE_STATEMENT, err, query, params...)
+			if err = this.scanError(FAULT_PARSE_STATEMENT, err, query, params); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
+// QueryChannel executes the query in a goroutine, sending each row, transformed by rt, to the returned channel.
+// The goroutine owns the statement and the rows, closing them, and the channels, when there are no more rows
+// or on the first error, that is sent to the error channel.
+// A consumer that stops reading before the rows channel is closed must cancel ctx,
+// so that the goroutine closes the rows and releases the connection. The ctx error is then sent to the error channel.
+//
+// ex:
+//
+//	ctx, cancel := context.WithCancel(context.Background())
+//	defer cancel()
+//	rows, errs := dba.QueryChannel(ctx, sql, rt, params...)
+//	for row := range rows {
+//		...
+//	}
+//	if err := <-errs; err != nil {
+//		...
+//	}
+func (this *SimpleDBA) QueryChannel(
+	ctx context.Context,
+	query string,
+	rt IRowTransformer,
+	params ...interface{},
+) (<-chan interface{}, <-chan error) {
+	results := make(chan interface{}, this.channelBuffer)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(results)
+		if err := ctx.Err(); err != nil {
+			errs <- err
+			return
+		}
+		err := this.queryEach(query, func(rows *sql.Rows) error {
+			instance, err := rt.Transform(rows)
+			if err != nil {
+				return this.scanError(FAULT_TRANSFORM, err, query, params)
+			}
+			select {
+			case results <- instance:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}, params...)
+		if err != nil {
+			errs <- err
+		}
+	}()
+	return results, errs
+}
+
+// calls the handler for each row, stopping on the first error
+func (this *SimpleDBA) queryEach(query string, handler func(rows *sql.Rows) error, params ...interface{}) error {
+	if this.cursor != nil {
+		return this.fetchCursor(handler, params...)
+	}
+
+	rows, stmt, fail := this.fetchRows(query, params...)
+	if fail != nil {
+		return fail
+	}
+	defer this.closeResources(rows, stmt)
+
+	for rows.Next() {
+		if err := handler(rows); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return rethrow(FAULT_QUERY, err, query, params...)
+	}
+	return nil
+}
+
+// declares the cursor and reads it in batches until there are no more rows
+func (this *SimpleDBA) fetchCursor(handler func(rows *sql.Rows) error, params ...interface{}) (err error) {
+	cursor := this.cursor
+	_, stmt, err := this.execute(cursor.Declare, params...)
+	if err != nil {
+		return err
+	}
+	this.closeResources(nil, stmt)
+	defer func() {
+		if _, stmt, e := this.execute(cursor.Close); e != nil {
+			if err == nil {
+				err = e
+			}
+		} else {
+			this.closeResources(nil, stmt)
+		}
+	}()
+
+	for {
+		rows, stmt, err := this.fetchRows(cursor.Fetch)
+		if err != nil {
+			return err
+		}
+		count := 0
+		for rows.Next() {
+			count++
+			if err = handler(rows); err != nil {
+				this.closeResources(rows, stmt)
+				return err
+			}
+		}
+		err = rows.Err()
+		this.closeResources(rows, stmt)
+		if err != nil {
+			return rethrow(FAULT_QUERY, err, cursor.Fetch)
+		}
+		if count < cursor.FetchSize {
+			return nil
+		}
+	}
+}
+
+// QueryMaps executes an SQL SELECT returning each row as a map keyed by the column names.
+func (this *SimpleDBA) QueryMaps(query string, params ...interface{}) ([]map[string]interface{}, error) {
+	list, err := this.QueryCollection(query, NewMapTransformer(), params...)
+	if err != nil {
+		return nil, err
+	}
+	maps := make([]map[string]interface{}, 0, list.Size())
+	for _, v := range list.Elements() {
+		maps = append(maps, v.(map[string]interface{}))
+	}
+	return maps, nil
+}
+
+// QueryOrderedMaps executes an SQL SELECT returning each row with the values in the order of rows.Columns().
+func (this *SimpleDBA) QueryOrderedMaps(query string, params ...interface{}) ([]*OrderedRow, error) {
+	list, err := this.QueryCollection(query, NewMapTransformer().Ordered(true), params...)
+	if err != nil {
+		return nil, err
+	}
+	return OrderedRows(list), nil
+}
+
+// OrderedRows converts the result of an ordered MapTransformer
+func OrderedRows(list coll.Collection) []*OrderedRow {
+	rows := make([]*OrderedRow, 0, list.Size())
+	for _, v := range list.Elements() {
+		rows = append(rows, v.(*OrderedRow))
+	}
+	return rows
+}
+
+// Executes an SQL SELECT and streams the rows to the writer as a JSON array of objects.
+// The object keys are the column names.
+// Binary values are encoded in base64 and time values in RFC3339.
+func (this *SimpleDBA) QueryJSON(
+	w io.Writer,
+	query string,
+	params ...interface{},
+) error {
+	rows, stmt, fail := this.fetchRows(query, params...)
+	if fail != nil {
+		return fail
+	}
+	defer this.closeResources(rows, stmt)
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	mt := NewMapTransformer()
+	mt.BeforeAll()
+	for i := 0; rows.Next(); i++ {
+		values, err := mt.scan(rows)
+		if err != nil {
+			return rethrow(FAULT_TRANSFORM, err, query, params...)
+		}
+		if i > 0 {
+			if _, err = io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if err = mt.writeJSON(w, values); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return rethrow(FAULT_QUERY, err, query, params...)
+	}
+	_, err := io.WriteString(w, "]")
+	return err
+}
+
+// Executes an SQL SELECT and streams the rows to the writer as CSV,
+// starting with a header record with the column names.
+// The rows are written as they are read, so the memory use does not depend on the result size.
+//
+// ex: dba.QueryCSV(w, dbx.CSVOptions{Null: "NULL", TimeLayout: "2006-01-02"}, "select * from book")
+func (this *SimpleDBA) QueryCSV(
+	w io.Writer,
+	opts CSVOptions,
+	query string,
+	params ...interface{},
+) error {
+	rows, stmt, fail := this.fetchRows(query, params...)
+	if fail != nil {
+		return fail
+	}
+	defer this.closeResources(rows, stmt)
+
+	cw := csv.NewWriter(w)
+	if opts.Comma != 0 {
+		cw.Comma = opts.Comma
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if err = cw.Write(columns); err != nil {
+		return err
+	}
+
+	mt := NewMapTransformer()
+	mt.BeforeAll()
+	for rows.Next() {
+		values, err := mt.scan(rows)
+		if err != nil {
+			return rethrow(FAULT_TRANSFORM, err, query, params...)
+		}
+		if err = cw.Write(mt.csvRecord(values, opts)); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return rethrow(FAULT_QUERY, err, query, params...)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
 //List using the closure arguments.
 //A function is used to build the result list.
 //The types for scanning are supplied by the function arguments. Arguments can be pointers or not.
@@ -160,6 +635,10 @@ func (this *SimpleDBA) QueryInto(
 	}
 
 	size := ftype.NumIn() // number of input variables
+	if size == 1 && isStructPtr(ftype.In(0)) {
+		return this.queryIntoStruct(query, closure, params...)
+	}
+
 	instances := make([]interface{}, size)
 	targets := make([]reflect.Type, size)
 	for i := 0; i < size; i++ {
@@ -188,6 +667,7 @@ func (this *SimpleDBA) QueryInto(
 		if err != nil {
 			return err
 		}
+		NormalizeTime(this.location, instances...)
 		values := make([]reflect.Value, size)
 		for k, v := range instances {
 			// Elem() gets the underlying object of the interface{}
@@ -218,6 +698,232 @@ func (this *SimpleDBA) QueryInto(
 	return results, nil
 }
 
+// struct pointers are filled field by field, except the ones that know how to scan themselves
+func isStructPtr(typ reflect.Type) bool {
+	if typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Struct {
+		return false
+	}
+	if typ.Implements(scannerType) || typ.Elem() == timeType {
+		return false
+	}
+	return true
+}
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+var timeType = reflect.TypeOf(time.Time{})
+
+// reserved values of the sql tag, that are not column names
+var reservedTags = map[string]bool{"omit": true, "omitzero": true, "nullzero": true}
+
+// queryIntoStruct calls the closure, with the signature func(*struct) [anything], for each row.
+// The columns are matched with the struct fields by the `sql` tag, if any field has it,
+// otherwise by the position of the exported fields.
+func (this *SimpleDBA) queryIntoStruct(
+	query string,
+	closure interface{},
+	params ...interface{},
+) ([]interface{}, error) {
+	ftype := reflect.TypeOf(closure)
+	typ := ftype.In(0).Elem()
+
+	var results []interface{}
+	if ftype.NumOut() > 1 {
+		return nil, fmt.Errorf("goSQL: A function must have at most one output. Got %v outputs.", ftype.NumOut())
+	} else if ftype.NumOut() == 1 {
+		results = make([]interface{}, 0)
+	}
+
+	// field index path for each column. nil if the column has no field
+	var fields [][]int
+	err := this.QueryClosure(query, func(rows *sql.Rows) error {
+		if fields == nil {
+			columns, err := rows.Columns()
+			if err != nil {
+				return err
+			}
+			if fields, err = structFields(typ, columns, this.identifierCase); err != nil {
+				return err
+			}
+		}
+
+		target := reflect.New(typ)
+		if err := scanStruct(rows, target.Elem(), fields, this.location); err != nil {
+			return err
+		}
+
+		res := reflect.ValueOf(closure).Call([]reflect.Value{target})
+		if results != nil {
+			results = append(results, res[0].Interface())
+		}
+		return nil
+	}, params...)
+
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// QueryStructFirst scans the first row of the query into the struct pointed by target,
+// matching the columns with the struct fields as in QueryInto.
+// Returns true if a row was found. The other rows are not read.
+//
+// ex: found, err := dba.QueryStructFirst("select * from book where id = ?", &book, id)
+func (this *SimpleDBA) QueryStructFirst(
+	query string,
+	target interface{},
+	params ...interface{},
+) (bool, error) {
+	v := reflect.ValueOf(target)
+	if target == nil || !isStructPtr(v.Type()) || v.IsNil() {
+		return false, fmt.Errorf("goSQL: Expected a pointer to a struct. Got %T.", target)
+	}
+
+	rows, stmt, err := this.fetchRows(query, params...)
+	if err != nil {
+		return false, err
+	}
+	defer this.closeResources(rows, stmt)
+
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return false, rethrow(FAULT_QUERY, err, query, params...)
+		}
+		return false, nil
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return false, err
+	}
+	fields, err := structFields(v.Elem().Type(), columns, this.identifierCase)
+	if err != nil {
+		return false, err
+	}
+	if err = scanStruct(rows, v.Elem(), fields, this.location); err != nil {
+		return false, rethrow(FAULT_SCAN, err, query, params...)
+	}
+	return true, nil
+}
+
+// scans the current row into the struct fields. Fields of NULL columns are left untouched.
+// The nested struct pointers are only created when one of their columns is not NULL.
+func scanStruct(rows *sql.Rows, target reflect.Value, fields [][]int, loc *time.Location) error {
+	typ := target.Type()
+	instances := make([]interface{}, len(fields))
+	for k, f := range fields {
+		if f == nil {
+			instances[k] = new(interface{})
+		} else {
+			instances[k] = reflect.New(reflect.PtrTo(typ.FieldByIndex(f).Type)).Interface()
+		}
+	}
+	if err := rows.Scan(instances...); err != nil {
+		return err
+	}
+
+	for k, f := range fields {
+		if f == nil {
+			continue
+		}
+		e := reflect.ValueOf(instances[k]).Elem()
+		if !e.IsNil() {
+			field := fieldByPath(target, f)
+			field.Set(e.Elem())
+			NormalizeTime(loc, field.Addr().Interface())
+		}
+	}
+	return nil
+}
+
+// the field in the path of field indexes, creating the nil struct pointers along the way
+func fieldByPath(v reflect.Value, path []int) reflect.Value {
+	for k, i := range path {
+		if k > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v
+}
+
+// matches the columns with the struct fields, returning the path of field indexes for each column
+func structFields(typ reflect.Type, columns []string, folding IdentifierCase) ([][]int, error) {
+	tagged := make(map[string][]int)
+	exported := taggedFields(typ, "", nil, tagged, map[reflect.Type]bool{typ: true})
+
+	fields := make([][]int, len(columns))
+	if len(tagged) > 0 {
+		for k, c := range columns {
+			fields[k] = taggedField(tagged, c, folding)
+		}
+		return fields, nil
+	}
+
+	if len(columns) > len(exported) {
+		return nil, fmt.Errorf("goSQL: The query returns %v columns but the struct %s only has %v exported fields.",
+			len(columns), typ.String(), len(exported))
+	}
+	for k := range columns {
+		fields[k] = []int{exported[k]}
+	}
+	return fields, nil
+}
+
+// the field of the tag matching the column, after the case folding of the database.
+// If none matches, the tag is matched ignoring the case.
+func taggedField(tagged map[string][]int, column string, folding IdentifierCase) []int {
+	for name, field := range tagged {
+		if folding.Equal(column, name) {
+			return field
+		}
+	}
+	for name, field := range tagged {
+		if strings.EqualFold(column, name) {
+			return field
+		}
+	}
+	return nil
+}
+
+// collects the fields with the sql tag, by the tag name, returning the exported fields.
+// A tagged field holding a struct, or a struct pointer, is a nested struct
+// whose tagged fields are matched by the qualified names, <prefix>_<name> or <prefix>.<name>.
+// ex: a column aliased as PUBLISHER_ID matches the field with the tag ID of the nested struct with the tag PUBLISHER
+func taggedFields(typ reflect.Type, prefix string, path []int, tagged map[string][]int, visited map[reflect.Type]bool) []int {
+	var exported []int
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		exported = append(exported, i)
+		name := strings.Split(f.Tag.Get("sql"), ",")[0]
+		if name == "" || reservedTags[name] {
+			continue
+		}
+		fieldPath := append(append([]int{}, path...), i)
+
+		nested := f.Type
+		if nested.Kind() == reflect.Ptr {
+			nested = nested.Elem()
+		}
+		if isStructPtr(reflect.PtrTo(nested)) && !visited[nested] {
+			visited[nested] = true
+			for _, separator := range []string{"_", "."} {
+				taggedFields(nested, prefix+name+separator, fieldPath, tagged, visited)
+			}
+			delete(visited, nested)
+		} else {
+			tagged[prefix+name] = fieldPath
+		}
+	}
+	return exported
+}
+
 // Execute an SQL SELECT query with named parameters returning the first result.
 //
 // param <T>
@@ -265,7 +971,29 @@ func (this *SimpleDBA) QueryRow(
 	if err != nil {
 		return false, err
 	}
-	defer closeResources(rows, stmt)
+	defer this.closeResources(rows, stmt)
+	if this.dryRun != nil {
+		return false, nil
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return false, err
+	}
+	if len(columns) != len(dest) {
+		if len(columns) < len(dest) || !this.ignoreExtraColumns {
+			return false, NewPersistenceFail(FAULT_SCAN,
+				fmt.Sprintf("The query returned %v columns %v, but there are %v destinations\nSQL: %s",
+					len(columns), columns, len(dest), sql))
+		}
+		// the extra columns are discarded
+		all := make([]interface{}, len(columns))
+		copy(all, dest)
+		for k := len(dest); k < len(all); k++ {
+			all[k] = new(interface{})
+		}
+		dest = all
+	}
 
 	var ok bool
 	if rows.Next() {
@@ -273,12 +1001,66 @@ func (this *SimpleDBA) QueryRow(
 		if err != nil {
 			return false, err
 		}
+		NormalizeTime(this.location, dest...)
 		ok = true
 	}
 
 	return ok, nil
 }
 
+// CallProc executes a stored procedure call (ex: CALL, EXEC) that returns several result sets.
+// Each result set is converted by the transformer in the same position,
+// and the collections are returned in that order. Result sets without a transformer are ignored.
+//
+// Output and INOUT parameters are passed as sql.Out and hold their values after the call,
+// if the driver supports them.
+//
+// ex: dba.CallProc("CALL BOOK_STATS(?)", []IRowTransformer{booksRT, totalsRT}, sql.Out{Dest: &count})
+func (this *SimpleDBA) CallProc(
+	query string,
+	transformers []IRowTransformer,
+	params ...interface{},
+) ([]coll.Collection, error) {
+	rows, stmt, err := this.fetchRows(query, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]coll.Collection, 0, len(transformers))
+	for k := 0; ; k++ {
+		if k < len(transformers) {
+			rt := transformers[k]
+			result := rt.BeforeAll()
+			for rows.Next() {
+				instance, err := rt.Transform(rows)
+				if err != nil {
+					if err = this.scanError(FAULT_TRANSFORM, err, query, params); err != nil {
+						this.closeResources(rows, stmt)
+						return nil, err
+					}
+					continue
+				}
+				rt.OnTransformation(result, instance)
+			}
+			rt.AfterAll(result)
+			results = append(results, result)
+		}
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+
+	err = rows.Err()
+	// the output parameters are only set after the rows are closed
+	if e := this.closeResources(rows, stmt); err == nil {
+		err = e
+	}
+	if err != nil {
+		return nil, rethrow(FAULT_QUERY, err, query, params...)
+	}
+	return results, nil
+}
+
 ////////////////////////////////////////////////////////////////////////
 
 // Execute an SQL INSERT, UPDATE, or DELETE query.
@@ -291,14 +1073,22 @@ func (this *SimpleDBA) QueryRow(
 //            The query replacement parameters.
 // @return The number of rows affected.
 func (this *SimpleDBA) execute(sql string, params ...interface{}) (sql.Result, *sql.Stmt, error) {
-	stmt, err := this.connection.Prepare(sql)
+	sql, params = this.intercept(sql, resolveParams(params))
+	sql = appendComment(sql, this.comment)
+	params = localizeParams(this.location, params)
+	if CHECK_PLACEHOLDERS {
+		if err := checkPlaceholders(sql, params); err != nil {
+			return nil, nil, err
+		}
+	}
+	stmt, err := this.prepare(sql, params)
 	if err != nil {
 		return nil, nil, rethrow(FAULT_PREP_STATEMENT, err, sql, params...)
 	}
 
 	result, err := stmt.Exec(params...)
 	if err != nil {
-		stmt.Close()
+		this.closeResources(nil, stmt)
 		return nil, nil, rethrow(FAULT_EXEC_STATEMENT, err, sql, params...)
 	}
 
@@ -321,10 +1111,37 @@ func (this *SimpleDBA) Update(sql string, params ...interface{}) (int64, error)
 	if err != nil {
 		return 0, err
 	}
-	defer closeResources(nil, stmt)
+	defer this.closeResources(nil, stmt)
 	return result.RowsAffected()
 }
 
+// Exec executes any SQL statement, like an INSERT, UPDATE, DELETE or DDL (ex: migrations),
+// returning the driver result, giving access to the affected rows and,
+// if the driver supports it, to the last inserted id.
+// The statement goes through the same prepare and error handling of the other executions.
+func (this *SimpleDBA) Exec(sql string, params ...interface{}) (sql.Result, error) {
+	result, stmt, err := this.execute(sql, params...)
+	if err != nil {
+		return nil, err
+	}
+	this.closeResources(nil, stmt)
+	return result, nil
+}
+
+// Executes a precompiled SQL INSERT, UPDATE, or DELETE, binding the supplied named parameters.
+// The parameter map must hold a value for every parameter name of the RawSql.
+func (this *SimpleDBA) UpdateCompiled(rsql *RawSql, params map[string]interface{}) (int64, error) {
+	rsql, params, err := rsql.Expand(params)
+	if err != nil {
+		return 0, err
+	}
+	values, err := rsql.BuildValuesSafe(params)
+	if err != nil {
+		return 0, err
+	}
+	return this.Update(rsql.Sql, values...)
+}
+
 func (this *SimpleDBA) Delete(sql string, params ...interface{}) (int64, error) {
 	return this.Update(sql, params...)
 }
@@ -334,12 +1151,27 @@ func (this *SimpleDBA) Insert(sql string, params ...interface{}) (int64, error)
 	if err != nil {
 		return 0, err
 	}
-	defer closeResources(nil, stmt)
+	defer this.closeResources(nil, stmt)
 	// not supported in all drivers (ex: pq)
 	// return result.LastInsertId()
 	return 0, nil
 }
 
+// InsertWithLastId executes the insert and returns the key generated by the database.
+// Only use it with drivers that support sql.Result.LastInsertId (ex: MySQL, SQLite)
+func (this *SimpleDBA) InsertWithLastId(sql string, params ...interface{}) (int64, error) {
+	result, stmt, err := this.execute(sql, params...)
+	if err != nil {
+		return 0, err
+	}
+	defer this.closeResources(nil, stmt)
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, rethrow(FAULT_EXEC_STATEMENT, err, sql, params...)
+	}
+	return id, nil
+}
+
 func (this *SimpleDBA) InsertReturning(sql string, params ...interface{}) (int64, error) {
 	var id int64
 	_, err := this.QueryRow(sql, params, &id)
@@ -370,5 +1202,7 @@ func rethrow(code string, cause error, sql string, params ...interface{}) error
 		msg.Add(fmt.Sprintf("%v", params))
 	}
 
-	return NewPersistenceFail(code, msg.String())
+	fail := NewPersistenceFail(code, msg.String())
+	fail.Cause = cause
+	return fail
 }
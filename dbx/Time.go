@@ -0,0 +1,73 @@
+package dbx
+
+import (
+	"database/sql"
+	"time"
+)
+
+// NormalizeTime converts, to the location, the times held by the scan destinations.
+// The supported destinations are *time.Time, **time.Time, *sql.NullTime and *interface{}.
+// Zero times and other destinations are left untouched. If loc is nil nothing is done.
+func NormalizeTime(loc *time.Location, dest ...interface{}) {
+	if loc == nil {
+		return
+	}
+	for _, d := range dest {
+		switch t := d.(type) {
+		case *time.Time:
+			inLocation(loc, t)
+		case **time.Time:
+			if t != nil {
+				inLocation(loc, *t)
+			}
+		case *sql.NullTime:
+			if t != nil && t.Valid {
+				inLocation(loc, &t.Time)
+			}
+		case *interface{}:
+			if t != nil {
+				if v, ok := (*t).(time.Time); ok && !v.IsZero() {
+					*t = v.In(loc)
+				}
+			}
+		}
+	}
+}
+
+func inLocation(loc *time.Location, t *time.Time) {
+	if t != nil && !t.IsZero() {
+		*t = t.In(loc)
+	}
+}
+
+// localizeParams returns the parameters with the time values converted to the location.
+// The original slice is not changed.
+func localizeParams(loc *time.Location, params []interface{}) []interface{} {
+	if loc == nil {
+		return params
+	}
+	var localized []interface{}
+	for k, p := range params {
+		var v time.Time
+		switch t := p.(type) {
+		case time.Time:
+			v = t
+		case *time.Time:
+			if t == nil {
+				continue
+			}
+			v = *t
+		default:
+			continue
+		}
+		if localized == nil {
+			localized = make([]interface{}, len(params))
+			copy(localized, params)
+		}
+		localized[k] = v.In(loc)
+	}
+	if localized == nil {
+		return params
+	}
+	return localized
+}
@@ -1,14 +1,25 @@
 package common
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"io/ioutil"
 
 	. "github.com/quintans/goSQL/db"
 	"github.com/quintans/goSQL/dbx"
+	"github.com/quintans/goSQL/translators"
 	"github.com/quintans/toolkit/ext"
 	"github.com/quintans/toolkit/log"
 
 	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 )
@@ -46,6 +57,10 @@ func init() {
 
 var RAW_SQL string
 
+// the statements to create, call and drop the stored procedure BOOKS_OF,
+// that returns the names of the books of a publisher, ordered by id
+var PROC_CREATE, PROC_CALL, PROC_DROP string
+
 func InitDB(driverName, dataSourceName string, translator Translator) (ITransactionManager, *sql.DB) {
 	mydb, err := sql.Open(driverName, dataSourceName)
 	if err != nil {
@@ -123,6 +138,106 @@ func RunAll(TM ITransactionManager, t *testing.T) {
 	RunRawSQL2(TM, t)
 	RunHaving(TM, t)
 	RunUnion(TM, t)
+	RunCompiledQuery(TM, t)
+	RunNotExists(TM, t)
+	RunListMaps(TM, t)
+	RunNestedTransaction(TM, t)
+	RunInSliceParam(TM, t)
+	RunInterceptor(TM, t)
+	RunQueryIntoStruct(TM, t)
+	RunFluentOr(TM, t)
+	RunNPlusOneDetector(TM, t)
+	RunFetchBatch(TM, t)
+	RunShortCircuit(TM, t)
+	RunStrictTypes(TM, t)
+	RunSubmitBatch(TM, t)
+	RunDryRun(TM, t)
+	RunGeneratedSQL(TM, t)
+	RunCompositeKey(TM, t)
+	RunInTuple(TM, t)
+	RunSelectedColumns(TM, t)
+	RunOnScanError(TM, t)
+	RunTimeLocation(TM, t)
+	RunNotCriteria(TM, t)
+	RunGreatestLeast(TM, t)
+	RunDeferredParameter(TM, t)
+	RunSchemaMapping(TM, t)
+	RunAnyAll(TM, t)
+	RunListOrderedMaps(TM, t)
+	RunQueryCSV(TM, t)
+	RunRawSQL(TM, t)
+	RunInsertDefault(TM, t)
+	RunMaxJoinDepth(TM, t)
+	RunUpdateAndFetch(TM, t)
+	RunIdentifierCase(TM, t)
+	RunStatementComment(TM, t)
+	RunMockConnection(TM, t)
+	RunFromSQL(TM, t)
+	RunLimitWithTies(TM, t)
+	RunEncryptedColumn(TM, t)
+	RunStringAgg(TM, t)
+	RunCountDistinct(TM, t)
+	RunOrderByAlias(TM, t)
+	RunBytesAsString(TM, t)
+	RunTruncate(TM, t)
+	RunWhereIf(TM, t)
+	RunTransactionWith(TM, t)
+	RunCheckPlaceholders(TM, t)
+	RunCommonTable(TM, t)
+	RunPing(TM, t)
+	RunBoolAs(TM, t)
+	RunIntoTable(TM, t)
+	RunParameterCriteria(TM, t)
+	RunMinMax(TM, t)
+	RunSkipWithoutLimit(TM, t)
+	RunSeveralOn(TM, t)
+	RunQueryChannel(TM, t)
+	RunMaxParameters(TM, t)
+	RunQueryFingerprint(TM, t)
+	RunErrorCategory(TM, t)
+	RunInStructs(TM, t)
+	RunIgnoreDiscriminators(TM, t)
+	RunCorrelatedCountColumn(TM, t)
+	RunExecDDL(TM, t)
+	RunErrorConstraint(TM, t)
+	RunLoadInto(TM, t)
+	RunSubmitChanged(TM, t)
+	RunJoinOptions(TM, t)
+	RunUpdateSetMap(TM, t)
+	RunTxStatementCache(TM, t)
+	RunNestedStructColumns(TM, t)
+	RunListTree(TM, t)
+	RunSelfJoin(TM, t)
+	RunSubmitChunks(TM, t)
+	RunAggregateFilter(TM, t)
+	RunStatementTimeout(TM, t)
+	RunForUpdate(TM, t)
+	RunVirtualColumnAliases(TM, t)
+	RunDeleteWithJoin(TM, t)
+	RunUpdateWithJoin(TM, t)
+	RunFetchSizeCursors(TM, t)
+	RunScannerFields(TM, t)
+	RunAcquireTimeout(TM, t)
+	RunSplitWrites(TM, t)
+	RunConverterNull(TM, t)
+	RunCombineNil(TM, t)
+	RunQueryJSON(TM, t)
+	RunDiscriminatorCombiner(TM, t)
+	RunQueryClone(TM, t)
+	RunPlaceholderFormatters(TM, t)
+	RunJoinAliasPrefix(TM, t)
+	RunBuildValuesSafe(TM, t)
+	RunReplica(TM, t)
+	RunZeroModes(TM, t)
+	RunAutoTimestamps(TM, t)
+	RunInterpolatedSQL(TM, t)
+	RunIgnoreExtraColumns(TM, t)
+	RunOrderCollation(TM, t)
+	RunExecuteResult(TM, t)
+	RunSetLogger(TM, t)
+	RunSecretParameters(TM, t)
+	RunCallProc(TM, t)
+	RunIncludeIf(TM, t)
 }
 
 func ResetDB(TM ITransactionManager) {
@@ -1932,3 +2047,3942 @@ func RunUnion(TM ITransactionManager, t *testing.T) {
 	}
 
 }
+
+func RunCompiledQuery(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	query := store.Query(BOOK).
+		All().
+		Where(BOOK_C_NAME.Matches(Param("name")))
+	rsql := query.Compile()
+
+	for _, name := range []string{"Cookbook", "Scrapbook"} {
+		params := make(map[string]interface{})
+		for k, v := range query.GetParameters() {
+			params[k] = v
+		}
+		params["name"] = name
+
+		list, err := query.GetDba().QueryCompiled(rsql, params, NewEntityTransformer(query, (*Book)(nil)))
+		if err != nil {
+			t.Fatalf("Failed TestCompiledQuery: %s", err)
+		}
+		if list.Size() != 1 {
+			t.Fatalf("Expected 1 book named %s, but got %v", name, list.Size())
+		}
+		book := list.Enumerator().Next().(*Book)
+		if book.Name != name {
+			t.Fatalf("Expected book named %s, but got %s", name, book.Name)
+		}
+	}
+}
+
+func RunNotExists(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	subquery := store.Query(BOOK).Alias("b").
+		Column(AsIs(1)).
+		Where(
+		BOOK_C_PUBLISHER_ID.Matches(PUBLISHER_C_ID.For("p")),
+		BOOK_C_PRICE.Greater(30),
+	)
+
+	var publishers []*Publisher
+	err := store.Query(PUBLISHER).Alias("p").
+		All().
+		Where(NotExists(subquery)).
+		List(&publishers)
+	if err != nil {
+		t.Fatalf("Failed TestNotExists: %s", err)
+	}
+
+	if len(publishers) != 1 {
+		t.Fatalf("Expected 1 publisher, but got %v", len(publishers))
+	}
+	if *publishers[0].Id != 2 {
+		t.Fatalf("Expected publisher with id 2, but got %v", *publishers[0].Id)
+	}
+}
+
+func RunListMaps(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	maps, err := store.Query(BOOK).
+		Column(BOOK_C_PUBLISHER_ID).
+		Column(Count(nil).As("total")).
+		Where(BOOK_C_PUBLISHER_ID.Matches(2)).
+		GroupByPos(1).
+		ListMaps()
+	if err != nil {
+		t.Fatalf("Failed TestListMaps: %s", err)
+	}
+
+	if len(maps) != 1 {
+		t.Fatalf("Expected 1 row, but got %v", len(maps))
+	}
+	if _, ok := maps[0]["PublisherId"]; !ok {
+		t.Fatalf("Expected key PublisherId, but got %v", maps[0])
+	}
+	if total := fmt.Sprint(maps[0]["total"]); total != "2" {
+		t.Fatalf("Expected total of 2, but got %v", total)
+	}
+}
+
+func RunNestedTransaction(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	var depth int
+	err := TM.Transaction(func(store IDb) error {
+		// the inner failure only rolls back its own changes
+		TM.NestedTransaction(store, func(inner IDb) error {
+			depth = inner.TxDepth()
+			if _, err := inner.Update(PUBLISHER).Set(PUBLISHER_C_NAME, "Inner").
+				Where(PUBLISHER_C_ID.Matches(1)).
+				Execute(); err != nil {
+				return err
+			}
+			return errors.New("Rollback inner")
+		})
+
+		_, err := store.Update(PUBLISHER).Set(PUBLISHER_C_NAME, "Outer").
+			Where(PUBLISHER_C_ID.Matches(2)).
+			Execute()
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed TestNestedTransaction: %s", err)
+	}
+
+	if depth != 2 {
+		t.Fatalf("Expected nested depth 2, but got %v", depth)
+	}
+
+	store := TM.Store()
+	var name string
+	store.Query(PUBLISHER).Column(PUBLISHER_C_NAME).Where(PUBLISHER_C_ID.Matches(1)).SelectInto(&name)
+	if name != "Geek Publications" {
+		t.Fatalf("Expected the inner change to be rolled back, but got %s", name)
+	}
+	store.Query(PUBLISHER).Column(PUBLISHER_C_NAME).Where(PUBLISHER_C_ID.Matches(2)).SelectInto(&name)
+	if name != "Outer" {
+		t.Fatalf("Expected the outer change to be committed, but got %s", name)
+	}
+}
+
+func RunInSliceParam(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	query := store.Query(BOOK).
+		All().
+		Where(BOOK_C_ID.In(Param("ids"))).
+		Order(BOOK_C_ID)
+	// the slice is expanded into one parameter per element
+	query.SetParameter("ids", []int64{1, 3})
+
+	var books []*Book
+	err := query.List(&books)
+	if err != nil {
+		t.Fatalf("Failed TestInSliceParam: %s", err)
+	}
+
+	if len(books) != 2 {
+		t.Fatalf("Expected 2 books, but got %v", len(books))
+	}
+	if *books[0].Id != 1 || *books[1].Id != 3 {
+		t.Fatalf("Expected books 1 and 3, but got %v and %v", *books[0].Id, *books[1].Id)
+	}
+
+	// outside of a IN, a slice would render invalid SQL
+	update := store.Update(PUBLISHER).
+		Set(PUBLISHER_C_NAME, Param("names")).
+		Where(PUBLISHER_C_ID.Matches(1))
+	update.SetParameter("names", []string{"a", "b"})
+	if _, err := update.Execute(); err == nil {
+		t.Fatal("Expected an error for a slice parameter in the SET clause")
+	}
+}
+
+func RunInterceptor(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	var intercepted []string
+	store.AddInterceptor(func(sql string, params []interface{}) (string, []interface{}) {
+		sql = "/* books */ " + sql
+		intercepted = append(intercepted, sql)
+		return sql, params
+	})
+
+	var books []*Book
+	if err := store.Query(BOOK).All().List(&books); err != nil {
+		t.Fatalf("Failed TestInterceptor: %s", err)
+	}
+
+	if len(books) != 3 {
+		t.Fatalf("Expected 3 books, but got %v", len(books))
+	}
+	if len(intercepted) != 1 {
+		t.Fatalf("Expected 1 intercepted SQL, but got %v", len(intercepted))
+	}
+}
+
+func RunQueryIntoStruct(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	type NamePrice struct {
+		Name  string
+		Price float64
+	}
+
+	store := TM.Store()
+	query := store.Query(BOOK).
+		Column(BOOK_C_NAME, BOOK_C_PRICE).
+		Where(BOOK_C_PRICE.Lesser(20)).
+		Order(BOOK_C_ID)
+	rsql := query.Compile()
+
+	// the columns are matched by position with the struct fields
+	var names []string
+	_, err := query.GetDba().QueryInto(rsql.Sql, func(book *NamePrice) {
+		names = append(names, book.Name)
+	}, rsql.BuildValues(query.GetParameters())...)
+	if err != nil {
+		t.Fatalf("Failed TestQueryIntoStruct: %s", err)
+	}
+
+	if len(names) != 2 || names[0] != "Cookbook" || names[1] != "Scrapbook" {
+		t.Fatalf("Expected Cookbook and Scrapbook, but got %v", names)
+	}
+
+	// only the first row
+	var first NamePrice
+	found, err := query.GetDba().QueryStructFirst(rsql.Sql, &first, rsql.BuildValues(query.GetParameters())...)
+	if err != nil {
+		t.Fatalf("Failed TestQueryIntoStruct: %s", err)
+	}
+	if !found || first.Name != "Cookbook" {
+		t.Fatalf("Expected Cookbook, but got %v", first.Name)
+	}
+}
+
+func RunFluentOr(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	var books []*Book
+	err := store.Query(BOOK).
+		All().
+		Where(
+		BOOK_C_PRICE.Lesser(10).Or(BOOK_C_PRICE.Greater(30)),
+		BOOK_C_PUBLISHER_ID.Matches(2).Or(BOOK_C_PUBLISHER_ID.Matches(1)),
+	).
+		Order(BOOK_C_ID).
+		List(&books)
+	if err != nil {
+		t.Fatalf("Failed TestFluentOr: %s", err)
+	}
+
+	if len(books) != 2 || *books[0].Id != 1 || *books[1].Id != 3 {
+		t.Fatalf("Expected books 1 and 3, but got %v books", len(books))
+	}
+}
+
+type warningsLogger struct {
+	warnings []string
+}
+
+func (this *warningsLogger) IsDebug() bool { return false }
+
+func (this *warningsLogger) Debugf(format string, args ...interface{}) {}
+
+func (this *warningsLogger) Warnf(format string, args ...interface{}) {
+	this.warnings = append(this.warnings, fmt.Sprintf(format, args...))
+}
+
+func (this *warningsLogger) Errorf(format string, args ...interface{}) {}
+
+func RunNPlusOneDetector(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	warnings := new(warningsLogger)
+	detector := dbx.NewNPlusOneDetector(3, time.Minute).SetLogger(warnings)
+
+	store := TM.Store()
+	store.AddInterceptor(detector.Interceptor())
+	// one query per book
+	for id := 1; id <= 3; id++ {
+		var book Book
+		_, err := store.Query(BOOK).All().Where(BOOK_C_ID.Matches(id)).SelectTo(&book)
+		if err != nil {
+			t.Fatalf("Failed TestNPlusOneDetector: %s", err)
+		}
+	}
+
+	if len(warnings.warnings) != 1 {
+		t.Fatalf("Expected 1 warning, but got %v", len(warnings.warnings))
+	}
+}
+
+func RunFetchBatch(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	var publishers []*Publisher
+	err := store.Query(PUBLISHER).
+		All().
+		Outer(PUBLISHER_A_BOOKS).FetchBatch().
+		Order(PUBLISHER_C_ID).
+		List(&publishers)
+	if err != nil {
+		t.Fatalf("Failed TestFetchBatch: %s", err)
+	}
+
+	if len(publishers) != 2 {
+		t.Fatalf("Expected 2 publishers, but got %v", len(publishers))
+	}
+	if len(publishers[0].Books) != 1 || len(publishers[1].Books) != 2 {
+		t.Fatalf("Expected 1 and 2 books, but got %v and %v", len(publishers[0].Books), len(publishers[1].Books))
+	}
+
+	// a clone of the query, into a slice of structs
+	query := store.Query(PUBLISHER).
+		All().
+		Outer(PUBLISHER_A_BOOKS).FetchBatch().
+		Order(PUBLISHER_C_ID)
+	var values []Publisher
+	if err := query.Clone().(*Query).List(&values); err != nil {
+		t.Fatalf("Failed TestFetchBatch: %s", err)
+	}
+	if len(values) != 2 || len(values[0].Books) != 1 || len(values[1].Books) != 2 {
+		t.Fatalf("Expected 2 publishers with 1 and 2 books, but got %+v", values)
+	}
+}
+
+func RunShortCircuit(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	executed := 0
+	store.AddInterceptor(func(sql string, params []interface{}) (string, []interface{}) {
+		executed++
+		return sql, params
+	})
+
+	query := store.Query(BOOK).
+		All().
+		Where(BOOK_C_ID.In(Param("ids"))).
+		ShortCircuit(true)
+	query.SetParameter("ids", []int64{})
+
+	var books []*Book
+	if err := query.List(&books); err != nil {
+		t.Fatalf("Failed TestShortCircuit: %s", err)
+	}
+	if len(books) != 0 {
+		t.Fatalf("Expected 0 books, but got %v", len(books))
+	}
+	if executed != 0 {
+		t.Fatalf("Expected no executed SQL, but got %v", executed)
+	}
+
+	// with values the query runs
+	query.SetParameter("ids", []int64{1})
+	books = nil
+	if err := query.List(&books); err != nil {
+		t.Fatalf("Failed TestShortCircuit: %s", err)
+	}
+	if len(books) != 1 {
+		t.Fatalf("Expected 1 book, but got %v", len(books))
+	}
+	if executed != 1 {
+		t.Fatalf("Expected 1 executed SQL, but got %v", executed)
+	}
+}
+
+func RunStrictTypes(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	store.SetStrictTypes(true)
+
+	// a raw value of a criteria
+	if _, err := store.Query(BOOK).Column(BOOK_C_NAME).Where(BOOK_C_PRICE.Matches("cheap")).ListInto(func(name string) string {
+		return name
+	}); err == nil {
+		t.Fatal("Expected an error binding a string to a decimal column")
+	}
+
+	// the value of a SET
+	if _, err := store.Update(BOOK).Set(BOOK_C_PRICE, uintptr(10)).Where(BOOK_C_ID.Matches(1)).Execute(); err == nil {
+		t.Fatal("Expected an error binding an uintptr to a decimal column")
+	}
+
+	// a named parameter and SetParameterFor
+	query := store.Query(BOOK).
+		Column(BOOK_C_NAME).
+		Where(BOOK_C_PRICE.Greater(Param("price")))
+	query.SetParameter("price", "cheap")
+	if _, err := query.ListInto(func(name string) string {
+		return name
+	}); err == nil {
+		t.Fatal("Expected an error binding a string to a decimal column")
+	}
+	query = store.Query(BOOK).
+		Column(BOOK_C_NAME).
+		Where(BOOK_C_PRICE.Greater(Param(BOOK_C_PRICE.GetAlias())))
+	query.SetParameterFor(BOOK_C_PRICE, 10.5)
+	names, err := query.ListInto(func(name string) string {
+		return name
+	})
+	if err != nil {
+		t.Fatalf("Failed TestStrictTypes: %s", err)
+	}
+	if len(names) != 2 {
+		t.Fatalf("Expected 2 books more expensive than 10.5, but got %v", names)
+	}
+
+	// enabled only for the statement
+	update := TM.Store().Update(BOOK).Set(BOOK_C_PRICE, "cheap").Where(BOOK_C_ID.Matches(1))
+	update.SetStrictTypes(true)
+	if _, err := update.Execute(); err == nil || !strings.Contains(err.Error(), "cannot be bound") {
+		t.Fatalf("Expected a strict types error, but got %v", err)
+	}
+	if TM.Store().IsStrictTypes() {
+		t.Fatal("Expected the other stores not to be strict")
+	}
+}
+
+func RunSubmitBatch(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	if err := TM.Transaction(func(store IDb) error {
+		publishers := []*Publisher{
+			{EntityBase: EntityBase{Id: ext.Int64(2), Version: 1}, Name: ext.String("Second")},
+			{EntityBase: EntityBase{Id: ext.Int64(1), Version: 1}, Name: ext.String("First")},
+		}
+		affectedRows, err := store.Update(PUBLISHER).SortBatch(true).SubmitBatch(publishers)
+		if err != nil {
+			t.Fatalf("Failed RunSubmitBatch: %s", err)
+		}
+		if affectedRows != 2 {
+			t.Fatalf("Expected 2 updated publishers, but got %v", affectedRows)
+		}
+		// the original slice is not reordered
+		if *publishers[0].Id != 2 || publishers[0].Version != 2 || publishers[1].Version != 2 {
+			t.Fatalf("Expected the versions to be incremented, but got %v and %v", publishers[0].Version, publishers[1].Version)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed RunSubmitBatch: %s", err)
+	}
+}
+
+func RunDryRun(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	dryRun := dbx.NewDryRun()
+	store.SetDryRun(dryRun)
+
+	affectedRows, err := store.Delete(BOOK).Where(BOOK_C_ID.Matches(1)).Execute()
+	if err != nil {
+		t.Fatalf("Failed TestDryRun: %s", err)
+	}
+	if affectedRows != 0 {
+		t.Fatalf("Expected 0 affected rows, but got %v", affectedRows)
+	}
+
+	statements := dryRun.Statements()
+	if len(statements) != 1 || !strings.Contains(strings.ToUpper(statements[0].Sql), "DELETE") {
+		t.Fatalf("Expected one DELETE statement, but got %v", statements)
+	}
+
+	// the book was not deleted
+	var book Book
+	ok, err := TM.Store().Query(BOOK).All().Where(BOOK_C_ID.Matches(1)).SelectTo(&book)
+	if err != nil {
+		t.Fatalf("Failed TestDryRun: %s", err)
+	}
+	if !ok {
+		t.Fatal("The book was deleted in a dry run")
+	}
+}
+
+func RunGeneratedSQL(TM ITransactionManager, t *testing.T) {
+	query := TM.Store().Query(BOOK).
+		Column(BOOK_C_NAME).
+		Where(BOOK_C_ID.Matches(Param("id")))
+	query.SetParameter("id", 1)
+
+	rsql, err := query.GetCachedSQL()
+	if err != nil {
+		t.Fatalf("Failed TestGeneratedSQL: %s", err)
+	}
+	rsql, values, err := query.BoundValues(rsql)
+	if err != nil {
+		t.Fatalf("Failed TestGeneratedSQL: %s", err)
+	}
+	if len(rsql.Names) != 1 || rsql.Names[0] != "id" || len(values) != 1 || values[0] != 1 {
+		t.Fatalf("Expected the parameter id=1, but got %v=%v", rsql.Names, values)
+	}
+}
+
+func RunCompositeKey(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	var authorId int64
+	ok, err := store.Query(AUTHOR_BOOK).
+		Column(AUTHOR_BOOK_C_AUTHOR_ID).
+		WhereKey(Key{AUTHOR_BOOK_C_BOOK_ID: 3, AUTHOR_BOOK_C_AUTHOR_ID: 2}).
+		SelectInto(&authorId)
+	if err != nil {
+		t.Fatalf("Failed TestCompositeKey: %s", err)
+	}
+	if !ok || authorId != 2 {
+		t.Fatalf("Expected author 2, but got %v", authorId)
+	}
+
+	// a partial key matches the first key column
+	var authorBook AuthorBook
+	ok, err = store.Retrive(&authorBook, 3)
+	if err != nil {
+		t.Fatalf("Failed TestCompositeKey: %s", err)
+	}
+	if !ok || *authorBook.AuthorId != 3 || *authorBook.BookId != 1 {
+		t.Fatalf("Expected the book 1 of the author 3, but got %+v", authorBook)
+	}
+
+	if err := TM.Transaction(func(store IDb) error {
+		deleted, err := store.Delete(AUTHOR_BOOK).WhereKey(1, 3).Execute()
+		if err != nil {
+			t.Fatalf("Failed TestCompositeKey: %s", err)
+		}
+		if deleted != 1 {
+			t.Fatalf("Expected 1 deleted row, but got %v", deleted)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed TestCompositeKey: %s", err)
+	}
+}
+
+func RunInTuple(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	var books []*Book
+	err := TM.Store().Query(BOOK).
+		All().
+		Where(InTuple([]*Column{BOOK_C_ID, BOOK_C_PUBLISHER_ID},
+			[]interface{}{1, 1},
+			[]interface{}{3, 2},
+			[]interface{}{2, 1}, // no match
+		)).
+		Order(BOOK_C_ID).
+		List(&books)
+	if err != nil {
+		t.Fatalf("Failed TestInTuple: %s", err)
+	}
+
+	if len(books) != 2 || *books[0].Id != 1 || *books[1].Id != 3 {
+		t.Fatalf("Expected books 1 and 3, but got %v", len(books))
+	}
+}
+
+func RunSelectedColumns(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	var books []*Book
+	err := TM.Store().Query(BOOK).
+		Column(BOOK_C_ID, BOOK_C_NAME).
+		Order(BOOK_C_ID).
+		List(&books)
+	if err != nil {
+		t.Fatalf("Failed TestSelectedColumns: %s", err)
+	}
+
+	if len(books) != 3 || books[0].Name == "" {
+		t.Fatalf("Expected 3 books with name, but got %v", len(books))
+	}
+	if books[0].Price != 0 || books[0].Published != nil {
+		t.Fatalf("Expected the price and the publishing date not to be read, but got %v and %v", books[0].Price, books[0].Published)
+	}
+}
+
+func RunOnScanError(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	query := store.Query(BOOK).
+		Column(BOOK_C_NAME).
+		Order(BOOK_C_ID)
+	rsql := query.Compile()
+	params := rsql.BuildValues(query.GetParameters())
+
+	transformer := func(rows *sql.Rows) (interface{}, error) {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if name == "Scrapbook" {
+			return nil, errors.New("Malformed book")
+		}
+		return name, nil
+	}
+
+	// without a handler the first error aborts the query
+	_, err := query.GetDba().Query(rsql.Sql, transformer, params...)
+	if err == nil {
+		t.Fatal("Expected TestOnScanError to fail without an error handler")
+	}
+
+	// the bad rows are skipped and the errors collected
+	var errs []error
+	dba := query.GetDba().OnScanError(func(err error) error {
+		errs = append(errs, err)
+		return nil
+	})
+	names, err := dba.Query(rsql.Sql, transformer, params...)
+	if err != nil {
+		t.Fatalf("Failed TestOnScanError: %s", err)
+	}
+	if len(names) != 2 || len(errs) != 1 {
+		t.Fatalf("Expected 2 names and 1 error, but got %v and %v", len(names), len(errs))
+	}
+}
+
+func RunTimeLocation(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	loc := time.FixedZone("GMT+3", 3*60*60)
+	store := TM.Store()
+	store.SetLocation(loc)
+
+	var books []*Book
+	err := store.Query(BOOK).
+		All().
+		Order(BOOK_C_ID).
+		List(&books)
+	if err != nil {
+		t.Fatalf("Failed TestTimeLocation: %s", err)
+	}
+	var id *int64
+	for _, book := range books {
+		if book.Published == nil {
+			continue
+		}
+		if book.Published.Location() != loc {
+			t.Fatalf("Expected the publishing date in %s, but got %s", loc, book.Published.Location())
+		}
+		if id == nil {
+			id = book.Id
+		}
+	}
+	if id == nil {
+		t.Fatal("Expected published books, but got none")
+	}
+
+	var published time.Time
+	ok, err := store.Query(BOOK).
+		Column(BOOK_C_PUBLISHED).
+		Where(BOOK_C_ID.Matches(*id)).
+		SelectInto(&published)
+	if err != nil {
+		t.Fatalf("Failed TestTimeLocation: %s", err)
+	}
+	if !ok || published.Location() != loc {
+		t.Fatalf("Expected a publishing date in %s, but got %s", loc, published.Location())
+	}
+}
+
+func RunNotCriteria(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	ids := func(criteria *Criteria) []int64 {
+		var books []*Book
+		err := TM.Store().Query(BOOK).
+			All().
+			Where(criteria).
+			Order(BOOK_C_ID).
+			List(&books)
+		if err != nil {
+			t.Fatalf("Failed TestNotCriteria: %s", err)
+		}
+		var result []int64
+		for _, book := range books {
+			result = append(result, *book.Id)
+		}
+		return result
+	}
+
+	// compound criteria
+	got := ids(Not(BOOK_C_PRICE.Greater(30).Or(BOOK_C_NAME.Like("Scrap%"))))
+	if len(got) != 1 || got[0] != 2 {
+		t.Fatalf("Expected the book 2, but got %v", got)
+	}
+
+	got = ids(BOOK_C_PUBLISHER_ID.Matches(2).And(BOOK_C_PRICE.Lesser(10)).Not())
+	if len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Fatalf("Expected the books 1 and 2, but got %v", got)
+	}
+
+	got = ids(BOOK_C_ID.In(1, 2).Not())
+	if len(got) != 1 || got[0] != 3 {
+		t.Fatalf("Expected the book 3, but got %v", got)
+	}
+}
+
+func RunGreatestLeast(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	var greatest, least float64
+	var greatests, leasts []float64
+	err := TM.Store().Query(BOOK).
+		Column(
+			Greatest(BOOK_C_PRICE, AsIs(20)),
+			Least(BOOK_C_PRICE, Multiply(BOOK_C_ID, AsIs(5))),
+		).
+		Order(BOOK_C_ID).
+		ListSimple(func() {
+			greatests = append(greatests, greatest)
+			leasts = append(leasts, least)
+		}, &greatest, &least)
+	if err != nil {
+		t.Fatalf("Failed TestGreatestLeast: %s", err)
+	}
+
+	if len(greatests) != 3 || greatests[0] != 34.5 || greatests[1] != 20 || greatests[2] != 20 {
+		t.Fatalf("Expected the greatest values [34.5 20 20], but got %v", greatests)
+	}
+	if len(leasts) != 3 || leasts[0] != 5 || leasts[1] != 10 || leasts[2] != 6.5 {
+		t.Fatalf("Expected the least values [5 10 6.5], but got %v", leasts)
+	}
+
+	// the CASE fallbacks, for the databases without GREATEST and LEAST
+	tx, ok := TM.Store().GetTranslator().(interface {
+		RegisterTranslation(name string, handler func(dmlType DmlType, token Tokener, tx Translator) string)
+		GreatestAsCase(dmlType DmlType, token Tokener, tx Translator) string
+		LeastAsCase(dmlType DmlType, token Tokener, tx Translator) string
+	})
+	if !ok {
+		return
+	}
+	tx.RegisterTranslation("TEST_GREATEST_CASE", tx.GreatestAsCase)
+	tx.RegisterTranslation("TEST_LEAST_CASE", tx.LeastAsCase)
+	greatests, leasts = nil, nil
+	err = TM.Store().Query(BOOK).
+		Column(
+			NewToken("TEST_GREATEST_CASE", BOOK_C_PRICE, AsIs(20), AsIs(10)),
+			NewToken("TEST_LEAST_CASE", BOOK_C_PRICE, Multiply(BOOK_C_ID, AsIs(5))),
+		).
+		Order(BOOK_C_ID).
+		ListSimple(func() {
+			greatests = append(greatests, greatest)
+			leasts = append(leasts, least)
+		}, &greatest, &least)
+	if err != nil {
+		t.Fatalf("Failed TestGreatestLeast: %s", err)
+	}
+	if len(greatests) != 3 || greatests[0] != 34.5 || greatests[1] != 20 || greatests[2] != 20 {
+		t.Fatalf("Expected the CASE greatest values [34.5 20 20], but got %v", greatests)
+	}
+	if len(leasts) != 3 || leasts[0] != 5 || leasts[1] != 10 || leasts[2] != 6.5 {
+		t.Fatalf("Expected the CASE least values [5 10 6.5], but got %v", leasts)
+	}
+}
+
+func RunDeferredParameter(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	// the value is only known at execution time
+	var current int64
+	query := TM.Store().Query(BOOK).
+		Column(BOOK_C_NAME).
+		Where(BOOK_C_ID.Matches(Param("id")))
+	query.SetParameter("id", func() interface{} {
+		return current
+	})
+
+	var name string
+	for id, expected := range map[int64]string{2: "Cookbook", 3: "Scrapbook"} {
+		current = id
+		ok, err := query.SelectInto(&name)
+		if err != nil {
+			t.Fatalf("Failed TestDeferredParameter: %s", err)
+		}
+		if !ok || name != expected {
+			t.Fatalf("Expected %s, but got %s", expected, name)
+		}
+	}
+}
+
+func RunSchemaMapping(TM ITransactionManager, t *testing.T) {
+	store := TM.Store()
+	// the tables without schema are rendered in the tenant schema
+	store.MapSchema("", "tenant")
+
+	rsql, err := store.Query(BOOK).
+		All().
+		Inner(BOOK_A_PUBLISHER).
+		Join().
+		GetCachedSQL()
+	if err != nil {
+		t.Fatalf("Failed TestSchemaMapping: %s", err)
+	}
+	if strings.Count(strings.ToUpper(rsql.OriSql), "TENANT") != 2 {
+		t.Fatalf("Expected the tables in the tenant schema, but got %s", rsql.OriSql)
+	}
+
+	// other stores are not affected
+	rsql, err = TM.Store().Query(BOOK).All().GetCachedSQL()
+	if err != nil {
+		t.Fatalf("Failed TestSchemaMapping: %s", err)
+	}
+	if strings.Contains(strings.ToUpper(rsql.OriSql), "TENANT") {
+		t.Fatalf("Expected the tables without schema, but got %s", rsql.OriSql)
+	}
+}
+
+func RunAnyAll(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	prices := func() *Query {
+		return store.Query(BOOK).Alias("b").
+			Column(BOOK_C_PRICE).
+			Where(BOOK_C_PUBLISHER_ID.Matches(2))
+	}
+	ids := func(criteria *Criteria) []int64 {
+		var books []*Book
+		err := store.Query(BOOK).
+			All().
+			Where(criteria).
+			Order(BOOK_C_ID).
+			List(&books)
+		if err != nil {
+			t.Fatalf("Failed TestAnyAll: %s", err)
+		}
+		var result []int64
+		for _, book := range books {
+			result = append(result, *book.Id)
+		}
+		return result
+	}
+
+	got := ids(BOOK_C_PRICE.Greater(AllOf(prices())))
+	if len(got) != 1 || got[0] != 1 {
+		t.Fatalf("Expected the book 1, but got %v", got)
+	}
+
+	got = ids(BOOK_C_PRICE.Matches(AnyOf(prices())))
+	if len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Fatalf("Expected the books 2 and 3, but got %v", got)
+	}
+
+	// = ANY is translated as IN
+	rsql, err := store.Query(BOOK).
+		Column(BOOK_C_ID).
+		Where(BOOK_C_PRICE.Matches(AnyOf(prices()))).
+		GetCachedSQL()
+	if err != nil {
+		t.Fatalf("Failed TestAnyAll: %s", err)
+	}
+	if !strings.Contains(rsql.OriSql, " IN (") || strings.Contains(rsql.OriSql, "ANY") {
+		t.Fatalf("Expected = ANY translated as IN, but got %s", rsql.OriSql)
+	}
+}
+
+func RunListOrderedMaps(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	query := TM.Store().Query(BOOK).
+		Column(BOOK_C_NAME, BOOK_C_ID, BOOK_C_PRICE).
+		Order(BOOK_C_ID)
+	rows, err := query.ListOrderedMaps()
+	if err != nil {
+		t.Fatalf("Failed TestListOrderedMaps: %s", err)
+	}
+
+	if len(rows) != 3 {
+		t.Fatalf("Expected 3 rows, but got %v", len(rows))
+	}
+	if columns := fmt.Sprint(rows[0].Columns); columns != "[Name Id Price]" {
+		t.Fatalf("Expected the columns [Name Id Price], but got %s", columns)
+	}
+	if name, _ := rows[0].Get("Name"); fmt.Sprint(name) != "Once Upon a Time..." || rows[0].Values[0] != name {
+		t.Fatalf("Expected the name in the first position, but got %v", rows[0].Values)
+	}
+
+	// native SQL uses the column names of the driver
+	rsql := query.Compile()
+	rows, err = query.GetDba().QueryOrderedMaps(rsql.Sql, rsql.BuildValues(query.GetParameters())...)
+	if err != nil {
+		t.Fatalf("Failed TestListOrderedMaps: %s", err)
+	}
+	if len(rows) != 3 || len(rows[0].Columns) != 3 || fmt.Sprint(rows[0].Values[0]) != "Once Upon a Time..." {
+		t.Fatalf("Expected 3 rows with the name first, but got %v", rows)
+	}
+}
+
+func RunQueryCSV(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	query := TM.Store().Query(BOOK).
+		Column(BOOK_C_NAME, BOOK_C_PRICE).
+		Order(BOOK_C_ID)
+	rsql := query.Compile()
+
+	var sb strings.Builder
+	err := query.GetDba().QueryCSV(&sb, dbx.CSVOptions{Comma: ';'}, rsql.Sql, rsql.BuildValues(query.GetParameters())...)
+	if err != nil {
+		t.Fatalf("Failed TestQueryCSV: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected a header and 3 records, but got %v", lines)
+	}
+	if !strings.HasPrefix(lines[1], "Once Upon a Time...;34.5") {
+		t.Fatalf("Expected the first book, but got %s", lines[1])
+	}
+}
+
+func RunRawSQL(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	err := TM.Transaction(func(store IDb) error {
+		tx := store.GetTranslator()
+		// the SQL is native, so it is built with the names and the placeholder of the database
+		update := fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s = %s",
+			tx.TableName(BOOK), tx.ColumnName(BOOK_C_PRICE), tx.GetPlaceholder(0, ""),
+			tx.ColumnName(BOOK_C_ID), tx.GetPlaceholder(1, ""))
+		result, err := store.ExecRaw(update, 99.5, 2)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected != 1 {
+			t.Fatalf("Expected 1 updated row, but got %v", affected)
+		}
+
+		query := fmt.Sprintf("SELECT %s FROM %s WHERE %s = %s",
+			tx.ColumnName(BOOK_C_PRICE), tx.TableName(BOOK), tx.ColumnName(BOOK_C_ID), tx.GetPlaceholder(0, ""))
+		var price float64
+		if _, err = store.QueryRaw(query, func(p float64) {
+			price = p
+		}, 2); err != nil {
+			return err
+		}
+		if price != 99.5 {
+			t.Fatalf("Expected the price 99.5, but got %v", price)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed TestRawSQL: %s", err)
+	}
+}
+
+func RunInsertDefault(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	err := TM.Transaction(func(store IDb) error {
+		// the key and the publishing date are left to the database
+		key, err := store.Insert(BOOK).
+			Columns(BOOK_C_ID, BOOK_C_VERSION, BOOK_C_NAME, BOOK_C_PUBLISHED, BOOK_C_PRICE).
+			Values(Default(), 1, "Defaults", Default(), 10.5).
+			Execute()
+		if err != nil {
+			return err
+		}
+		if key == 0 {
+			t.Fatal("The Auto Insert Key for a DEFAULT ID column was not retrived")
+		}
+
+		var book Book
+		ok, err := store.Query(BOOK).All().Where(BOOK_C_ID.Matches(key)).SelectTo(&book)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			t.Fatalf("Expected the book with the id %v", key)
+		}
+		if book.Name != "Defaults" || book.Price != 10.5 {
+			t.Fatalf("Expected the book Defaults with the price 10.5, but got %s and %v", book.Name, book.Price)
+		}
+		if book.Published != nil {
+			t.Fatalf("Expected a null publishing date, but got %v", book.Published)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed TestInsertDefault: %s", err)
+	}
+}
+
+func RunMaxJoinDepth(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	var publishers []*Publisher
+	err := store.Query(PUBLISHER).
+		MaxJoinDepth(2).
+		All().
+		Outer(PUBLISHER_A_BOOKS, BOOK_A_AUTHORS).
+		Fetch().
+		Order(PUBLISHER_C_NAME).
+		ListFlatTree(&publishers)
+	if err != nil {
+		t.Fatalf("Failed TestMaxJoinDepth: %s", err)
+	}
+	if len(publishers) == 0 {
+		t.Fatal("Expected publishers, but got none")
+	}
+
+	exceeded := func() (failed bool) {
+		defer func() {
+			failed = recover() != nil
+		}()
+		store.Query(PUBLISHER).
+			MaxJoinDepth(1).
+			All().
+			Outer(PUBLISHER_A_BOOKS, BOOK_A_AUTHORS).
+			Fetch()
+		return
+	}
+	if !exceeded() {
+		t.Fatal("Expected a join path deeper than the max join depth to be rejected")
+	}
+
+	// the clone keeps the limit
+	clone := store.Query(PUBLISHER).MaxJoinDepth(1).Clone().(*Query)
+	exceeded = func() (failed bool) {
+		defer func() {
+			failed = recover() != nil
+		}()
+		clone.All().
+			Outer(PUBLISHER_A_BOOKS, BOOK_A_AUTHORS).
+			Fetch()
+		return
+	}
+	if !exceeded() {
+		t.Fatal("Expected the clone to reject a join path deeper than the max join depth")
+	}
+}
+
+func RunUpdateAndFetch(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	err := TM.Transaction(func(store IDb) error {
+		list, err := store.Update(BOOK).
+			Set(BOOK_C_PRICE, 20.5).
+			Where(BOOK_C_PUBLISHER_ID.Matches(2)).
+			UpdateAndFetch(dbx.NewMapTransformer().Ordered(true))
+		if err != nil {
+			return err
+		}
+		rows := dbx.OrderedRows(list)
+		if len(rows) != 2 {
+			t.Fatalf("Expected 2 updated books, but got %v", len(rows))
+		}
+		for _, row := range rows {
+			if len(row.Values) != BOOK.GetColumns().Size() {
+				t.Fatalf("Expected all the book columns, but got %v", row.Columns)
+			}
+		}
+
+		var prices []float64
+		if _, err = store.Query(BOOK).
+			Column(BOOK_C_PRICE).
+			Where(BOOK_C_PUBLISHER_ID.Matches(2)).
+			ListInto(func(price float64) {
+				prices = append(prices, price)
+			}); err != nil {
+			return err
+		}
+		for _, price := range prices {
+			if price != 20.5 {
+				t.Fatalf("Expected the price 20.5, but got %v", price)
+			}
+		}
+
+		// without RETURNING, the rows are fetched by their keys before the update
+		update := store.Update(BOOK).
+			Set(BOOK_C_ID, BOOK_C_ID).
+			Where(BOOK_C_ID.Matches(1))
+		returning := store.GetTranslator().GetSqlForUpdateReturning(update, []*Column{BOOK_C_ID}) != ""
+		_, err = update.UpdateAndFetch(dbx.NewMapTransformer())
+		if returning && err != nil {
+			return err
+		}
+		if !returning && err == nil {
+			t.Fatal("Expected an error setting a key column without RETURNING")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed TestUpdateAndFetch: %s", err)
+	}
+}
+
+func RunIdentifierCase(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	tx := store.GetTranslator()
+	query := fmt.Sprintf("SELECT %s, %s FROM %s ORDER BY %s",
+		tx.ColumnName(BOOK_C_ID), tx.ColumnName(BOOK_C_NAME), tx.TableName(BOOK), tx.ColumnName(BOOK_C_ID))
+	// the database can return the column names in another case (ex: Postgres lowercases them)
+	list, err := dbx.NewSimpleDBA(store.GetConnection()).
+		QueryCollection(query, NewDeclaredMapTransformer(tx, BOOK_C_ID, BOOK_C_NAME))
+	if err != nil {
+		t.Fatalf("Failed TestIdentifierCase: %s", err)
+	}
+
+	if list.Size() != 3 {
+		t.Fatalf("Expected 3 books, but got %v", list.Size())
+	}
+	row := list.Elements()[0].(map[string]interface{})
+	if name, ok := row[BOOK_C_NAME.GetName()]; !ok || name != "Once Upon a Time..." {
+		t.Fatalf("Expected the key %s with the value Once Upon a Time..., but got %v", BOOK_C_NAME.GetName(), row)
+	}
+
+	// the sql tags are matched with the folded column names
+	var names []string
+	if _, err := store.QueryRaw(query, func(book *struct {
+		Id   int64  `sql:"Id"`
+		Name string `sql:"Name"`
+	}) {
+		names = append(names, book.Name)
+	}); err != nil {
+		t.Fatalf("Failed TestIdentifierCase: %s", err)
+	}
+	if len(names) != 3 || names[0] != "Once Upon a Time..." {
+		t.Fatalf("Expected the 3 book names, but got %v", names)
+	}
+}
+
+func RunStatementComment(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	store.SetComment("app=test,req=abc123")
+	dryRun := dbx.NewDryRun()
+	store.SetDryRun(dryRun)
+	if _, err := store.Delete(BOOK).Where(BOOK_C_ID.Matches(1)).Execute(); err != nil {
+		t.Fatalf("Failed TestStatementComment: %s", err)
+	}
+	statements := dryRun.Statements()
+	if len(statements) != 1 || !strings.HasSuffix(statements[0].Sql, " /* app=test,req=abc123 */") {
+		t.Fatalf("Expected one statement with the comment, but got %v", statements)
+	}
+
+	// the database accepts the comment
+	err := TM.Transaction(func(store IDb) error {
+		store.SetComment("app=test,req=abc123")
+		var name string
+		ok, err := store.Query(BOOK).Column(BOOK_C_NAME).Where(BOOK_C_ID.Matches(1)).SelectInto(&name)
+		if err != nil {
+			return err
+		}
+		if !ok || name != "Once Upon a Time..." {
+			t.Fatalf("Expected the book Once Upon a Time..., but got %s", name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed TestStatementComment: %s", err)
+	}
+}
+
+func RunMockConnection(TM ITransactionManager, t *testing.T) {
+	// only the translator of the database is used
+	mock := dbx.NewMockConnection()
+	store := NewDb(new(bool), mock, TM.Store().GetTranslator())
+
+	query := store.Query(BOOK).Column(BOOK_C_NAME).Where(BOOK_C_ID.Matches(1))
+	rsql, err := query.GetCachedSQL()
+	if err != nil {
+		t.Fatalf("Failed TestMockConnection: %s", err)
+	}
+	rsql, params, err := query.BoundValues(rsql)
+	if err != nil {
+		t.Fatalf("Failed TestMockConnection: %s", err)
+	}
+	mock.Expect(rsql.Sql).
+		WithParams(params...).
+		WillReturnRows(dbx.NewRowSet("NAME").AddRow("Mocked"))
+
+	var name string
+	ok, err := query.SelectInto(&name)
+	if err != nil {
+		t.Fatalf("Failed TestMockConnection: %s", err)
+	}
+	if !ok || name != "Mocked" {
+		t.Fatalf("Expected the name Mocked, but got %s", name)
+	}
+	if err = mock.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	// not expected
+	if _, err = store.Delete(BOOK).Execute(); err == nil {
+		t.Fatal("Expected an error for an unexpected statement")
+	}
+	if calls := mock.Calls(); len(calls) != 2 {
+		t.Fatalf("Expected 2 executed statements, but got %v", calls)
+	}
+	if err = mock.Close(); err != nil {
+		t.Fatalf("Failed TestMockConnection: %s", err)
+	}
+}
+
+func RunFromSQL(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	rsql, values, err := store.Query(BOOK).
+		Inner(BOOK_A_PUBLISHER).Join().
+		Where(PUBLISHER_C_ID.Matches(2)).
+		FromSQL()
+	if err != nil {
+		t.Fatalf("Failed TestFromSQL: %s", err)
+	}
+	if !strings.HasPrefix(rsql.Sql, "FROM ") || len(values) != 1 {
+		t.Fatalf("Expected a FROM with one parameter, but got %s %v", rsql.Sql, values)
+	}
+
+	// reused in a hand written statement
+	var count int64
+	if _, err = store.QueryRaw("SELECT COUNT(*) "+rsql.Sql, func(c int64) {
+		count = c
+	}, values...); err != nil {
+		t.Fatalf("Failed TestFromSQL: %s", err)
+	}
+	if count != 2 {
+		t.Fatalf("Expected 2 books of the publisher 2, but got %v", count)
+	}
+}
+
+func RunLimitWithTies(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	query := TM.Store().Query(BOOK).
+		Column(BOOK_C_NAME).
+		Order(BOOK_C_PUBLISHER_ID).
+		LimitWithTies(2)
+	if _, err := query.GetCachedSQL(); err != nil {
+		// not supported by the database
+		if !strings.Contains(err.Error(), "WITH TIES") {
+			t.Fatalf("Failed TestLimitWithTies: %s", err)
+		}
+		return
+	}
+
+	var names []string
+	if _, err := query.ListInto(func(name string) {
+		names = append(names, name)
+	}); err != nil {
+		t.Fatalf("Failed TestLimitWithTies: %s", err)
+	}
+	// the second and the third books have the same publisher
+	if len(names) != 3 {
+		t.Fatalf("Expected 3 books, but got %v", names)
+	}
+}
+
+func RunEncryptedColumn(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	keys := &KeyRing{
+		Current: "k1",
+		Keys:    map[string][]byte{"k1": []byte("0123456789abcdef0123456789abcdef")},
+	}
+	// the same table, with the name encrypted
+	encBook := TABLE("BOOK")
+	// TABLE registers the declaration as the table of Book
+	defer AddEntity(BOOK)
+	encBookId := encBook.KEY("ID")
+	encBookVersion := encBook.VERSION("VERSION")
+	encBookName := encBook.COLUMN("NAME").Encrypt(keys)
+
+	err := TM.Transaction(func(store IDb) error {
+		key, err := store.Insert(encBook).
+			Columns(encBookId, encBookVersion, encBookName).
+			Values(nil, 1, "Top Secret").
+			Execute()
+		if err != nil {
+			return err
+		}
+
+		// stored encrypted, with the key id
+		var stored string
+		if _, err = store.Query(BOOK).Column(BOOK_C_NAME).Where(BOOK_C_ID.Matches(key)).SelectInto(&stored); err != nil {
+			return err
+		}
+		if KeyId(stored) != "k1" || strings.Contains(stored, "Top Secret") {
+			t.Fatalf("Expected the name encrypted with the key k1, but got %s", stored)
+		}
+
+		// after a key rotation, the old values are still decrypted
+		keys.Keys["k2"] = []byte("fedcba9876543210fedcba9876543210")
+		keys.Current = "k2"
+		var book Book
+		if _, err = store.Query(encBook).All().Where(encBookId.Matches(key)).SelectTo(&book); err != nil {
+			return err
+		}
+		if book.Name != "Top Secret" {
+			t.Fatalf("Expected the decrypted name Top Secret, but got %s", book.Name)
+		}
+
+		// NULL is stored and read back as NULL
+		key, err = store.Insert(encBook).
+			Columns(encBookId, encBookVersion, encBookName).
+			Values(nil, 1, nil).
+			Execute()
+		if err != nil {
+			return err
+		}
+		var nameless struct {
+			Id   *int64
+			Name *string
+		}
+		if _, err = store.Query(encBook).Column(encBookId, encBookName).Where(encBookId.Matches(key)).SelectTo(&nameless); err != nil {
+			return err
+		}
+		if nameless.Id == nil || nameless.Name != nil {
+			t.Fatalf("Expected the book %v without name, but got %+v", key, nameless)
+		}
+		book = Book{}
+		if _, err = store.Query(encBook).All().Where(encBookId.Matches(key)).SelectTo(&book); err != nil {
+			return err
+		}
+		if book.Name != "" {
+			t.Fatalf("Expected the book %v without name, but got %s", key, book.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed TestEncryptedColumn: %s", err)
+	}
+
+	// the encrypted values cannot be compared
+	rejected := func() (failed bool) {
+		defer func() {
+			failed = recover() != nil
+		}()
+		encBookName.Matches("Top Secret")
+		return
+	}
+	if !rejected() {
+		t.Fatal("Expected a criteria with an encrypted column to be rejected")
+	}
+	encBookName.IsNull()
+}
+
+func RunStringAgg(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	var dtos []*Dto
+	err := store.Query(PUBLISHER).
+		Column(PUBLISHER_C_NAME).
+		Inner(PUBLISHER_A_BOOKS).
+		Include(StringAgg(BOOK_C_NAME, ", ")).As("OtherName").
+		Join().
+		GroupByPos(1).
+		List(&dtos)
+
+	if err != nil {
+		t.Fatalf("Failed RunStringAgg: %s", err)
+	}
+
+	if len(dtos) != 2 {
+		t.Fatalf("Expected 2 Publishers, but got %v", len(dtos))
+	}
+
+	expected := map[string]string{
+		PUBLISHER_UTF8_NAME: "Cookbook, Scrapbook",
+		"Geek Publications": "Once Upon a Time...",
+	}
+	for _, v := range dtos {
+		// the order is only guaranteed with an ORDER BY, that is not supported by every database
+		names := strings.Split(v.OtherName, ", ")
+		sort.Strings(names)
+		if got := strings.Join(names, ", "); got != expected[v.Name] {
+			t.Fatalf("Expected the books %q for %s, but got %q", expected[v.Name], v.Name, got)
+		}
+	}
+}
+
+func RunCountDistinct(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	var count int64
+	ok, err := store.Query(PUBLISHER).
+		CountDistinct(nil).
+		Inner(PUBLISHER_A_BOOKS).
+		Join().
+		SelectInto(&count)
+	if err != nil {
+		t.Fatalf("Failed RunCountDistinct: %s", err)
+	}
+	// publisher 2 has two books
+	if !ok || count != 2 {
+		t.Fatalf("Expected 2 publishers, but got %v", count)
+	}
+
+	ok, err = store.Query(PUBLISHER).
+		CountDistinct(PUBLISHER_C_ID).
+		Inner(PUBLISHER_A_BOOKS).
+		On(BOOK_C_PRICE.Lesser(20)).
+		Join().
+		SelectInto(&count)
+	if err != nil {
+		t.Fatalf("Failed RunCountDistinct: %s", err)
+	}
+	if !ok || count != 1 {
+		t.Fatalf("Expected 1 publisher, but got %v", count)
+	}
+}
+
+func RunOrderByAlias(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	var dtos []*Dto
+	err := store.Query(PUBLISHER).
+		Column(PUBLISHER_C_NAME).As("Name").
+		Outer(PUBLISHER_A_BOOKS).
+		Include(Sum(BOOK_C_PRICE)).As("Value").
+		Join().
+		GroupByPos(1).
+		OrderByAs("Value").Desc().
+		List(&dtos)
+	if err != nil {
+		t.Fatalf("Failed RunOrderByAlias: %s", err)
+	}
+	if len(dtos) != 2 || dtos[0].Name != "Geek Publications" || dtos[1].Name != PUBLISHER_UTF8_NAME {
+		t.Fatalf("Expected the publishers ordered by the total of the sales, but got %+v", dtos)
+	}
+
+	// inside an expression the column is repeated
+	dtos = nil
+	err = store.Query(PUBLISHER).
+		Column(PUBLISHER_C_NAME).As("Name").
+		OrderByAs("Name").IgnoreCase().
+		List(&dtos)
+	if err != nil {
+		t.Fatalf("Failed RunOrderByAlias: %s", err)
+	}
+	if len(dtos) != 2 || dtos[0].Name != PUBLISHER_UTF8_NAME || dtos[1].Name != "Geek Publications" {
+		t.Fatalf("Expected the publishers ordered by name, but got %+v", dtos)
+	}
+}
+
+// bytesConverter returns the column value as bytes, like some drivers do with text columns
+type bytesConverter struct{}
+
+func (bytesConverter) ToDb(in interface{}) (interface{}, error) {
+	return in, nil
+}
+
+func (bytesConverter) FromDbInstance() interface{} {
+	return new([]byte)
+}
+
+func (bytesConverter) FromDb(in interface{}) (interface{}, error) {
+	return *in.(*[]byte), nil
+}
+
+func RunBytesAsString(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	// the same table, with the name read as bytes
+	bytesPublisher := TABLE("PUBLISHER")
+	// TABLE registers the declaration as the table of Publisher
+	defer AddEntity(PUBLISHER)
+	bytesPublisherId := bytesPublisher.KEY("ID")
+	bytesPublisher.VERSION("VERSION")
+	bytesPublisher.COLUMN("NAME").Convert(bytesConverter{})
+
+	store := TM.Store()
+	var publisher Publisher
+	ok, err := store.Query(bytesPublisher).
+		All().
+		Where(bytesPublisherId.Matches(2)).
+		SelectTo(&publisher)
+	if err != nil {
+		t.Fatalf("Failed RunBytesAsString: %s", err)
+	}
+	if !ok || publisher.Name == nil || *publisher.Name != PUBLISHER_UTF8_NAME {
+		t.Fatalf("Expected the publisher name %s, but got %+v", PUBLISHER_UTF8_NAME, publisher)
+	}
+}
+
+func RunTruncate(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	err := TM.Transaction(func(store IDb) error {
+		// inside a transaction, databases where the truncate commits use a delete
+		if err := store.Truncate(BOOK_I18N).Execute(); err != nil {
+			return err
+		}
+
+		var count int64
+		if _, err := store.Query(BOOK_I18N).CountAll().SelectInto(&count); err != nil {
+			return err
+		}
+		if count != 0 {
+			t.Fatalf("Expected no translations after the truncate, but got %v", count)
+		}
+
+		// an option the database does not support is an error, not a panic
+		if err := store.Truncate(BOOK_I18N).RestartIdentity().Execute(); err != nil && !strings.Contains(err.Error(), "not supported") {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed RunTruncate: %s", err)
+	}
+}
+
+func RunWhereIf(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	// the filters of a search form, where only the price was filled
+	var name string
+	var publisherId *int64
+	maxPrice := 20.0
+
+	var books []*Book
+	err := store.Query(BOOK).
+		All().
+		WhereIfSet(
+			BOOK_C_NAME.Matches(name),
+			BOOK_C_PUBLISHER_ID.Matches(publisherId),
+			BOOK_C_PRICE.Lesser(maxPrice),
+		).
+		List(&books)
+	if err != nil {
+		t.Fatalf("Failed RunWhereIf: %s", err)
+	}
+	if len(books) != 2 {
+		t.Fatalf("Expected 2 books, but got %v", len(books))
+	}
+
+	books = nil
+	err = store.Query(BOOK).
+		All().
+		Where(BOOK_C_PRICE.Lesser(maxPrice)).
+		WhereIf(name != "", BOOK_C_NAME.Matches(name)).
+		WhereIf(true, BOOK_C_NAME.Matches("Cookbook")).
+		List(&books)
+	if err != nil {
+		t.Fatalf("Failed RunWhereIf: %s", err)
+	}
+	if len(books) != 1 || books[0].Name != "Cookbook" {
+		t.Fatalf("Expected the book Cookbook, but got %+v", books)
+	}
+}
+
+func RunTransactionWith(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	opts := &sql.TxOptions{Isolation: sql.LevelSerializable}
+	err := TM.TransactionWith(opts, func(store IDb) error {
+		var price float64
+		if _, err := store.Query(BOOK).Column(BOOK_C_PRICE).Where(BOOK_C_ID.Matches(2)).SelectInto(&price); err != nil {
+			return err
+		}
+		_, err := store.Update(BOOK).Set(BOOK_C_PRICE, price+1).Where(BOOK_C_ID.Matches(2)).Execute()
+		return err
+	})
+	if err != nil && strings.Contains(err.Error(), "not support") {
+		// older drivers only support the default isolation level
+		logger.Infof("RunTransactionWith skipped: %s", err)
+		return
+	}
+	if err != nil {
+		t.Fatalf("Failed RunTransactionWith: %s", err)
+	}
+
+	var price float64
+	TM.Store().Query(BOOK).Column(BOOK_C_PRICE).Where(BOOK_C_ID.Matches(2)).SelectInto(&price)
+	if price != 13.5 {
+		t.Fatalf("Expected the price 13.5, but got %v", price)
+	}
+}
+
+func RunCheckPlaceholders(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	dbx.CHECK_PLACEHOLDERS = true
+	defer func() {
+		dbx.CHECK_PLACEHOLDERS = false
+	}()
+
+	store := TM.Store()
+	ph := store.GetTranslator().GetPlaceholder(1, "id")
+	_, err := store.ExecRaw("UPDATE BOOK SET PRICE = PRICE WHERE ID = " + ph)
+	if err == nil || !strings.Contains(err.Error(), "placeholders for 1 parameters, but 0 were supplied") {
+		t.Fatalf("Expected the error of the missing parameter, but got %v", err)
+	}
+
+	// the statements of the builders have the right number of parameters
+	var name string
+	if _, err = store.Query(BOOK).Column(BOOK_C_NAME).Where(BOOK_C_ID.Matches(2)).SelectInto(&name); err != nil {
+		t.Fatalf("Failed RunCheckPlaceholders: %s", err)
+	}
+	if name != "Cookbook" {
+		t.Fatalf("Expected the book Cookbook, but got %s", name)
+	}
+}
+
+func RunCommonTable(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	cheap := TABLE("CHEAP_BOOK")
+	cheap.KEY("ID")
+	cheapName := cheap.COLUMN("NAME")
+
+	store := TM.Store()
+	cheapBooks := store.Query(BOOK).
+		Alias("c").
+		Column(BOOK_C_ID, BOOK_C_NAME).
+		Where(BOOK_C_PRICE.Lesser(10))
+
+	// the WITH clause cannot be part of the FROM
+	if _, _, err := store.Query(cheap).
+		With(cheap, cheapBooks).
+		Column(cheapName).
+		FromSQL(); err == nil {
+		t.Fatal("Expected FromSQL to reject a query with common tables")
+	}
+
+	var names []string
+	var err error
+	if !supported(func() {
+		_, err = store.Query(cheap).
+			WithMaterialization(cheap, cheapBooks, MATERIALIZED).
+			Column(cheapName).
+			ListInto(func(name string) {
+				names = append(names, name)
+			})
+	}) {
+		// MySQL 5
+		return
+	}
+	if err != nil {
+		t.Fatalf("Failed RunCommonTable: %s", err)
+	}
+	if len(names) != 1 || names[0] != "Scrapbook" {
+		t.Fatalf("Expected the book Scrapbook, but got %v", names)
+	}
+}
+
+func RunPing(TM ITransactionManager, t *testing.T) {
+	store := TM.Store()
+	if err := store.Ping(context.Background()); err != nil {
+		t.Fatalf("Failed RunPing: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := store.Ping(ctx); err == nil {
+		t.Fatal("Expected an error pinging with a canceled context")
+	}
+}
+
+func RunBoolAs(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	// the address holds a flag as Y/N
+	flagPublisher := TABLE("PUBLISHER")
+	// TABLE registers the declaration as the table of Publisher
+	defer AddEntity(PUBLISHER)
+	flagPublisherId := flagPublisher.KEY("ID")
+	flagPublisherFlag := flagPublisher.COLUMN("ADDRESS").BoolAs("Y", "N")
+
+	store := TM.Store()
+	if _, err := store.Update(flagPublisher).Set(flagPublisherFlag, true).Where(flagPublisherId.Matches(1)).Execute(); err != nil {
+		t.Fatalf("Failed RunBoolAs: %s", err)
+	}
+
+	var stored string
+	if _, err := store.Query(flagPublisher).Column(flagPublisherFlag).Where(flagPublisherId.Matches(1)).SelectInto(&stored); err != nil {
+		t.Fatalf("Failed RunBoolAs: %s", err)
+	}
+	if stored != "Y" {
+		t.Fatalf("Expected the flag stored as Y, but got %s", stored)
+	}
+
+	var flags []*struct {
+		Id      *int64
+		Address bool
+	}
+	if err := store.Query(flagPublisher).Column(flagPublisherId, flagPublisherFlag).Where(flagPublisherFlag.Matches(true)).List(&flags); err != nil {
+		t.Fatalf("Failed RunBoolAs: %s", err)
+	}
+	if len(flags) != 1 || *flags[0].Id != 1 || !flags[0].Address {
+		t.Fatalf("Expected the publisher 1 with the flag set, but got %+v", flags)
+	}
+
+	// the publisher 2 has no flag
+	var unset struct {
+		Id      *int64
+		Address *bool
+	}
+	if _, err := store.Query(flagPublisher).Column(flagPublisherId, flagPublisherFlag).Where(flagPublisherId.Matches(2)).SelectTo(&unset); err != nil {
+		t.Fatalf("Failed RunBoolAs: %s", err)
+	}
+	if unset.Id == nil || unset.Address != nil {
+		t.Fatalf("Expected the publisher 2 without flag, but got %+v", unset)
+	}
+	if err := store.Query(flagPublisher).Column(flagPublisherId, flagPublisherFlag).Order(flagPublisherId).List(&flags); err != nil {
+		t.Fatalf("Failed RunBoolAs: %s", err)
+	}
+	if len(flags) != 2 || !flags[0].Address || flags[1].Address {
+		t.Fatalf("Expected the publisher 2 read as false, but got %+v", flags)
+	}
+}
+
+func RunIntoTable(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	cheap := TABLE("CHEAP_BOOK_COPY")
+	cheapId := cheap.KEY("ID")
+	cheapName := cheap.COLUMN("NAME")
+
+	store := TM.Store()
+	_, err := store.Query(BOOK).
+		Column(BOOK_C_ID, BOOK_C_NAME).
+		Where(BOOK_C_PRICE.Lesser(10)).
+		IntoTable(cheap)
+	if err != nil && strings.Contains(err.Error(), "not supported") {
+		logger.Infof("RunIntoTable skipped: %s", err)
+		return
+	}
+	if err != nil {
+		t.Fatalf("Failed RunIntoTable: %s", err)
+	}
+	defer store.ExecRaw("DROP TABLE " + store.GetTranslator().TableName(cheap))
+
+	var names []string
+	_, err = store.Query(cheap).
+		Column(cheapName).
+		Where(cheapId.Matches(3)).
+		ListInto(func(name string) {
+			names = append(names, name)
+		})
+	if err != nil {
+		t.Fatalf("Failed RunIntoTable: %s", err)
+	}
+	if len(names) != 1 || names[0] != "Scrapbook" {
+		t.Fatalf("Expected the book Scrapbook, but got %v", names)
+	}
+}
+
+func RunParameterCriteria(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	// the value is bound on each execution
+	cheaperThan := BOOK_C_PRICE.Lesser(Param("maxPrice"))
+
+	store := TM.Store()
+	query := store.Query(BOOK).
+		Column(BOOK_C_NAME).
+		Where(cheaperThan)
+	for maxPrice, expected := range map[float64]int{10: 1, 20: 2, 50: 3} {
+		query.SetParameter("maxPrice", maxPrice)
+		names, err := query.ListInto(func(name string) string {
+			return name
+		})
+		if err != nil {
+			t.Fatalf("Failed RunParameterCriteria: %s", err)
+		}
+		if len(names) != expected {
+			t.Fatalf("Expected %v books cheaper than %v, but got %v", expected, maxPrice, names)
+		}
+	}
+
+	// the same restriction in another query
+	var count int64
+	countQuery := store.Query(BOOK).CountAll().Where(cheaperThan)
+	if _, err := countQuery.SelectInto(&count); err == nil {
+		t.Fatal("Expected an error executing without a value for the parameter")
+	}
+	countQuery.SetParameter("maxPrice", 20.0)
+	if _, err := countQuery.SelectInto(&count); err != nil {
+		t.Fatalf("Failed RunParameterCriteria: %s", err)
+	}
+	if count != 2 {
+		t.Fatalf("Expected 2 books cheaper than 20, but got %v", count)
+	}
+}
+
+func RunMinMax(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	var price float64
+	found, err := store.Query(BOOK).Where(BOOK_C_PUBLISHER_ID.Matches(2)).Max(BOOK_C_PRICE, &price)
+	if err != nil {
+		t.Fatalf("Failed RunMinMax: %s", err)
+	}
+	if !found || price != 12.5 {
+		t.Fatalf("Expected the max price 12.5, but got %v (found=%v)", price, found)
+	}
+
+	var name string
+	found, err = store.Query(BOOK).Min(BOOK_C_NAME, &name)
+	if err != nil {
+		t.Fatalf("Failed RunMinMax: %s", err)
+	}
+	if !found || name != "Cookbook" {
+		t.Fatalf("Expected the min name Cookbook, but got %q (found=%v)", name, found)
+	}
+
+	// the aggregate of no rows
+	price = -1
+	found, err = store.Query(BOOK).Where(BOOK_C_PUBLISHER_ID.Matches(99)).Min(BOOK_C_PRICE, &price)
+	if err != nil {
+		t.Fatalf("Failed RunMinMax: %s", err)
+	}
+	if found || price != -1 {
+		t.Fatalf("Expected no min price, but got %v (found=%v)", price, found)
+	}
+}
+
+func RunSkipWithoutLimit(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	query := TM.Store().Query(BOOK).
+		All().
+		Order(BOOK_C_ID)
+	for _, page := range []struct {
+		skip     int64
+		limit    int64
+		expected []int64
+	}{
+		{1, 0, []int64{2, 3}},
+		{0, 2, []int64{1, 2}},
+		{1, 1, []int64{2}},
+		{0, 0, []int64{1, 2, 3}},
+	} {
+		var books []*Book
+		// the same query with other pagination
+		err := query.Skip(page.skip).Limit(page.limit).List(&books)
+		if err != nil {
+			t.Fatalf("Failed RunSkipWithoutLimit: %s", err)
+		}
+		var ids []int64
+		for _, book := range books {
+			ids = append(ids, *book.Id)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(page.expected) {
+			t.Fatalf("Expected the books %v with skip %v and limit %v, but got %v", page.expected, page.skip, page.limit, ids)
+		}
+	}
+}
+
+func RunSeveralOn(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	// the outer join keeps the publisher without matching books
+	var count int64
+	_, err := TM.Store().Query(PUBLISHER).
+		CountAll().
+		Outer(PUBLISHER_A_BOOKS).
+		On(BOOK_C_PRICE.Greater(10)).
+		On(BOOK_C_PRICE.Lesser(20)).
+		Join().
+		SelectInto(&count)
+	if err != nil {
+		t.Fatalf("Failed RunSeveralOn: %s", err)
+	}
+	if count != 2 {
+		t.Fatalf("Expected 2 rows, but got %v", count)
+	}
+}
+
+func RunQueryChannel(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	query := TM.Store().Query(BOOK).
+		Column(BOOK_C_NAME).
+		Order(BOOK_C_ID)
+	rsql := query.Compile()
+
+	rows, errs := query.GetDba().
+		SetChannelBuffer(1).
+		QueryChannel(context.Background(), rsql.Sql, NewEntityTransformer(query, (*Book)(nil)), rsql.BuildValues(query.GetParameters())...)
+	var names []string
+	for row := range rows {
+		names = append(names, row.(*Book).Name)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Failed RunQueryChannel: %s", err)
+	}
+	if fmt.Sprint(names) != "[Once Upon a Time... Cookbook Scrapbook]" {
+		t.Fatalf("Expected the names of the 3 books, but got %v", names)
+	}
+
+	// the consumer abandons the channel after the first row
+	ctx, cancel := context.WithCancel(context.Background())
+	rows, errs = query.GetDba().
+		SetChannelBuffer(0).
+		QueryChannel(ctx, rsql.Sql, NewEntityTransformer(query, (*Book)(nil)), rsql.BuildValues(query.GetParameters())...)
+	if row := <-rows; row == nil || row.(*Book).Name != "Once Upon a Time..." {
+		t.Fatalf("Expected the first book, but got %+v", row)
+	}
+	cancel()
+	if err := <-errs; err != context.Canceled {
+		t.Fatalf("Expected the cancel error of the abandoned channel, but got %v", err)
+	}
+	if _, open := <-rows; open {
+		t.Fatal("Expected the rows channel to be closed after the cancel")
+	}
+	// the connection was released
+	var count int64
+	if _, err := TM.Store().Query(BOOK).CountAll().SelectInto(&count); err != nil {
+		t.Fatalf("Failed RunQueryChannel: %s", err)
+	}
+	if count != 3 {
+		t.Fatalf("Expected 3 books, but got %v", count)
+	}
+}
+
+func RunMaxParameters(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	// a low maximum, so that the statements are split
+	tx := TM.Store().GetTranslator()
+	limiter := tx.(interface{ SetMaxParameters(int) })
+	defer limiter.SetMaxParameters(tx.GetMaxParameters())
+	limiter.SetMaxParameters(3)
+
+	ids := []int64{1, 2, 3}
+	err := TM.Transaction(func(store IDb) error {
+		names, err := store.Query(BOOK).
+			Column(BOOK_C_NAME).
+			Where(BOOK_C_ID.In(ids)).
+			ListInto(func(name string) string {
+				return name
+			})
+		if err != nil {
+			return err
+		}
+		if len(names) != 3 {
+			t.Fatalf("Expected 3 books, but got %v", names)
+		}
+
+		affected, err := store.Update(BOOK).
+			Set(BOOK_C_PRICE, 1.5).
+			Where(BOOK_C_ID.In(ids)).
+			Execute()
+		if err != nil {
+			return err
+		}
+		if affected != 3 {
+			t.Fatalf("Expected 3 updated books, but got %v", affected)
+		}
+
+		// the results of the parts cannot be ordered
+		_, err = store.Query(BOOK).
+			Column(BOOK_C_NAME).
+			Where(BOOK_C_ID.In(ids)).
+			Order(BOOK_C_NAME).
+			ListInto(func(name string) string {
+				return name
+			})
+		if err == nil {
+			t.Fatal("Expected an error splitting an ordered query")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed RunMaxParameters: %s", err)
+	}
+}
+
+func RunQueryFingerprint(TM ITransactionManager, t *testing.T) {
+	store := TM.Store()
+	byName := func(name string) string {
+		return store.Query(BOOK).
+			Column(BOOK_C_ID).
+			Where(BOOK_C_NAME.Matches(name)).
+			Fingerprint()
+	}
+	if a, b := byName("Cookbook"), byName("Scrapbook"); a != b {
+		t.Fatalf("Expected the same fingerprint for different values, but got %s and %s", a, b)
+	}
+
+	byIds := func(ids ...int64) string {
+		return store.Query(BOOK).
+			Column(BOOK_C_ID).
+			Where(BOOK_C_ID.In(ids)).
+			Fingerprint()
+	}
+	if a, b := byIds(1), byIds(1, 2, 3); a != b {
+		t.Fatalf("Expected the same fingerprint for lists of different sizes, but got %s and %s", a, b)
+	}
+
+	other := store.Query(BOOK).
+		Column(BOOK_C_NAME).
+		Where(BOOK_C_NAME.Matches("Cookbook")).
+		Fingerprint()
+	if other == byName("Cookbook") {
+		t.Fatalf("Expected a different fingerprint for a different query, but got %s", other)
+	}
+}
+
+func RunErrorCategory(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	_, err := TM.Store().Insert(PUBLISHER).
+		Columns(PUBLISHER_C_ID, PUBLISHER_C_VERSION, PUBLISHER_C_NAME).
+		Values(1, 1, "Duplicated").
+		Execute()
+	if err == nil {
+		t.Fatal("Expected an error inserting a duplicated key")
+	}
+	if !dbx.IsUniqueViolation(err) {
+		t.Fatalf("Expected a unique violation, but got %v: %s", dbx.Classify(err), err)
+	}
+	if dbx.IsDeadlock(err) {
+		t.Fatalf("Expected a unique violation not to be a deadlock: %s", err)
+	}
+}
+
+func RunInStructs(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	// mapped by name
+	type BookKey struct {
+		PublisherId int64
+		Id          int64
+	}
+	// mapped by position
+	type Pair struct {
+		A, B int64
+	}
+	for _, keys := range []interface{}{
+		[]BookKey{{1, 1}, {2, 3}, {1, 2}},
+		[]*Pair{{1, 1}, {3, 2}, {2, 1}},
+	} {
+		var books []*Book
+		err := TM.Store().Query(BOOK).
+			All().
+			Where(InStructs([]*Column{BOOK_C_ID, BOOK_C_PUBLISHER_ID}, keys)).
+			Order(BOOK_C_ID).
+			List(&books)
+		if err != nil {
+			t.Fatalf("Failed RunInStructs: %s", err)
+		}
+		if len(books) != 2 || *books[0].Id != 1 || *books[1].Id != 3 {
+			t.Fatalf("Expected books 1 and 3, but got %v", len(books))
+		}
+	}
+}
+
+func RunIgnoreDiscriminators(TM ITransactionManager, t *testing.T) {
+	ResetDB3(TM)
+
+	store := TM.Store()
+	var count int64
+	_, err := store.Query(STATUS).
+		CountAll().
+		IgnoreDiscriminators().
+		SelectInto(&count)
+	if err != nil {
+		t.Fatalf("Failed RunIgnoreDiscriminators: %s", err)
+	}
+	if count != 6 {
+		t.Fatalf("Expected 6 catalog rows, but got %v", count)
+	}
+
+	// after the where
+	_, err = store.Query(STATUS).
+		CountAll().
+		Where(STATUS_C_ID.Greater(1)).
+		IgnoreDiscriminators().
+		SelectInto(&count)
+	if err != nil {
+		t.Fatalf("Failed RunIgnoreDiscriminators: %s", err)
+	}
+	if count != 5 {
+		t.Fatalf("Expected 5 catalog rows, but got %v", count)
+	}
+
+	// other queries still apply the discriminator
+	_, err = store.Query(STATUS).CountAll().SelectInto(&count)
+	if err != nil {
+		t.Fatalf("Failed RunIgnoreDiscriminators: %s", err)
+	}
+	if count != 4 {
+		t.Fatalf("Expected 4 statuses, but got %v", count)
+	}
+}
+
+func RunCorrelatedCountColumn(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	// number of cheap books of each publisher
+	subquery := store.Query(BOOK).Alias("b").
+		CountAll().
+		Where(
+			BOOK_C_PUBLISHER_ID.Matches(PUBLISHER_C_ID.For("p")),
+			BOOK_C_PRICE.Lesser(20),
+		)
+
+	var dtos []*Dto
+	err := store.Query(PUBLISHER).Alias("p").
+		Column(PUBLISHER_C_NAME).
+		Column(subquery).As("Value").
+		Where(PUBLISHER_C_ID.Greater(0)).
+		Order(PUBLISHER_C_ID).
+		List(&dtos)
+	if err != nil {
+		t.Fatalf("Failed RunCorrelatedCountColumn: %s", err)
+	}
+
+	if len(dtos) != 2 {
+		t.Fatalf("Expected 2 Publishers, but got %v", len(dtos))
+	}
+	if dtos[0].Value != 0 || dtos[1].Value != 2 {
+		t.Fatalf("Expected the counts 0 and 2, but got %v and %v", dtos[0].Value, dtos[1].Value)
+	}
+}
+
+func RunExecDDL(TM ITransactionManager, t *testing.T) {
+	store := TM.Store()
+	if _, err := store.ExecRaw("CREATE TABLE DDL_TEST (ID INTEGER)"); err != nil {
+		t.Fatalf("Failed RunExecDDL: %s", err)
+	}
+	defer store.ExecRaw("DROP TABLE DDL_TEST")
+
+	result, err := store.ExecRaw("INSERT INTO DDL_TEST (ID) VALUES ("+store.GetTranslator().GetPlaceholder(1, "id")+")", 1)
+	if err != nil {
+		t.Fatalf("Failed RunExecDDL: %s", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		t.Fatalf("Failed RunExecDDL: %s", err)
+	}
+	if affected != 1 {
+		t.Fatalf("Expected 1 inserted row, but got %v", affected)
+	}
+}
+
+func RunErrorConstraint(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	_, err := TM.Store().Insert(PUBLISHER).
+		Columns(PUBLISHER_C_ID, PUBLISHER_C_VERSION, PUBLISHER_C_NAME).
+		Values(1, 1, "Duplicated").
+		Execute()
+	if err == nil {
+		t.Fatal("Expected an error inserting a duplicated key")
+	}
+	var fail *dbx.PersistenceFail
+	if !errors.As(err, &fail) {
+		t.Fatalf("Expected a PersistenceFail, but got %T: %s", err, err)
+	}
+	// the name depends on the database, ex: publisher_pkey or PRIMARY
+	if fail.Constraint() == "" {
+		t.Fatalf("Expected the name of the violated constraint in: %s", err)
+	}
+	if dbx.Constraint(err) != fail.Constraint() {
+		t.Fatalf("Expected the constraint %s, but got %s", fail.Constraint(), dbx.Constraint(err))
+	}
+}
+
+func RunLoadInto(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	book := new(Book)
+	book.SetPrice(99)
+	found, err := store.Query(BOOK).
+		Column(BOOK_C_ID, BOOK_C_NAME).
+		Where(BOOK_C_ID.Matches(2)).
+		LoadInto(book)
+	if err != nil {
+		t.Fatalf("Failed RunLoadInto: %s", err)
+	}
+	if !found {
+		t.Fatal("Expected to find the book with id 2")
+	}
+	if book.Name != "Cookbook" {
+		t.Fatalf("Expected the name Cookbook, but got %s", book.Name)
+	}
+	// not selected
+	if book.Price != 99 {
+		t.Fatalf("Expected the price to be kept as 99, but got %v", book.Price)
+	}
+	if len(book.Marks()) != 0 {
+		t.Fatalf("Expected no marks after loading, but got %v", book.Marks())
+	}
+
+	publisher := new(Publisher)
+	publisher.Books = []*Book{book}
+	found, err = store.LoadInto(PUBLISHER_C_ID.Matches(2), publisher)
+	if err != nil {
+		t.Fatalf("Failed RunLoadInto: %s", err)
+	}
+	if !found || publisher.Name == nil || *publisher.Name != PUBLISHER_UTF8_NAME {
+		t.Fatalf("Expected the publisher %s, but got %s", PUBLISHER_UTF8_NAME, publisher)
+	}
+	if len(publisher.Books) != 1 {
+		t.Fatalf("Expected the books to be kept, but got %v", len(publisher.Books))
+	}
+}
+
+func RunSubmitChanged(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	var book Book
+	if _, err := store.Retrive(&book, 1); err != nil {
+		t.Fatalf("Failed RunSubmitChanged: %s", err)
+	}
+	version := book.Version
+
+	// changed by another process
+	if _, err := store.Update(BOOK).Set(BOOK_C_NAME, "Renamed").Where(BOOK_C_ID.Matches(1)).Execute(); err != nil {
+		t.Fatalf("Failed RunSubmitChanged: %s", err)
+	}
+
+	// the mark is ignored, but kept
+	book.SetName("Stale")
+	book.Price = 10
+	affected, err := store.Update(BOOK).SubmitChanged(&book, BOOK_C_PRICE)
+	if err != nil {
+		t.Fatalf("Failed RunSubmitChanged: %s", err)
+	}
+	if affected != 1 {
+		t.Fatalf("Expected 1 updated row, but got %v", affected)
+	}
+	if book.Version != version+1 {
+		t.Fatalf("Expected the version %v, but got %v", version+1, book.Version)
+	}
+	if !book.Marks()["Name"] {
+		t.Fatalf("Expected the mark of Name to be kept, but got %v", book.Marks())
+	}
+
+	var other Book
+	if _, err = store.Retrive(&other, 1); err != nil {
+		t.Fatalf("Failed RunSubmitChanged: %s", err)
+	}
+	if other.Price != 10 {
+		t.Fatalf("Expected the price 10, but got %v", other.Price)
+	}
+	if other.Name != "Renamed" {
+		t.Fatalf("Expected the unchanged name to be kept as Renamed, but got %s", other.Name)
+	}
+	if other.Version != version+1 {
+		t.Fatalf("Expected the stored version %v, but got %v", version+1, other.Version)
+	}
+}
+
+func RunJoinOptions(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	query := store.Query(PUBLISHER).
+		All().
+		Inner(PUBLISHER_A_BOOKS).
+		Join(WithJoinType(OUTER_JOIN), WithFetch()).
+		Where(PUBLISHER_C_ID.Matches(2))
+	if sql := query.Compile().OriSql; !strings.Contains(sql, "LEFT OUTER JOIN") {
+		t.Fatalf("Expected an outer join in: %s", sql)
+	}
+
+	var publishers []*Publisher
+	if err := query.ListFlatTree(&publishers); err != nil {
+		t.Fatalf("Failed RunJoinOptions: %s", err)
+	}
+	if len(publishers) != 2 {
+		t.Fatalf("Expected 2 rows for the publisher with id 2, but got %v", len(publishers))
+	}
+	for _, publisher := range publishers {
+		if len(publisher.Books) != 1 {
+			t.Fatalf("Expected the fetched book, but got %v books", len(publisher.Books))
+		}
+	}
+}
+
+func RunUpdateSetMap(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	update := store.Update(BOOK).Where(BOOK_C_ID.Matches(2))
+	if err := update.SetMap(map[*Column]interface{}{BOOK_C_NAME: "Mapped", BOOK_C_PRICE: 7.5}); err != nil {
+		t.Fatalf("Failed RunUpdateSetMap: %s", err)
+	}
+	affected, err := update.Execute()
+	if err != nil {
+		t.Fatalf("Failed RunUpdateSetMap: %s", err)
+	}
+	if affected != 1 {
+		t.Fatalf("Expected 1 updated row, but got %v", affected)
+	}
+
+	// by alias and by column name
+	update = store.Update(BOOK).Where(BOOK_C_ID.Matches(3))
+	if err = update.SetNamed(map[string]interface{}{"Name": "Patched", "PRICE": 5.5}); err != nil {
+		t.Fatalf("Failed RunUpdateSetMap: %s", err)
+	}
+	if _, err = update.Execute(); err != nil {
+		t.Fatalf("Failed RunUpdateSetMap: %s", err)
+	}
+
+	if err = store.Update(BOOK).SetNamed(map[string]interface{}{"Unknown": 1}); err == nil {
+		t.Fatal("Expected an error for an unknown column")
+	}
+	if err = store.Update(BOOK).SetNamed(map[string]interface{}{"ID": 9}); err == nil {
+		t.Fatal("Expected an error for a key column")
+	}
+	if err = store.Update(BOOK).SetNamed(map[string]interface{}{"VERSION": 9}); err == nil {
+		t.Fatal("Expected an error for a version column")
+	}
+	if err = store.Update(BOOK).SetMap(map[*Column]interface{}{PUBLISHER_C_NAME: "X"}); err == nil {
+		t.Fatal("Expected an error for a column of another table")
+	}
+
+	var books []*Book
+	err = store.Query(BOOK).
+		Column(BOOK_C_ID, BOOK_C_NAME, BOOK_C_PRICE).
+		Where(BOOK_C_ID.In(2, 3)).
+		Order(BOOK_C_ID).
+		List(&books)
+	if err != nil {
+		t.Fatalf("Failed RunUpdateSetMap: %s", err)
+	}
+	if len(books) != 2 || books[0].Name != "Mapped" || books[0].Price != 7.5 ||
+		books[1].Name != "Patched" || books[1].Price != 5.5 {
+		t.Fatalf("Expected the updated books, but got %v", books)
+	}
+}
+
+func RunTxStatementCache(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	tm, ok := TM.(*TransactionManager)
+	if !ok {
+		logger.Infof("RunTxStatementCache requires a *TransactionManager")
+		return
+	}
+	tm.SetTxStatementCache(true)
+	defer tm.SetTxStatementCache(false)
+
+	err := TM.Transaction(func(store IDb) error {
+		query := store.Query(BOOK).
+			Column(BOOK_C_NAME).
+			Where(BOOK_C_ID.Matches(Param("id")))
+
+		connection := store.GetConnection()
+		stmt1, err := connection.Prepare(query.Compile().Sql)
+		if err != nil {
+			return err
+		}
+		stmt2, err := connection.Prepare(query.Compile().Sql)
+		if err != nil {
+			return err
+		}
+		if stmt1 != stmt2 {
+			t.Fatal("Expected the statement to be shared in the transaction")
+		}
+		if keeper, ok := connection.(dbx.StatementKeeper); !ok || !keeper.Keeps(stmt1) {
+			t.Fatal("Expected the statement to be kept by the transaction")
+		}
+
+		// the shared statement is executed several times
+		for id, expected := range map[int64]string{1: "Once Upon a Time...", 2: "Cookbook", 3: "Scrapbook"} {
+			var name string
+			query.SetParameter("id", id)
+			if _, err = query.SelectInto(&name); err != nil {
+				return err
+			}
+			if name != expected {
+				t.Fatalf("Expected the book %s, but got %s", expected, name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed RunTxStatementCache: %s", err)
+	}
+}
+
+func RunNestedStructColumns(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	type PublisherRow struct {
+		Id   int64  `sql:"ID"`
+		Name string `sql:"NAME"`
+	}
+	type BookRow struct {
+		Id        int64         `sql:"ID"`
+		Name      string        `sql:"NAME"`
+		Publisher *PublisherRow `sql:"P"` // matches the columns P_ID and P_NAME
+	}
+
+	store := TM.Store()
+	tx := store.GetTranslator()
+	// both tables have the ID and NAME columns
+	query := fmt.Sprintf("SELECT b.%[1]s, b.%[2]s, p.%[3]s AS P_ID, p.%[4]s AS P_NAME FROM %[5]s b INNER JOIN %[6]s p ON p.%[3]s = b.%[7]s ORDER BY b.%[1]s",
+		tx.ColumnName(BOOK_C_ID), tx.ColumnName(BOOK_C_NAME), tx.ColumnName(PUBLISHER_C_ID), tx.ColumnName(PUBLISHER_C_NAME),
+		tx.TableName(BOOK), tx.TableName(PUBLISHER), tx.ColumnName(BOOK_C_PUBLISHER_ID))
+	var books []*BookRow
+	if _, err := store.QueryRaw(query, func(book *BookRow) {
+		books = append(books, book)
+	}); err != nil {
+		t.Fatalf("Failed RunNestedStructColumns: %s", err)
+	}
+
+	if len(books) != 3 {
+		t.Fatalf("Expected 3 books, but got %v", len(books))
+	}
+	book := books[0]
+	if book.Id != 1 || book.Name != "Once Upon a Time..." {
+		t.Fatalf("Expected the book 1, but got %+v", book)
+	}
+	if book.Publisher == nil || book.Publisher.Id != 1 || book.Publisher.Name != "Geek Publications" {
+		t.Fatalf("Expected the publisher 1 in the nested struct, but got %+v", book.Publisher)
+	}
+	if books[2].Publisher == nil || books[2].Publisher.Id != 2 {
+		t.Fatalf("Expected the publisher 2 in the nested struct, but got %+v", books[2].Publisher)
+	}
+}
+
+func RunListTree(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	// structs not implementing toolkit.Hasher
+	type BookDto struct {
+		Id    *int64
+		Name  string
+		Price float64
+	}
+	type PublisherDto struct {
+		Id    *int64
+		Name  *string
+		Books []*BookDto
+	}
+
+	var publishers []*PublisherDto
+	err := TM.Store().Query(PUBLISHER).
+		Column(PUBLISHER_C_ID, PUBLISHER_C_NAME).
+		Outer(PUBLISHER_A_BOOKS).
+		Include(BOOK_C_ID, BOOK_C_NAME, BOOK_C_PRICE).
+		Fetch().
+		Order(PUBLISHER_C_ID).
+		ListTree(&publishers)
+	if err != nil {
+		t.Fatalf("Failed RunListTree: %s", err)
+	}
+
+	// the publisher 2 has two books, in two rows
+	if len(publishers) != 2 {
+		t.Fatalf("Expected 2 publishers, but got %v", len(publishers))
+	}
+	if *publishers[0].Id != 1 || len(publishers[0].Books) != 1 {
+		t.Fatalf("Expected the publisher 1 with 1 book, but got %v with %v books", *publishers[0].Id, len(publishers[0].Books))
+	}
+	if *publishers[1].Id != 2 || len(publishers[1].Books) != 2 {
+		t.Fatalf("Expected the publisher 2 with 2 books, but got %v with %v books", *publishers[1].Id, len(publishers[1].Books))
+	}
+	for _, book := range publishers[1].Books {
+		if book.Id == nil || book.Name == "" {
+			t.Fatalf("Expected a populated book, but got %+v", book)
+		}
+	}
+}
+
+func RunSelfJoin(TM ITransactionManager, t *testing.T) {
+	store := TM.Store()
+	if _, err := store.ExecRaw("CREATE TABLE EMP_TREE (ID INTEGER NOT NULL PRIMARY KEY, NAME VARCHAR(50), MANAGER_ID INTEGER)"); err != nil {
+		t.Fatalf("Failed RunSelfJoin: %s", err)
+	}
+	defer store.ExecRaw("DROP TABLE EMP_TREE")
+	for _, insert := range []string{
+		"INSERT INTO EMP_TREE (ID, NAME, MANAGER_ID) VALUES (1, 'Boss', NULL)",
+		"INSERT INTO EMP_TREE (ID, NAME, MANAGER_ID) VALUES (2, 'Alice', 1)",
+		"INSERT INTO EMP_TREE (ID, NAME, MANAGER_ID) VALUES (3, 'Bob', 1)",
+		"INSERT INTO EMP_TREE (ID, NAME, MANAGER_ID) VALUES (4, 'Carol', 2)",
+	} {
+		if _, err := store.ExecRaw(insert); err != nil {
+			t.Fatalf("Failed RunSelfJoin: %s", err)
+		}
+	}
+
+	var (
+		EMP              = TABLE("EMP_TREE")
+		EMP_C_ID         = EMP.KEY("ID")
+		EMP_C_NAME       = EMP.COLUMN("NAME")
+		EMP_C_MANAGER_ID = EMP.COLUMN("MANAGER_ID")
+		EMP_A_MANAGER    = EMP.
+					ASSOCIATE(EMP_C_MANAGER_ID).
+					TO(EMP_C_ID).
+					As("Manager")
+	)
+
+	type Row struct {
+		Name        string
+		ManagerName string
+	}
+	var rows []*Row
+	// the joined instance of the same table has its own alias
+	err := store.Query(EMP).
+		Column(EMP_C_NAME).
+		Inner(EMP_A_MANAGER).As("m").
+		Include(EMP_C_NAME).As("ManagerName").
+		Join().
+		Where(Matches(EMP_C_NAME.For("m"), "Boss")).
+		Order(EMP_C_NAME).
+		List(&rows)
+	if err != nil {
+		t.Fatalf("Failed RunSelfJoin: %s", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 employees of the Boss, but got %v", len(rows))
+	}
+	if rows[0].Name != "Alice" || rows[1].Name != "Bob" || rows[0].ManagerName != "Boss" {
+		t.Fatalf("Expected Alice and Bob managed by the Boss, but got %+v and %+v", *rows[0], *rows[1])
+	}
+
+	// a built query reused as a correlated subquery of the same table
+	ResetDB(TM)
+	books := store.Query(BOOK).Column(BOOK_C_NAME).Inner(BOOK_A_PUBLISHER).Join()
+	cheaper := books.CloneAs("b2").WhereIf(true,
+		BOOK_C_PUBLISHER_ID.Matches(BOOK_C_PUBLISHER_ID.For(books.GetTableAlias())),
+		BOOK_C_PRICE.Lesser(BOOK_C_PRICE.For(books.GetTableAlias())),
+	)
+	names, err := books.Where(Exists(cheaper)).ListInto(func(name string) string {
+		return name
+	})
+	if err != nil {
+		t.Fatalf("Failed RunSelfJoin: %s", err)
+	}
+	if len(names) != 1 || names[0] != "Cookbook" {
+		t.Fatalf("Expected the Cookbook, with a cheaper book of the same publisher, but got %v", names)
+	}
+}
+
+func RunSubmitChunks(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	if err := TM.Transaction(func(store IDb) error {
+		publishers := []*Publisher{
+			{Name: ext.String("Chunk 1")},
+			{Name: ext.String("Chunk 2")},
+			{Name: ext.String("Chunk 3")},
+			// duplicated key
+			{EntityBase: EntityBase{Id: ext.Int64(1)}, Name: ext.String("Chunk 4")},
+			{Name: ext.String("Chunk 5")},
+		}
+		result, err := store.Insert(PUBLISHER).SubmitChunks(publishers, 2)
+		if err == nil {
+			t.Fatal("Expected an error inserting a duplicated key")
+		}
+		if result == nil || result.Failed != 1 || result.Completed() != 1 || result.Total != 2 {
+			t.Fatalf("Expected the second chunk to fail after 2 inserts, but got %+v", result)
+		}
+		if len(result.Chunks) != 2 || result.Chunks[0] != 2 || result.Chunks[1] != 0 {
+			t.Fatalf("Expected the chunk counts [2 0], but got %v", result.Chunks)
+		}
+		if !reflect.DeepEqual(result.Pending, []int{2, 3, 4}) {
+			t.Fatalf("Expected the pending instances [2 3 4], but got %v", result.Pending)
+		}
+
+		// the failed chunk was rolled back as a whole and the transaction is still usable
+		var count int64
+		if _, err := store.Query(PUBLISHER).CountAll().SelectInto(&count); err != nil {
+			t.Fatalf("Failed RunSubmitChunks: %s", err)
+		}
+		if count != 4 {
+			t.Fatalf("Expected 4 publishers, but got %v", count)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed RunSubmitChunks: %s", err)
+	}
+
+	// the chunks follow the key order but the pending indexes refer to the slice
+	if err := TM.Transaction(func(store IDb) error {
+		publishers := []*Publisher{
+			{EntityBase: EntityBase{Id: ext.Int64(2), Version: 1}, Name: ext.String("Sorted 2")},
+			// stale version
+			{EntityBase: EntityBase{Id: ext.Int64(1), Version: 99}, Name: ext.String("Sorted 1")},
+		}
+		result, err := store.Update(PUBLISHER).SortBatch(true).SubmitChunks(publishers, 1)
+		if err == nil {
+			t.Fatal("Expected an optimistic lock error")
+		}
+		if result == nil || result.Failed != 0 || !reflect.DeepEqual(result.Pending, []int{1, 0}) {
+			t.Fatalf("Expected the first chunk to fail with the pending instances [1 0], but got %+v", result)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed RunSubmitChunks: %s", err)
+	}
+
+	// outside a transaction the instances before the failing one remain applied
+	ResetDB(TM)
+	publishers := []*Publisher{
+		{Name: ext.String("Chunk 1")},
+		// duplicated key
+		{EntityBase: EntityBase{Id: ext.Int64(1)}, Name: ext.String("Chunk 2")},
+		{Name: ext.String("Chunk 3")},
+	}
+	store := TM.Store()
+	result, err := store.Insert(PUBLISHER).SubmitChunks(publishers, 2)
+	if err == nil {
+		t.Fatal("Expected an error inserting a duplicated key")
+	}
+	if result == nil || result.Failed != 0 || result.Total != 1 || !reflect.DeepEqual(result.Pending, []int{1, 2}) {
+		t.Fatalf("Expected the first chunk to fail after 1 insert, but got %+v", result)
+	}
+	var count int64
+	if _, err := store.Query(PUBLISHER).CountAll().SelectInto(&count); err != nil {
+		t.Fatalf("Failed RunSubmitChunks: %s", err)
+	}
+	if count != 3 {
+		t.Fatalf("Expected 3 publishers, but got %v", count)
+	}
+}
+
+func RunAggregateFilter(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	var all, cheap int64
+	var sum float64
+	ok, err := TM.Store().Query(BOOK).
+		Column(
+			Count(nil),
+			Count(nil).Filter(BOOK_C_PRICE.Lesser(20)),
+			Sum(BOOK_C_PRICE).Filter(BOOK_C_PUBLISHER_ID.Matches(2)),
+		).
+		SelectInto(&all, &cheap, &sum)
+	if err != nil {
+		t.Fatalf("Failed RunAggregateFilter: %s", err)
+	}
+	if !ok {
+		t.Fatal("Expected a result for RunAggregateFilter")
+	}
+	if all != 3 || cheap != 2 {
+		t.Fatalf("Expected 3 books with 2 cheap ones, but got %v and %v", all, cheap)
+	}
+	if sum != 19 {
+		t.Fatalf("Expected the sum 19 for the publisher 2, but got %v", sum)
+	}
+}
+
+func RunStatementTimeout(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	if err := TM.Store().SetStatementTimeout(5 * time.Second); err == nil {
+		t.Fatal("Expected an error setting the statement timeout outside a transaction")
+	}
+
+	if err := TM.Transaction(func(store IDb) error {
+		supported := store.GetTranslator().GetSqlForStatementTimeout(5*time.Second) != ""
+		err := store.SetStatementTimeout(5 * time.Second)
+		if !supported {
+			if err == nil {
+				t.Fatal("Expected an error for a database without statement timeout")
+			}
+			return nil
+		}
+		if err != nil {
+			t.Fatalf("Failed RunStatementTimeout: %s", err)
+		}
+		if err := store.SetStatementTimeout(-time.Second); err == nil {
+			t.Fatal("Expected an error for a negative statement timeout")
+		}
+		// a timeout under a millisecond must not become zero, that removes the limit
+		if sql := store.GetTranslator().GetSqlForStatementTimeout(time.Microsecond); strings.HasSuffix(sql, " 0") {
+			t.Fatalf("Expected a timeout of a microsecond to be rounded up, but got %s", sql)
+		}
+		// the statements still run under the limit
+		var count int64
+		if _, err := store.Query(BOOK).CountAll().SelectInto(&count); err != nil {
+			t.Fatalf("Failed RunStatementTimeout: %s", err)
+		}
+		if count != 3 {
+			t.Fatalf("Expected 3 books, but got %v", count)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed RunStatementTimeout: %s", err)
+	}
+}
+
+func RunForUpdate(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	if err := TM.Transaction(func(store IDb) error {
+		var books []*Book
+		if err := store.Query(BOOK).All().Where(BOOK_C_ID.Matches(1)).ForUpdate().List(&books); err != nil {
+			t.Fatalf("Failed RunForUpdate: %s", err)
+		}
+		if len(books) != 1 {
+			t.Fatalf("Expected 1 locked book, but got %v", len(books))
+		}
+
+		// databases that cannot lock a paginated query (Oracle) reject it
+		func() {
+			defer func() {
+				if r := recover(); r != nil && !strings.Contains(fmt.Sprint(r), "pagination") {
+					panic(r)
+				}
+			}()
+			books = nil
+			if err := store.Query(BOOK).All().Order(BOOK_C_ID).Limit(2).ForUpdate().List(&books); err != nil {
+				t.Fatalf("Failed RunForUpdate: %s", err)
+			}
+			if len(books) != 2 {
+				t.Fatalf("Expected 2 locked books, but got %v", len(books))
+			}
+		}()
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed RunForUpdate: %s", err)
+	}
+}
+
+func RunVirtualColumnAliases(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	virtualBook := TABLE("BOOK")
+	// TABLE registers the declaration as the table of Book
+	defer AddEntity(BOOK)
+	virtualBookId := virtualBook.KEY("ID")
+	virtualBookPrice := virtualBook.COLUMN("PRICE")
+	virtualBookDouble := virtualBook.VIRTUAL("DOUBLE_PRICE", Multiply(virtualBookPrice, 2))
+
+	store := TM.Store()
+	for _, c := range []struct {
+		alias string
+		id    int64
+		price float64
+	}{{"a", 1, 69}, {"b", 2, 25}, {"a", 3, 13}} {
+		var price float64
+		_, err := store.Query(virtualBook).Alias(c.alias).
+			Column(virtualBookDouble).
+			Where(virtualBookId.Matches(c.id)).
+			SelectInto(&price)
+		if err != nil {
+			t.Fatalf("Failed RunVirtualColumnAliases: %s", err)
+		}
+		if price != c.price {
+			t.Fatalf("Expected the double price %v for the book %v, but got %v", c.price, c.id, price)
+		}
+	}
+	// the shared expression is not changed by the queries
+	if alias := virtualBookDouble.GetVirtual().GetMembers()[0].GetTableAlias(); alias != "" {
+		t.Fatalf("Expected the virtual expression without a table alias, but got %s", alias)
+	}
+}
+
+// runs the statement, returning false if the database does not support it
+func supported(run func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if !strings.Contains(fmt.Sprint(r), "not supported") {
+				panic(r)
+			}
+			ok = false
+		}
+	}()
+	run()
+	return true
+}
+
+func RunDeleteWithJoin(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	if _, err := store.Insert(BOOK).
+		Columns(BOOK_C_ID, BOOK_C_VERSION, BOOK_C_NAME, BOOK_C_PRICE, BOOK_C_PUBLISHER_ID).
+		Values(4, 1, "Pamphlet", 2.5, 2).
+		Execute(); err != nil {
+		t.Fatalf("Failed RunDeleteWithJoin: %s", err)
+	}
+
+	var affected int64
+	var err error
+	if !supported(func() {
+		affected, err = store.Delete(BOOK).
+			Inner(BOOK_A_PUBLISHER).On(PUBLISHER_C_NAME.Matches(PUBLISHER_UTF8_NAME)).Join().
+			Where(BOOK_C_PRICE.Lesser(5)).
+			Execute()
+	}) {
+		return
+	}
+	if err != nil {
+		t.Fatalf("Failed RunDeleteWithJoin: %s", err)
+	}
+	if affected != 1 {
+		t.Fatalf("Expected 1 deleted book, but got %v", affected)
+	}
+	var count int64
+	if _, err := store.Query(BOOK).CountAll().SelectInto(&count); err != nil {
+		t.Fatalf("Failed RunDeleteWithJoin: %s", err)
+	}
+	if count != 3 {
+		t.Fatalf("Expected 3 books after the delete, but got %v", count)
+	}
+}
+
+func RunUpdateWithJoin(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	// the unaliased publisher column in the WHERE gets the alias of the join
+	var books []*Book
+	if err := store.Query(BOOK).All().
+		Inner(BOOK_A_PUBLISHER).Join().
+		Where(PUBLISHER_C_NAME.Matches("Geek Publications")).
+		List(&books); err != nil {
+		t.Fatalf("Failed RunUpdateWithJoin: %s", err)
+	}
+	if len(books) != 1 || *books[0].Id != 1 {
+		t.Fatalf("Expected only the book 1 of Geek Publications, but got %v", books)
+	}
+	// also when the WHERE is declared before the join
+	books = nil
+	if err := store.Query(BOOK).All().
+		Where(PUBLISHER_C_NAME.Matches("Geek Publications")).
+		Inner(BOOK_A_PUBLISHER).Join().
+		List(&books); err != nil {
+		t.Fatalf("Failed RunUpdateWithJoin: %s", err)
+	}
+	if len(books) != 1 || *books[0].Id != 1 {
+		t.Fatalf("Expected only the book 1 of Geek Publications, with the WHERE before the join, but got %v", books)
+	}
+
+	var affected int64
+	var err error
+	if !supported(func() {
+		affected, err = store.Update(BOOK).
+			Inner(BOOK_A_PUBLISHER).Join().
+			Set(BOOK_C_NAME, "Once Upon a Time... II").
+			Where(PUBLISHER_C_NAME.Matches("Geek Publications")).
+			Execute()
+	}) {
+		return
+	}
+	if err != nil {
+		t.Fatalf("Failed RunUpdateWithJoin: %s", err)
+	}
+	if affected != 1 {
+		t.Fatalf("Expected 1 updated book, but got %v", affected)
+	}
+	var name string
+	if _, err := store.Query(BOOK).Column(BOOK_C_NAME).
+		Where(BOOK_C_ID.Matches(1)).
+		SelectInto(&name); err != nil {
+		t.Fatalf("Failed RunUpdateWithJoin: %s", err)
+	}
+	if name != "Once Upon a Time... II" {
+		t.Fatalf("Expected the updated name of the book 1, but got %s", name)
+	}
+
+	// the WHERE before the join
+	affected, err = store.Update(BOOK).
+		Set(BOOK_C_NAME, "Once Upon a Time... III").
+		Where(PUBLISHER_C_NAME.Matches("Geek Publications")).
+		Inner(BOOK_A_PUBLISHER).Join().
+		Execute()
+	if err != nil {
+		t.Fatalf("Failed RunUpdateWithJoin: %s", err)
+	}
+	if affected != 1 {
+		t.Fatalf("Expected 1 updated book, with the WHERE before the join, but got %v", affected)
+	}
+	if _, err := store.Query(BOOK).Column(BOOK_C_NAME).
+		Where(BOOK_C_ID.Matches(1)).
+		SelectInto(&name); err != nil {
+		t.Fatalf("Failed RunUpdateWithJoin: %s", err)
+	}
+	if name != "Once Upon a Time... III" {
+		t.Fatalf("Expected the updated name of the book 1, but got %s", name)
+	}
+}
+
+func RunFetchSizeCursors(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	// the fetches of the cursors, for the databases that support them
+	fetches := map[string]bool{}
+	err := TM.Transaction(func(store IDb) error {
+		store.AddInterceptor(func(sql string, params []interface{}) (string, []interface{}) {
+			if strings.HasPrefix(sql, "FETCH") {
+				fetches[sql] = true
+			}
+			return sql, params
+		})
+
+		for _, price := range []float64{0, 10, 20} {
+			var ids []int64
+			var id int64
+			err := store.Query(BOOK).
+				Column(BOOK_C_ID).
+				Where(BOOK_C_PRICE.Greater(price)).
+				SetFetchSize(1).
+				ListSimple(func() {
+					ids = append(ids, id)
+				}, &id)
+			if err != nil {
+				return err
+			}
+			if price == 0 && len(ids) != 3 {
+				t.Fatalf("Expected 3 books, but got %v", ids)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed RunFetchSizeCursors: %s", err)
+	}
+	// the different queries reuse the same cursor name
+	if len(fetches) > 1 {
+		t.Fatalf("Expected at most 1 distinct cursor fetch, but got %v", fetches)
+	}
+}
+
+func RunScannerFields(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	// a field implementing sql.Scanner
+	var scanned []*struct {
+		Id   *int64
+		Name sql.NullString
+	}
+	if err := store.Query(BOOK).
+		Column(BOOK_C_ID, BOOK_C_NAME).
+		Where(BOOK_C_ID.Matches(1)).
+		List(&scanned); err != nil {
+		t.Fatalf("Failed RunScannerFields: %s", err)
+	}
+	if len(scanned) != 1 || !scanned[0].Name.Valid || scanned[0].Name.String != "Once Upon a Time..." {
+		t.Fatalf("Expected the scanned name of the book 1, but got %+v", scanned)
+	}
+
+	// an interface field receives the value, not its holder
+	var any []*struct {
+		Id   *int64
+		Name interface{}
+	}
+	if err := store.Query(BOOK).
+		Column(BOOK_C_ID, BOOK_C_NAME).
+		Where(BOOK_C_ID.Matches(1)).
+		List(&any); err != nil {
+		t.Fatalf("Failed RunScannerFields: %s", err)
+	}
+	if len(any) != 1 {
+		t.Fatalf("Expected 1 book, but got %v", len(any))
+	}
+	var name string
+	switch v := any[0].Name.(type) {
+	case string:
+		name = v
+	case []byte:
+		name = string(v)
+	default:
+		t.Fatalf("Expected the name of the book 1 as text, but got %T", v)
+	}
+	if name != "Once Upon a Time..." {
+		t.Fatalf("Expected the name of the book 1, but got %s", name)
+	}
+}
+
+func RunAcquireTimeout(TM ITransactionManager, t *testing.T) {
+	tm, ok := TM.(*TransactionManager)
+	if !ok {
+		return
+	}
+	maxOpen := tm.Stats().MaxOpenConnections
+	tm.SetMaxOpenConns(1).SetAcquireTimeout(100 * time.Millisecond)
+	defer tm.SetMaxOpenConns(maxOpen).SetAcquireTimeout(0)
+
+	err := TM.Transaction(func(store IDb) error {
+		// the only connection of the pool is taken by this transaction
+		start := time.Now()
+		err := TM.Transaction(func(store IDb) error {
+			return nil
+		})
+		if err == nil {
+			t.Fatal("Expected an error acquiring a connection from the exhausted pool")
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("Expected to fail fast, but waited %s", elapsed)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed RunAcquireTimeout: %s", err)
+	}
+}
+
+func RunSplitWrites(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	// a list of a single value, so that the statements are split
+	tx := TM.Store().GetTranslator()
+	limiter := tx.(interface{ SetMaxInValues(int) })
+	defer limiter.SetMaxInValues(tx.GetMaxInValues())
+	limiter.SetMaxInValues(1)
+
+	names, err := TM.Store().Query(BOOK).
+		Column(BOOK_C_NAME).
+		Where(BOOK_C_ID.In([]int64{1, 2, 3})).
+		ListInto(func(name string) string {
+			return name
+		})
+	if err != nil {
+		t.Fatalf("Failed RunSplitWrites: %s", err)
+	}
+	if len(names) != 3 {
+		t.Fatalf("Expected 3 books, but got %v", names)
+	}
+
+	_, err = TM.Store().Insert(BOOK).
+		Columns(BOOK_C_ID, BOOK_C_VERSION, BOOK_C_NAME, BOOK_C_PRICE).
+		Values(4, 1, "Split", 1.5).
+		Execute()
+	if err != nil {
+		t.Fatalf("Failed RunSplitWrites: %s", err)
+	}
+
+	// the book 4 is deleted by the first part, but the book 1 has authors
+	ids := []int64{4, 1}
+	affected, err := TM.Store().Delete(BOOK).Where(BOOK_C_ID.In(ids)).Execute()
+	if err == nil || affected != 0 {
+		t.Fatalf("Expected the delete to fail with no affected rows, but got %v and %v", affected, err)
+	}
+	var count int64
+	if _, err := TM.Store().Query(BOOK).CountAll().Where(BOOK_C_ID.Matches(4)).SelectInto(&count); err != nil || count != 1 {
+		t.Fatalf("Expected the book 4 to remain, but got %v and %v", count, err)
+	}
+
+	err = TM.Transaction(func(store IDb) error {
+		affected, err := store.Delete(BOOK).Where(BOOK_C_ID.In(ids)).Execute()
+		if err == nil || affected != 0 {
+			t.Fatalf("Expected the delete to fail with no affected rows, but got %v and %v", affected, err)
+		}
+		// the transaction is still usable
+		var count int64
+		if _, err := store.Query(BOOK).CountAll().Where(BOOK_C_ID.Matches(4)).SelectInto(&count); err != nil {
+			return err
+		}
+		if count != 1 {
+			t.Fatal("Expected the book 4 to remain")
+		}
+		affected, err = store.Delete(BOOK).Where(BOOK_C_ID.In([]int64{4, 5})).Execute()
+		if err != nil {
+			return err
+		}
+		if affected != 1 {
+			t.Fatalf("Expected 1 deleted book, but got %v", affected)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed RunSplitWrites: %s", err)
+	}
+}
+
+// trims the text read from the database
+type trimConverter struct{}
+
+func (this trimConverter) ToDb(in interface{}) (interface{}, error) {
+	return in, nil
+}
+
+func (this trimConverter) FromDbInstance() interface{} {
+	return new(sql.NullString)
+}
+
+func (this trimConverter) FromDb(in interface{}) (interface{}, error) {
+	ns := in.(*sql.NullString)
+	if !ns.Valid {
+		return nil, nil
+	}
+	return strings.TrimSpace(ns.String), nil
+}
+
+func RunConverterNull(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	// the address of the publishers is NULL
+	trimPublisher := TABLE("PUBLISHER")
+	// TABLE registers the declaration as the table of Publisher
+	defer AddEntity(PUBLISHER)
+	trimPublisherId := trimPublisher.KEY("ID")
+	trimPublisherAddress := trimPublisher.COLUMN("ADDRESS").Convert(trimConverter{})
+
+	store := TM.Store()
+	var pointers []*struct {
+		Id      *int64
+		Address *string
+	}
+	if err := store.Query(trimPublisher).Column(trimPublisherId, trimPublisherAddress).Order(trimPublisherId).List(&pointers); err != nil {
+		t.Fatalf("Failed RunConverterNull: %s", err)
+	}
+	if len(pointers) != 2 || pointers[0].Address != nil || pointers[1].Address != nil {
+		t.Fatalf("Expected 2 publishers without address, but got %+v", pointers)
+	}
+
+	var values []*struct {
+		Id      *int64
+		Address string
+	}
+	if err := store.Query(trimPublisher).Column(trimPublisherId, trimPublisherAddress).Order(trimPublisherId).List(&values); err != nil {
+		t.Fatalf("Failed RunConverterNull: %s", err)
+	}
+	if len(values) != 2 || values[0].Address != "" || values[1].Address != "" {
+		t.Fatalf("Expected 2 publishers without address, but got %+v", values)
+	}
+
+	// a value is still converted
+	if _, err := store.Update(trimPublisher).Set(trimPublisherAddress, " Lisbon ").Where(trimPublisherId.Matches(1)).Execute(); err != nil {
+		t.Fatalf("Failed RunConverterNull: %s", err)
+	}
+	if err := store.Query(trimPublisher).Column(trimPublisherId, trimPublisherAddress).Order(trimPublisherId).List(&values); err != nil {
+		t.Fatalf("Failed RunConverterNull: %s", err)
+	}
+	if len(values) != 2 || values[0].Address != "Lisbon" || values[1].Address != "" {
+		t.Fatalf("Expected the address Lisbon for the publisher 1, but got %+v", values)
+	}
+}
+
+func RunCombineNil(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	if And() != nil || Or() != nil {
+		t.Fatal("Expected nil when combining no criteria")
+	}
+	if And(nil, nil) != nil || Or(nil) != nil {
+		t.Fatal("Expected nil when combining only nil criteria")
+	}
+	byName := BOOK_C_NAME.Matches("Cookbook")
+	if And(nil, byName) != byName || Or(byName, nil) != byName {
+		t.Fatal("Expected the only criteria that is not nil")
+	}
+
+	store := TM.Store()
+	// a nil restriction is ignored
+	var books []*Book
+	if err := store.Query(BOOK).All().Where(And(nil, nil)).List(&books); err != nil {
+		t.Fatalf("Failed RunCombineNil: %s", err)
+	}
+	if len(books) != 3 {
+		t.Fatalf("Expected all the 3 books, but got %v", len(books))
+	}
+
+	books = nil
+	if err := store.Query(BOOK).All().Where(Or(nil, And(nil, byName))).List(&books); err != nil {
+		t.Fatalf("Failed RunCombineNil: %s", err)
+	}
+	if len(books) != 1 || books[0].Name != "Cookbook" {
+		t.Fatalf("Expected the book Cookbook, but got %+v", books)
+	}
+}
+
+// the value of the JSON object key, ignoring the case folding of the database
+func jsonKey(object map[string]interface{}, key string) (interface{}, bool) {
+	for k, v := range object {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func jsonValue(object map[string]interface{}, key string) interface{} {
+	v, _ := jsonKey(object, key)
+	return v
+}
+
+func RunQueryJSON(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	// the NULL address of the publishers
+	publisher := TABLE("PUBLISHER")
+	// TABLE registers the declaration as the table of Publisher
+	defer AddEntity(PUBLISHER)
+	publisherId := publisher.KEY("ID")
+	query := TM.Store().Query(publisher).
+		Column(publisherId, publisher.COLUMN("NAME"), publisher.COLUMN("ADDRESS")).
+		Order(publisherId)
+	rsql := query.Compile()
+
+	var buf bytes.Buffer
+	if err := query.GetDba().QueryJSON(&buf, rsql.Sql, rsql.BuildValues(query.GetParameters())...); err != nil {
+		t.Fatalf("Failed RunQueryJSON: %s", err)
+	}
+	var publishers []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &publishers); err != nil {
+		t.Fatalf("Failed RunQueryJSON: invalid JSON %s: %s", buf.String(), err)
+	}
+	if len(publishers) != 2 {
+		t.Fatalf("Expected 2 publishers, but got %s", buf.String())
+	}
+	if fmt.Sprint(jsonValue(publishers[0], "ID")) != "1" || jsonValue(publishers[0], "NAME") != "Geek Publications" {
+		t.Fatalf("Expected the publisher 1, but got %v", publishers[0])
+	}
+	if v, ok := jsonKey(publishers[0], "ADDRESS"); !ok || v != nil {
+		t.Fatalf("Expected a null address, but got %s", buf.String())
+	}
+
+	// the binary cover, in base64
+	cover, err := ioutil.ReadFile("../apple.jpg")
+	if err != nil {
+		t.Fatalf("Failed RunQueryJSON: %s", err)
+	}
+	query = TM.Store().Query(BOOK_BIN).
+		Column(BOOK_BIN_C_ID, BOOK_BIN_C_HARDCOVER).
+		Where(BOOK_BIN_C_ID.Matches(1))
+	rsql = query.Compile()
+
+	buf.Reset()
+	if err := query.GetDba().QueryJSON(&buf, rsql.Sql, rsql.BuildValues(query.GetParameters())...); err != nil {
+		t.Fatalf("Failed RunQueryJSON: %s", err)
+	}
+	var bins []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &bins); err != nil {
+		t.Fatalf("Failed RunQueryJSON: invalid JSON: %s", err)
+	}
+	if len(bins) != 1 {
+		t.Fatalf("Expected 1 cover, but got %v", len(bins))
+	}
+	encoded, _ := jsonValue(bins[0], "HARDCOVER").(string)
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("Expected the cover in base64, but got %.40s: %s", encoded, err)
+	}
+	if !bytes.Equal(decoded, cover) {
+		t.Fatalf("Expected the cover with %v bytes, but got %v bytes", len(cover), len(decoded))
+	}
+}
+
+func RunDiscriminatorCombiner(TM ITransactionManager, t *testing.T) {
+	ResetDB3(TM)
+
+	// the genders and the statuses
+	personal := TABLE("CATALOG").
+		With("DOMAIN", "GENDER").
+		With("DOMAIN", "STATUS").
+		CombineDiscriminators(OrDiscriminators)
+	// TABLE registers the declaration as the table of Status
+	defer AddEntity(STATUS)
+	personalId := personal.KEY("ID")
+
+	store := TM.Store()
+	var count int64
+	if _, err := store.Query(personal).CountAll().SelectInto(&count); err != nil {
+		t.Fatalf("Failed RunDiscriminatorCombiner: %s", err)
+	}
+	if count != 6 {
+		t.Fatalf("Expected the 6 rows of any of the domains, but got %v", count)
+	}
+
+	// the restrictions are still ANDed
+	if _, err := store.Query(personal).CountAll().Where(personalId.Greater(4)).SelectInto(&count); err != nil {
+		t.Fatalf("Failed RunDiscriminatorCombiner: %s", err)
+	}
+	if count != 2 {
+		t.Fatalf("Expected 2 rows, but got %v", count)
+	}
+
+	// overriding the combiner of the table, all the discriminators are ANDed
+	query := store.Query(personal).CountAll()
+	query.SetDiscriminatorCombiner(AndDiscriminators)
+	if _, err := query.SelectInto(&count); err != nil {
+		t.Fatalf("Failed RunDiscriminatorCombiner: %s", err)
+	}
+	if count != 0 {
+		t.Fatalf("Expected no row in both domains, but got %v", count)
+	}
+
+	// a custom combiner, where the restrictions extend the domain
+	query = store.Query(STATUS).CountAll()
+	query.SetDiscriminatorCombiner(func(restrictions []*Criteria, discriminators []*Criteria) *Criteria {
+		return Or(And(restrictions...), And(discriminators...))
+	})
+	if _, err := query.Where(STATUS_C_ID.Matches(1)).SelectInto(&count); err != nil {
+		t.Fatalf("Failed RunDiscriminatorCombiner: %s", err)
+	}
+	if count != 5 {
+		t.Fatalf("Expected the 4 statuses and the gender 1, but got %v", count)
+	}
+}
+
+func RunQueryClone(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	original := store.Query(BOOK).
+		Column(BOOK_C_NAME).
+		Inner(BOOK_A_PUBLISHER).Join().
+		Where(BOOK_C_PRICE.Lesser(Param("max"))).
+		Order(BOOK_C_ID)
+	original.SetParameter("max", 20)
+	rsql, err := original.GetCachedSQL()
+	if err != nil {
+		t.Fatalf("Failed RunQueryClone: %s", err)
+	}
+	sql := rsql.OriSql
+
+	names := func(query *Query) []string {
+		var names []string
+		if _, err := query.ListInto(func(name string) {
+			names = append(names, name)
+		}); err != nil {
+			t.Fatalf("Failed RunQueryClone: %s", err)
+		}
+		return names
+	}
+
+	// changing the parameters, the restrictions and the order of the clone
+	clone := original.Clone().(*Query)
+	clone.SetParameter("max", 10)
+	clone.WhereIf(true, PUBLISHER_C_ID.Matches(2))
+	clone.Order(BOOK_C_NAME).Desc()
+	if got := names(clone); fmt.Sprint(got) != "[Scrapbook]" {
+		t.Fatalf("Expected the clone to list the book Scrapbook, but got %v", got)
+	}
+
+	// does not change the original
+	if rsql, err = original.GetCachedSQL(); err != nil {
+		t.Fatalf("Failed RunQueryClone: %s", err)
+	}
+	if rsql.OriSql != sql {
+		t.Fatalf("Expected the SQL of the original to be unchanged\n%s\nbut got\n%s", sql, rsql.OriSql)
+	}
+	if original.GetParameters()["max"] != 20 {
+		t.Fatalf("Expected the parameter of the original to be unchanged, but got %v", original.GetParameters()["max"])
+	}
+	if got := names(original); fmt.Sprint(got) != "[Cookbook Scrapbook]" {
+		t.Fatalf("Expected the original to list the books Cookbook and Scrapbook, but got %v", got)
+	}
+}
+
+func RunPlaceholderFormatters(TM ITransactionManager, t *testing.T) {
+	// only the rendered SQL is checked, with a translator of its own, since the driver only accepts its own style
+	translator := translators.NewMySQL5Translator()
+	store := NewDb(new(bool), nil, translator)
+	expected := []struct {
+		formatter translators.PlaceholderFormatter
+		sql       string
+	}{
+		{translators.QuestionPlaceholder, "SELECT t0.`NAME` FROM `BOOK` t0 WHERE t0.`PRICE` > ? AND t0.`PRICE` < ?"},
+		{translators.DollarPlaceholder, "SELECT t0.`NAME` FROM `BOOK` t0 WHERE t0.`PRICE` > $1 AND t0.`PRICE` < $2"},
+		{translators.ColonPlaceholder, "SELECT t0.`NAME` FROM `BOOK` t0 WHERE t0.`PRICE` > :1 AND t0.`PRICE` < :2"},
+		{translators.AtPlaceholder, "SELECT t0.`NAME` FROM `BOOK` t0 WHERE t0.`PRICE` > @p1 AND t0.`PRICE` < @p2"},
+	}
+	for k, e := range expected {
+		translator.SetPlaceholderFormatter(e.formatter)
+		rsql, err := store.Query(BOOK).
+			Column(BOOK_C_NAME).
+			Where(BOOK_C_PRICE.Greater(10), BOOK_C_PRICE.Lesser(20)).
+			GetCachedSQL()
+		if err != nil {
+			t.Fatalf("Failed RunPlaceholderFormatters: %s", err)
+		}
+		if rsql.Sql != e.sql {
+			t.Fatalf("Expected with the formatter %v the SQL\n%s\nbut got\n%s", k, e.sql, rsql.Sql)
+		}
+	}
+}
+
+func RunJoinAliasPrefix(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	query := store.Query(BOOK).
+		JoinAlias("pub").
+		Column(BOOK_C_NAME).
+		Inner(BOOK_A_PUBLISHER).Join().
+		Where(Matches(PUBLISHER_C_NAME.For("t0_pub1"), "Geek Publications"))
+	rsql, err := query.GetCachedSQL()
+	if err != nil {
+		t.Fatalf("Failed RunJoinAliasPrefix: %s", err)
+	}
+	if !strings.Contains(rsql.OriSql, " t0_pub1 ") || strings.Contains(rsql.OriSql, "_j1") {
+		t.Fatalf("Expected the join alias t0_pub1, but got %s", rsql.OriSql)
+	}
+	var names []string
+	if _, err = query.ListInto(func(name string) {
+		names = append(names, name)
+	}); err != nil {
+		t.Fatalf("Failed RunJoinAliasPrefix: %s", err)
+	}
+	if fmt.Sprint(names) != "[Once Upon a Time...]" {
+		t.Fatalf("Expected the book of Geek Publications, but got %v", names)
+	}
+
+	// the prefix must be defined before the joins
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("Expected a panic defining the join alias prefix after a join")
+			}
+		}()
+		store.Query(BOOK).Inner(BOOK_A_PUBLISHER).Join().JoinAlias("pub")
+	}()
+}
+
+func RunBuildValuesSafe(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	query := TM.Store().Query(BOOK).
+		Column(BOOK_C_NAME).
+		Where(BOOK_C_PRICE.Greater(Param("min")), BOOK_C_PRICE.Lesser(Param("max")))
+	rsql := query.Compile()
+
+	// a missing parameter is an error, not a panic
+	values, err := rsql.BuildValuesSafe(map[string]interface{}{"max": 20})
+	if err == nil {
+		t.Fatalf("Expected an error for the missing parameter, but got the values %v", values)
+	}
+	if !strings.Contains(err.Error(), "'min'") || strings.Contains(err.Error(), "'max'") {
+		t.Fatalf("Expected an error naming only the missing parameter min, but got %s", err)
+	}
+
+	// also when executing
+	var names []string
+	if _, err = query.ListInto(func(name string) {
+		names = append(names, name)
+	}); err == nil {
+		t.Fatalf("Expected an error for the missing parameters, but got %v", names)
+	}
+
+	values, err = rsql.BuildValuesSafe(map[string]interface{}{"min": 10, "max": 20})
+	if err != nil {
+		t.Fatalf("Failed RunBuildValuesSafe: %s", err)
+	}
+	if fmt.Sprint(values) != "[10 20]" {
+		t.Fatalf("Expected the values [10 20], but got %v", values)
+	}
+}
+
+var errReplica = errors.New("reached the replica")
+
+// a replica that fails every connection, to know which queries reach it
+type replicaConnector struct {
+	driver driver.Driver
+}
+
+func (this replicaConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, errReplica
+}
+
+func (this replicaConnector) Driver() driver.Driver {
+	return this.driver
+}
+
+func RunReplica(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	primary, ok := TM.Store().GetConnection().(*sql.DB)
+	if !ok {
+		t.Fatalf("Expected the connection pool outside of a transaction, but got %T", TM.Store().GetConnection())
+	}
+	replica := sql.OpenDB(replicaConnector{primary.Driver()})
+	defer replica.Close()
+
+	translator := TM.Store().GetTranslator()
+	tm := NewTransactionManager(primary, func(inTx *bool, c dbx.IConnection) IDb {
+		return NewMyDb(inTx, c, translator, LANG)
+	}, 0).SetReplica(replica)
+
+	// outside of a transaction the queries go to the replica
+	var count int64
+	_, err := tm.Store().Query(BOOK).CountAll().SelectInto(&count)
+	if err == nil || !strings.Contains(err.Error(), errReplica.Error()) {
+		t.Fatalf("Expected the query to reach the replica, but got %v", err)
+	}
+
+	// unless forced to the primary
+	if _, err = tm.Store().Query(BOOK).CountAll().ForcePrimary().SelectInto(&count); err != nil {
+		t.Fatalf("Failed RunReplica: %s", err)
+	}
+	if count != 3 {
+		t.Fatalf("Expected 3 books, but got %v", count)
+	}
+
+	// the writes go to the primary
+	if _, err = tm.Store().Update(BOOK).Set(BOOK_C_PRICE, 10).Where(BOOK_C_ID.Matches(3)).Execute(); err != nil {
+		t.Fatalf("Failed RunReplica: %s", err)
+	}
+
+	// and inside a transaction everything goes to the primary
+	err = tm.Transaction(func(store IDb) error {
+		var price float64
+		if _, err := store.Query(BOOK).Column(BOOK_C_PRICE).Where(BOOK_C_ID.Matches(3)).SelectInto(&price); err != nil {
+			return err
+		}
+		if price != 10 {
+			t.Fatalf("Expected the updated price 10, but got %v", price)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed RunReplica: %s", err)
+	}
+}
+
+type ZeroBook struct {
+	Id      *int64
+	Version int64
+	Name    string
+	Price   float64
+}
+
+type NullZeroBook struct {
+	Id      *int64
+	Version int64
+	Name    string
+	Price   float64 `sql:"nullzero"`
+}
+
+func RunZeroModes(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	// TABLE registers the declarations as the table of Book
+	defer AddEntity(BOOK)
+	store := TM.Store()
+	price := func(id int64) *float64 {
+		var p *float64
+		if _, err := store.Query(BOOK).Column(BOOK_C_PRICE).Where(BOOK_C_ID.Matches(id)).SelectInto(&p); err != nil {
+			t.Fatalf("Failed RunZeroModes: %s", err)
+		}
+		return p
+	}
+
+	for k, mode := range []ZeroMode{ZERO_KEEP, ZERO_OMIT, ZERO_NULL} {
+		table := TABLE("BOOK")
+		table.KEY("ID")
+		table.VERSION("VERSION")
+		table.COLUMN("NAME")
+		switch column := table.COLUMN("PRICE"); mode {
+		case ZERO_OMIT:
+			column.OmitZero()
+		case ZERO_NULL:
+			column.NullZero()
+		}
+
+		id := int64(10 + k)
+		book := &ZeroBook{Id: &id, Name: "Zero"}
+		if _, err := store.Insert(table).Submit(book); err != nil {
+			t.Fatalf("Failed RunZeroModes: %s", err)
+		}
+		// the key returned for a given id is zero
+		book.Id = &id
+		// the table has no default for the price
+		if p := price(id); (mode == ZERO_KEEP) != (p != nil && *p == 0) {
+			t.Fatalf("Expected with the mode %v the inserted price 0 only when kept, but got %v", mode, p)
+		}
+
+		if _, err := store.Update(BOOK).Set(BOOK_C_PRICE, 5).Where(BOOK_C_ID.Matches(id)).Execute(); err != nil {
+			t.Fatalf("Failed RunZeroModes: %s", err)
+		}
+		if _, err := store.Update(table).Submit(book); err != nil {
+			t.Fatalf("Failed RunZeroModes: %s", err)
+		}
+		p := price(id)
+		switch mode {
+		case ZERO_KEEP:
+			if p == nil || *p != 0 {
+				t.Fatalf("Expected the updated price 0, but got %v", p)
+			}
+		case ZERO_OMIT:
+			if p == nil || *p != 5 {
+				t.Fatalf("Expected the price 5 to be kept, but got %v", p)
+			}
+		case ZERO_NULL:
+			if p != nil {
+				t.Fatalf("Expected the price to be updated to NULL, but got %v", *p)
+			}
+		}
+	}
+
+	// the tag takes precedence over the column
+	id := int64(20)
+	if _, err := store.Insert(BOOK).Submit(&NullZeroBook{Id: &id, Name: "Zero"}); err != nil {
+		t.Fatalf("Failed RunZeroModes: %s", err)
+	}
+	if p := price(id); p != nil {
+		t.Fatalf("Expected the price NULL of the nullzero tag, but got %v", *p)
+	}
+}
+
+func RunAutoTimestamps(TM ITransactionManager, t *testing.T) {
+	store := TM.Store()
+	timestamp := "TIMESTAMP"
+	if _, mysql := store.GetTranslator().(*translators.MySQL5Translator); mysql {
+		// otherwise the first TIMESTAMP column is set by MySQL on every update
+		timestamp = "TIMESTAMP NULL"
+	}
+	ddl := fmt.Sprintf("CREATE TABLE STAMPED (ID INTEGER NOT NULL PRIMARY KEY, VERSION INTEGER NOT NULL, NAME VARCHAR(50), CREATED_AT %s, UPDATED_AT %s)", timestamp, timestamp)
+	if _, err := store.ExecRaw(ddl); err != nil {
+		t.Fatalf("Failed RunAutoTimestamps: %s", err)
+	}
+	defer store.ExecRaw("DROP TABLE STAMPED")
+
+	// the plain declaration, to read and to reset the timestamps
+	var (
+		PLAIN           = TABLE("STAMPED")
+		PLAIN_C_ID      = PLAIN.KEY("ID")
+		PLAIN_C_CREATED = PLAIN.COLUMN("CREATED_AT")
+		PLAIN_C_UPDATED = PLAIN.COLUMN("UPDATED_AT")
+	)
+	type Stamped struct {
+		Id      *int64
+		Version int64
+		Name    string
+	}
+	old := time.Date(2000, time.June, 15, 12, 0, 0, 0, time.UTC)
+
+	for k, inSQL := range []bool{false, true} {
+		table := TABLE("STAMPED")
+		table.KEY("ID")
+		table.VERSION("VERSION")
+		table.COLUMN("NAME")
+		table.CREATED("CREATED_AT")
+		table.UPDATED("UPDATED_AT")
+		if inSQL {
+			table.TimestampInSQL()
+		}
+
+		id := int64(k + 1)
+		stamped := &Stamped{Id: &id, Name: "Stamped"}
+		if _, err := store.Insert(table).Submit(stamped); err != nil {
+			t.Fatalf("Failed RunAutoTimestamps: %s", err)
+		}
+		// the key returned for a given id is zero
+		stamped.Id = &id
+		var created, updated *time.Time
+		if _, err := store.Query(PLAIN).Column(PLAIN_C_CREATED, PLAIN_C_UPDATED).Where(PLAIN_C_ID.Matches(id)).SelectInto(&created, &updated); err != nil {
+			t.Fatalf("Failed RunAutoTimestamps: %s", err)
+		}
+		if created == nil || updated == nil || created.Year() <= 2000 || updated.Year() <= 2000 {
+			t.Fatalf("Expected both timestamps set on insert (in SQL: %v), but got %v and %v", inSQL, created, updated)
+		}
+
+		// an old time shows which timestamps the update sets
+		if _, err := store.Update(PLAIN).Set(PLAIN_C_CREATED, old).Set(PLAIN_C_UPDATED, old).Where(PLAIN_C_ID.Matches(id)).Execute(); err != nil {
+			t.Fatalf("Failed RunAutoTimestamps: %s", err)
+		}
+		stamped.Name = "Stamped again"
+		if _, err := store.Update(table).Submit(stamped); err != nil {
+			t.Fatalf("Failed RunAutoTimestamps: %s", err)
+		}
+		if _, err := store.Query(PLAIN).Column(PLAIN_C_CREATED, PLAIN_C_UPDATED).Where(PLAIN_C_ID.Matches(id)).SelectInto(&created, &updated); err != nil {
+			t.Fatalf("Failed RunAutoTimestamps: %s", err)
+		}
+		if created == nil || created.Year() != 2000 {
+			t.Fatalf("Expected the creation timestamp to be kept on update (in SQL: %v), but got %v", inSQL, created)
+		}
+		if updated == nil || updated.Year() <= 2000 {
+			t.Fatalf("Expected the modification timestamp set on update (in SQL: %v), but got %v", inSQL, updated)
+		}
+	}
+}
+
+func RunInterpolatedSQL(TM ITransactionManager, t *testing.T) {
+	store := TM.Store()
+	name := "Rock 'n' Roll"
+
+	// the quotes are doubled inside the string literal
+	sql := store.Query(BOOK).Column(BOOK_C_ID).Where(BOOK_C_NAME.Matches(name), BOOK_C_PRICE.Greater(10)).InterpolatedSQL()
+	if !strings.Contains(sql, "'Rock ''n'' Roll'") || !strings.Contains(sql, "> 10") {
+		t.Fatalf("Expected the quoted name and the price in the interpolated SQL, but got %s", sql)
+	}
+
+	// nil values and nil pointers are rendered as NULL
+	var price *float64
+	sql = store.Update(BOOK).Set(BOOK_C_NAME, name).Set(BOOK_C_PRICE, price).Where(BOOK_C_ID.Matches(1)).InterpolatedSQL()
+	if !strings.Contains(sql, "'Rock ''n'' Roll'") || !strings.Contains(sql, "= NULL") {
+		t.Fatalf("Expected the quoted name and NULL in the interpolated SQL, but got %s", sql)
+	}
+	sql = store.Update(BOOK).Set(BOOK_C_PRICE, nil).Where(BOOK_C_ID.Matches(1)).InterpolatedSQL()
+	if !strings.Contains(sql, "= NULL") {
+		t.Fatalf("Expected NULL in the interpolated SQL, but got %s", sql)
+	}
+}
+
+func RunIgnoreExtraColumns(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	dba := dbx.NewSimpleDBA(TM.Store().GetConnection())
+	sql := "SELECT NAME, PRICE FROM BOOK WHERE ID = 2"
+	var name string
+
+	// by default more columns than destinations is a failure
+	_, err := dba.QueryRow(sql, nil, &name)
+	var fail *dbx.PersistenceFail
+	if !errors.As(err, &fail) || fail.Code != dbx.FAULT_SCAN {
+		t.Fatalf("Expected the failure %s for the extra column, but got %v", dbx.FAULT_SCAN, err)
+	}
+
+	ok, err := dba.IgnoreExtraColumns(true).QueryRow(sql, nil, &name)
+	if err != nil {
+		t.Fatalf("Failed RunIgnoreExtraColumns: %s", err)
+	}
+	if !ok || name != "Cookbook" {
+		t.Fatalf("Expected the name Cookbook, but got %v and %q", ok, name)
+	}
+
+	// less columns than destinations is always a failure
+	var price float64
+	var other string
+	if _, err = dba.QueryRow(sql, nil, &name, &price, &other); !errors.As(err, &fail) || fail.Code != dbx.FAULT_SCAN {
+		t.Fatalf("Expected the failure %s for the missing column, but got %v", dbx.FAULT_SCAN, err)
+	}
+}
+
+func RunOrderCollation(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	translator := store.GetTranslator()
+	// the expression of the single ascending order
+	orderBy := func(query *Query) string {
+		rsql, err := query.GetCachedSQL()
+		if err != nil {
+			t.Fatalf("Failed RunOrderCollation: %s", err)
+		}
+		sql := rsql.OriSql
+		return strings.TrimSuffix(sql[strings.LastIndex(sql, "ORDER BY ")+len("ORDER BY "):], " ASC")
+	}
+
+	// the collation names are database specific, so only the SQL is checked
+	plain := orderBy(store.Query(BOOK).Column(BOOK_C_NAME).OrderBy(BOOK_C_NAME))
+	order := orderBy(store.Query(BOOK).Column(BOOK_C_NAME).OrderBy(BOOK_C_NAME).Collate("C"))
+	if expected := translator.Collate(plain, "C"); order != expected {
+		t.Fatalf("Expected the order %s, but got %s", expected, order)
+	}
+	order = orderBy(store.Query(BOOK).Column(BOOK_C_NAME).OrderBy(BOOK_C_NAME).IgnoreCase().Collate("C"))
+	if expected := translator.Collate("LOWER("+plain+")", "C"); order != expected {
+		t.Fatalf("Expected the order %s, but got %s", expected, order)
+	}
+
+	// inside an expression, the alias is replaced by the column expression
+	order = orderBy(store.Query(BOOK).Column(BOOK_C_NAME).As("title").OrderByAs("title").IgnoreCase())
+	if expected := "LOWER(" + plain + ")"; order != expected {
+		t.Fatalf("Expected the order %s, but got %s", expected, order)
+	}
+
+	// except with unions, where only the alias is known
+	union := func() *Query {
+		return store.Query(BOOK).Column(BOOK_C_NAME).As("title").Where(BOOK_C_ID.Matches(1)).
+			UnionAll(store.Query(BOOK).Alias("u").Column(BOOK_C_NAME).As("title").Where(BOOK_C_ID.Matches(2)))
+	}
+	alias := orderBy(union().OrderByAs("title"))
+	order = orderBy(union().OrderByAs("title").IgnoreCase())
+	if expected := "LOWER(" + alias + ")"; order != expected || alias == plain {
+		t.Fatalf("Expected the order %s by the alias, but got %s", expected, order)
+	}
+
+	// with a lower case name, only the case insensitive order is the same in every database
+	if _, err := store.Update(BOOK).Set(BOOK_C_NAME, "apples").Where(BOOK_C_ID.Matches(3)).Execute(); err != nil {
+		t.Fatalf("Failed RunOrderCollation: %s", err)
+	}
+	var names []string
+	if _, err := store.Query(BOOK).Column(BOOK_C_NAME).OrderBy(BOOK_C_NAME).IgnoreCase().ListInto(func(name string) {
+		names = append(names, name)
+	}); err != nil {
+		t.Fatalf("Failed RunOrderCollation: %s", err)
+	}
+	if fmt.Sprint(names) != "[apples Cookbook Once Upon a Time...]" {
+		t.Fatalf("Expected the names ordered ignoring the case, but got %v", names)
+	}
+}
+
+func RunExecuteResult(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	result, err := store.Update(BOOK).Set(BOOK_C_PRICE, 10).Where(BOOK_C_PUBLISHER_ID.Matches(2)).ExecuteResult()
+	if err != nil {
+		t.Fatalf("Failed RunExecuteResult: %s", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		t.Fatalf("Failed RunExecuteResult: %s", err)
+	}
+	if affected != 2 {
+		t.Fatalf("Expected 2 affected rows, but got %v", affected)
+	}
+
+	var count int64
+	if _, err = store.Query(BOOK).CountAll().Where(BOOK_C_PRICE.Matches(10)).SelectInto(&count); err != nil {
+		t.Fatalf("Failed RunExecuteResult: %s", err)
+	}
+	if count != 2 {
+		t.Fatalf("Expected 2 updated books, but got %v", count)
+	}
+}
+
+// collects the debug messages
+type debugLogger struct {
+	messages []string
+}
+
+func (this *debugLogger) IsDebug() bool { return true }
+
+func (this *debugLogger) Debugf(format string, args ...interface{}) {
+	this.messages = append(this.messages, fmt.Sprintf(format, args...))
+}
+
+func (this *debugLogger) Warnf(format string, args ...interface{}) {}
+
+func (this *debugLogger) Errorf(format string, args ...interface{}) {}
+
+func (this *debugLogger) String() string {
+	return strings.Join(this.messages, "\n")
+}
+
+func RunSetLogger(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	logger := new(debugLogger)
+	store.SetLogger(logger)
+
+	query := store.Query(BOOK).Column(BOOK_C_NAME).Where(BOOK_C_ID.Matches(2))
+	var name string
+	if _, err := query.SelectInto(&name); err != nil {
+		t.Fatalf("Failed RunSetLogger: %s", err)
+	}
+	if _, err := store.Update(BOOK).Set(BOOK_C_PRICE, 10).Where(BOOK_C_ID.Matches(2)).Execute(); err != nil {
+		t.Fatalf("Failed RunSetLogger: %s", err)
+	}
+
+	rsql, err := query.GetCachedSQL()
+	if err != nil {
+		t.Fatalf("Failed RunSetLogger: %s", err)
+	}
+	output := logger.String()
+	if !strings.Contains(output, rsql.OriSql) || !strings.Contains(output, "SQL: UPDATE") {
+		t.Fatalf("Expected the query and the update SQL in the injected logger, but got %s", output)
+	}
+}
+
+func RunSecretParameters(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	// a secret column
+	var (
+		SECRET_BOOK        = TABLE("BOOK")
+		SECRET_BOOK_C_ID   = SECRET_BOOK.KEY("ID")
+		SECRET_BOOK_C_NAME = SECRET_BOOK.COLUMN("NAME").Secret()
+	)
+	defer AddEntity(BOOK)
+
+	SecretParameters("bookName")
+
+	store := TM.Store()
+	logger := new(debugLogger)
+	store.SetLogger(logger)
+
+	byRegistry := store.Query(BOOK).Column(BOOK_C_ID).Where(BOOK_C_NAME.Matches(Param("bookName")))
+	byRegistry.SetParameter("bookName", "Cookbook")
+	bySuffix := store.Query(BOOK).Column(BOOK_C_ID).Where(BOOK_C_NAME.Matches(Param("name" + SECRET_SUFFIX)))
+	bySuffix.SetParameter("name"+SECRET_SUFFIX, "Cookbook")
+	byColumn := store.Query(SECRET_BOOK).Column(SECRET_BOOK_C_ID).Where(SECRET_BOOK_C_NAME.Matches("Cookbook"))
+
+	for _, query := range []*Query{byRegistry, bySuffix, byColumn} {
+		var id int64
+		if _, err := query.SelectInto(&id); err != nil {
+			t.Fatalf("Failed RunSecretParameters: %s", err)
+		}
+		if id != 2 {
+			t.Fatalf("Expected the book 2, but got %v", id)
+		}
+		if sql := query.InterpolatedSQL(); strings.Contains(sql, "Cookbook") || !strings.Contains(sql, "'****'") {
+			t.Fatalf("Expected the secret value masked in the interpolated SQL, but got %s", sql)
+		}
+	}
+
+	output := logger.String()
+	if strings.Contains(output, "Cookbook") || strings.Count(output, "=****]") != 3 {
+		t.Fatalf("Expected the secret values masked in the debug output, but got %s", output)
+	}
+}
+
+func RunCallProc(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	store := TM.Store()
+	if _, err := store.ExecRaw(PROC_CREATE); err != nil {
+		t.Fatalf("Failed RunCallProc: %s", err)
+	}
+	defer store.ExecRaw(PROC_DROP)
+
+	dba := dbx.NewSimpleDBA(store.GetConnection())
+	results, err := dba.CallProc(PROC_CALL, []dbx.IRowTransformer{dbx.NewMapTransformer().Ordered(true)}, 2)
+	if err != nil {
+		t.Fatalf("Failed RunCallProc: %s", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result set, but got %v", len(results))
+	}
+	var names []interface{}
+	for _, e := range results[0].Elements() {
+		names = append(names, e.(*dbx.OrderedRow).Values[0])
+	}
+	if fmt.Sprint(names) != "[Cookbook Scrapbook]" {
+		t.Fatalf("Expected the books [Cookbook Scrapbook], but got %v", names)
+	}
+}
+
+func RunIncludeIf(TM ITransactionManager, t *testing.T) {
+	ResetDB(TM)
+
+	type Dto struct {
+		Id    *int64
+		Name  string
+		Price *float64
+	}
+
+	for _, include := range []bool{true, false} {
+		var dtos []*Dto
+		err := TM.Store().Query(PUBLISHER).
+			Column(PUBLISHER_C_ID, PUBLISHER_C_NAME).
+			Inner(PUBLISHER_A_BOOKS).
+			IncludeIf(include, BOOK_C_PRICE).
+			Join().
+			Where(PUBLISHER_C_ID.Matches(1)).
+			List(&dtos)
+		if err != nil {
+			t.Fatalf("Failed RunIncludeIf: %s", err)
+		}
+
+		// the join is kept, only the column is optional
+		if len(dtos) != 1 || dtos[0].Name != "Geek Publications" {
+			t.Fatalf("Expected the publisher Geek Publications (include: %v), but got %v rows", include, len(dtos))
+		}
+		price := dtos[0].Price
+		if include && (price == nil || *price != 34.5) {
+			t.Fatalf("Expected the included price 34.5, but got %v", price)
+		}
+		if !include && price != nil {
+			t.Fatalf("Expected no price when not included, but got %v", *price)
+		}
+	}
+}
@@ -227,7 +227,7 @@ var (
 	BOOK_C_ID           = BOOK.KEY("ID")
 	BOOK_C_VERSION      = BOOK.VERSION("VERSION")
 	BOOK_C_NAME         = BOOK.COLUMN("NAME")
-	BOOK_C_PRICE        = BOOK.COLUMN("PRICE")
+	BOOK_C_PRICE        = BOOK.COLUMN("PRICE").Type(TYPE_DECIMAL)
 	BOOK_C_PUBLISHED    = BOOK.COLUMN("PUBLISHED")
 	BOOK_C_PUBLISHER_ID = BOOK.COLUMN("PUBLISHER_ID")
 
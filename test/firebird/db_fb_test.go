@@ -19,6 +19,14 @@ func InitFirebirdSQL() (ITransactionManager, *sql.DB) {
 	logger.Infof("******* Using FirebirdSQL *******\n")
 
 	common.RAW_SQL = "SELECT name FROM book WHERE name LIKE ?"
+	// a selectable procedure
+	common.PROC_CREATE = `CREATE PROCEDURE BOOKS_OF(PUB INTEGER) RETURNS (NAME VARCHAR(100)) AS
+BEGIN
+	FOR SELECT NAME FROM BOOK WHERE PUBLISHER_ID = :PUB ORDER BY ID INTO :NAME DO
+		SUSPEND;
+END`
+	common.PROC_CALL = "SELECT NAME FROM BOOKS_OF(?)"
+	common.PROC_DROP = "DROP PROCEDURE BOOKS_OF"
 
 	translator := trx.NewFirebirdSQLTranslator()
 	translator.RegisterTranslation(
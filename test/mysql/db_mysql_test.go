@@ -19,6 +19,9 @@ func InitMySQL5() (ITransactionManager, *sql.DB) {
 	logger.Infof("******* Using MySQL5 *******\n")
 
 	common.RAW_SQL = "SELECT `NAME` FROM `BOOK` WHERE `NAME` LIKE ?"
+	common.PROC_CREATE = "CREATE PROCEDURE BOOKS_OF(IN PUB BIGINT) BEGIN SELECT `NAME` FROM `BOOK` WHERE `PUBLISHER_ID` = PUB ORDER BY ID; END"
+	common.PROC_CALL = "CALL BOOKS_OF(?)"
+	common.PROC_DROP = "DROP PROCEDURE BOOKS_OF"
 
 	translator := trx.NewMySQL5Translator()
 	/*
@@ -45,3 +48,24 @@ func TestMySQL5(t *testing.T) {
 	common.RunAll(tm, t)
 	theDB.Close()
 }
+
+func TestMySQL5LastInsertId(t *testing.T) {
+	translator := trx.NewMySQL5Translator().UseLastInsertId(true)
+	tm, theDB := common.InitDB("mysql", "root:root@/gosql?parseTime=true", translator)
+	defer theDB.Close()
+
+	common.RunInsertReturningKey(tm, t)
+	common.RunInsertStructReturningKey(tm, t)
+
+	key, err := tm.Store().Insert(common.PUBLISHER).
+		ReturnId(false).
+		Columns(common.PUBLISHER_C_VERSION, common.PUBLISHER_C_NAME).
+		Values(1, "No Key Editions").
+		Execute()
+	if err != nil {
+		t.Fatalf("Failed TestMySQL5LastInsertId: %s", err)
+	}
+	if key != 0 {
+		t.Fatalf("Expected no key without ReturnId, but got %v", key)
+	}
+}
@@ -21,6 +21,16 @@ func InitOracle() (ITransactionManager, *sql.DB) {
 	logger.Infof("******* Using Oracle *******\n")
 
 	common.RAW_SQL = "SELECT name FROM book WHERE name LIKE ?"
+	// a pipelined function, since the driver does not read the result sets of a procedure
+	common.PROC_CREATE = `CREATE FUNCTION BOOKS_OF(PUB NUMBER) RETURN SYS.ODCIVARCHAR2LIST PIPELINED AS
+BEGIN
+	FOR B IN (SELECT NAME FROM BOOK WHERE PUBLISHER_ID = PUB ORDER BY ID) LOOP
+		PIPE ROW(B.NAME);
+	END LOOP;
+	RETURN;
+END;`
+	common.PROC_CALL = "SELECT COLUMN_VALUE FROM TABLE(BOOKS_OF(?))"
+	common.PROC_DROP = "DROP FUNCTION BOOKS_OF"
 
 	translator := trx.NewOracleTranslator()
 	translator.RegisterTranslation(
@@ -19,6 +19,9 @@ func InitPostgreSQL() (ITransactionManager, *sql.DB) {
 	logger.Infof("******* Using PostgreSQL *******\n")
 
 	common.RAW_SQL = "SELECT name FROM book WHERE name LIKE $1"
+	common.PROC_CREATE = "CREATE FUNCTION BOOKS_OF(BIGINT) RETURNS SETOF VARCHAR AS 'SELECT name FROM book WHERE publisher_id = $1 ORDER BY id' LANGUAGE SQL"
+	common.PROC_CALL = "SELECT * FROM BOOKS_OF($1)"
+	common.PROC_DROP = "DROP FUNCTION BOOKS_OF(BIGINT)"
 
 	translator := trx.NewPostgreSQLTranslator()
 	translator.RegisterTranslation(
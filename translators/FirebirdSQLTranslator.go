@@ -2,6 +2,7 @@ package translators
 
 import (
 	"github.com/quintans/goSQL/db"
+	"github.com/quintans/goSQL/dbx"
 	tk "github.com/quintans/toolkit"
 	"strings"
 )
@@ -16,10 +17,24 @@ func NewFirebirdSQLTranslator() *FirebirdSQLTranslator {
 	this := new(FirebirdSQLTranslator)
 	this.GenericTranslator = new(GenericTranslator)
 	this.Init(this)
+	// Firebird has no row values
+	this.RegisterTranslation(db.TOKEN_IN_TUPLE, this.InTupleAsOr)
+	this.RegisterTranslation(db.TOKEN_DEFAULT, this.DefaultAsOmitted)
+	this.RegisterTranslation(db.TOKEN_GREATEST, FunctionOf("MAXVALUE"))
+	this.RegisterTranslation(db.TOKEN_LEAST, FunctionOf("MINVALUE"))
+	this.RegisterTranslation(db.TOKEN_STRING_AGG, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
+		m := token.GetMembers()
+		if len(m) > 2 {
+			panic("goSQL: The ORDER BY of a string aggregation is not supported by Firebird")
+		}
+		return "LIST(" + tx.Translate(dmlType, m[0]) + ", " + tx.Translate(dmlType, m[1]) + ")"
+	})
 	this.QueryProcessorFactory = func() QueryProcessor { return NewQueryBuilder(this) }
 	this.InsertProcessorFactory = func() InsertProcessor { return NewInsertBuilder(this) }
 	this.UpdateProcessorFactory = func() UpdateProcessor { return NewUpdateBuilder(this) }
 	this.DeleteProcessorFactory = func() DeleteProcessor { return NewDeleteBuilder(this) }
+	// a list of values is limited to 1500 expressions
+	this.SetMaxInValues(1500)
 	return this
 }
 
@@ -34,15 +49,53 @@ func (this *FirebirdSQLTranslator) GetAutoNumberQuery(column *db.Column) string
 // INSERT
 // 2013-06-15: available odbc drivers do not implement RETURNING
 
+// Firebird has no truncate
+func (this *FirebirdSQLTranslator) GetSqlForTruncate(truncate *db.Truncate) string {
+	return this.TruncateAsDelete(truncate)
+}
+
+func (this *FirebirdSQLTranslator) GetSqlForCreateTableAs(query *db.Query, table *db.Table) string {
+	panic("goSQL: CREATE TABLE AS is not supported by Firebird")
+}
+
+func (this *FirebirdSQLTranslator) GetSqlForPing() string {
+	return "SELECT 1 FROM RDB$DATABASE"
+}
+
 func (this *FirebirdSQLTranslator) TableName(table *db.Table) string {
 	return "\"" + strings.ToUpper(table.GetName()) + "\""
 }
 
+func (this *FirebirdSQLTranslator) SchemaName(schema string) string {
+	return "\"" + strings.ToUpper(schema) + "\""
+}
+
+func (this *FirebirdSQLTranslator) IdentifierCase() dbx.IdentifierCase {
+	return dbx.CASE_UPPER
+}
+
 func (this *FirebirdSQLTranslator) ColumnName(column *db.Column) string {
 	return "\"" + strings.ToUpper(column.GetName()) + "\""
 }
 
+// Firebird only supports pessimistic locking with FOR UPDATE WITH LOCK
+func (this *FirebirdSQLTranslator) LockSQL(query *db.Query, sql string) string {
+	switch query.GetLockMode() {
+	case db.LOCK_NONE:
+		return sql
+	case db.LOCK_FOR_SHARE:
+		panic("goSQL: FOR SHARE is not supported by Firebird")
+	}
+	if query.GetLockWait() != db.LOCK_WAIT {
+		panic("goSQL: NOWAIT and SKIP LOCKED are not supported by Firebird")
+	}
+	return sql + " FOR UPDATE WITH LOCK"
+}
+
 func (this *FirebirdSQLTranslator) PaginateSQL(query *db.Query, sql string) string {
+	if query.IsWithTies() {
+		panic("goSQL: WITH TIES is not supported by Firebird")
+	}
 	sb := tk.NewStrBuffer()
 	if query.GetLimit() > 0 {
 		sb.Add(sql, " ROWS ")
@@ -53,6 +106,11 @@ func (this *FirebirdSQLTranslator) PaginateSQL(query *db.Query, sql string) stri
 		sb.Add(":", db.LIMIT_PARAM)
 		query.SetParameter(db.LIMIT_PARAM, query.GetSkip()+query.GetLimit())
 
+		return sb.String()
+	} else if query.GetSkip() > 0 {
+		// ROWS has no open end, so the last row is the largest possible
+		sb.Add(sql, " ROWS :", db.OFFSET_PARAM, " TO 2147483647")
+		query.SetParameter(db.OFFSET_PARAM, query.GetSkip()+1)
 		return sb.String()
 	}
 
@@ -2,10 +2,12 @@ package translators
 
 import (
 	"github.com/quintans/goSQL/db"
+	"github.com/quintans/goSQL/dbx"
 	tk "github.com/quintans/toolkit"
 
 	"fmt"
 	"strconv"
+	"time"
 )
 
 type IJoiner interface {
@@ -42,6 +44,8 @@ type QueryProcessor interface {
 
 type QueryBuilder struct {
 	translator db.Translator
+	// resolves the schemas of the tables
+	store      db.IDb
 	columnPart *tk.Joiner
 	fromPart   *tk.Joiner
 	joinPart   *tk.StrBuffer
@@ -114,12 +118,14 @@ func (this *QueryBuilder) Column(query *db.Query) {
 }
 
 func (this *QueryBuilder) From(query *db.Query) {
+	this.store = query.GetDb()
 	table := query.GetTable()
 	alias := query.GetTableAlias()
-	this.fromPart.AddAsOne(this.translator.TableName(table), " ", alias)
+	this.fromPart.AddAsOne(QualifiedTableName(this.translator, this.store, table), " ", alias)
 }
 
 func (this *QueryBuilder) FromSubQuery(query *db.Query) {
+	this.store = query.GetDb()
 	subquery := query.GetSubQuery()
 	alias := query.GetSubQueryAlias()
 	this.fromPart.AddAsOne("(", this.translator.GetSqlForQuery(subquery), ")")
@@ -135,7 +141,7 @@ func (this *QueryBuilder) JoinAssociation(fk *db.Association, inner bool) {
 		this.joinPart.Add(" LEFT OUTER JOIN ")
 	}
 
-	this.joinPart.Add(this.translator.TableName(fk.GetTableTo()), " ", fk.GetAliasTo(), " ON ")
+	this.joinPart.Add(QualifiedTableName(this.translator, this.store, fk.GetTableTo()), " ", fk.GetAliasTo(), " ON ")
 
 	for i, rel := range fk.GetRelations() {
 		if i > 0 {
@@ -176,11 +182,7 @@ func (this *QueryBuilder) Having(query *db.Query) {
 func (this *QueryBuilder) Order(query *db.Query) {
 	orders := query.GetOrders()
 	for _, ord := range orders {
-		if ord.GetHolder() != nil {
-			this.orderPart.Add(this.translator.Translate(db.QUERY, ord.GetHolder()))
-		} else {
-			this.orderPart.Add(ord.GetAlias())
-		}
+		this.orderPart.Add(OrderExpression(this.translator, query, ord))
 
 		if ord.IsAsc() {
 			this.orderPart.Append(" ASC")
@@ -190,6 +192,43 @@ func (this *QueryBuilder) Order(query *db.Query) {
 	}
 }
 
+// OrderExpression translates the order by expression, applying the case and the collation
+func OrderExpression(translator db.Translator, query *db.Query, ord *db.Order) string {
+	var str string
+	if ord.GetHolder() != nil {
+		str = translator.Translate(db.QUERY, ord.GetHolder())
+	} else {
+		str = OrderAlias(translator, query, ord)
+	}
+	if ord.IsIgnoreCase() {
+		str = "LOWER(" + str + ")"
+	}
+	if ord.GetCollation() != "" {
+		str = translator.Collate(str, ord.GetCollation())
+	}
+	return str
+}
+
+// OrderAlias translates the order by a column alias of the query.
+// A plain order uses the alias rendered in the SELECT, but inside an expression,
+// like LOWER or COLLATE, some databases do not see the SELECT aliases,
+// so the column expression is repeated, unless the query has unions.
+// An alias not declared in the query is used as is.
+func OrderAlias(translator db.Translator, query *db.Query, ord *db.Order) string {
+	if query != nil {
+		for k, column := range query.Columns {
+			if column.GetAlias() != ord.GetAlias() {
+				continue
+			}
+			if (ord.IsIgnoreCase() || ord.GetCollation() != "") && len(query.GetUnions()) == 0 {
+				return translator.Translate(db.QUERY, column)
+			}
+			return translator.ColumnAlias(column, k+1)
+		}
+	}
+	return ord.GetAlias()
+}
+
 func (this *QueryBuilder) Union(query *db.Query) {
 	unions := query.GetUnions()
 	for _, u := range unions {
@@ -208,6 +247,8 @@ func (this *QueryBuilder) Union(query *db.Query) {
  */
 
 type UpdateProcessor interface {
+	IJoiner
+
 	Column(update *db.Update)
 	From(update *db.Update)
 	ColumnPart() string
@@ -218,6 +259,8 @@ type UpdateProcessor interface {
 
 type UpdateBuilder struct {
 	translator db.Translator
+	// resolves the schemas of the tables
+	store      db.IDb
 	columnPart *tk.Joiner
 	tablePart  *tk.Joiner
 	wherePart  *tk.Joiner
@@ -249,6 +292,20 @@ func (this *UpdateBuilder) WherePart() string {
 	return this.wherePart.String()
 }
 
+// the joins that come after the SET
+func (this *UpdateBuilder) JoinPart() string {
+	return ""
+}
+
+// the standard UPDATE has no joins. The dialects that support them must override this.
+func (this *UpdateBuilder) JoinAssociation(fk *db.Association, inner bool) {
+	panic("goSQL: UPDATE with joins is not supported by this database")
+}
+
+func (this *UpdateBuilder) JoinCriteria(criteria *db.Criteria) {
+	panic("goSQL: UPDATE with joins is not supported by this database")
+}
+
 func (this *UpdateBuilder) Column(update *db.Update) {
 	values := update.GetValues()
 	tableAlias := update.GetTableAlias()
@@ -264,9 +321,10 @@ func (this *UpdateBuilder) Column(update *db.Update) {
 }
 
 func (this *UpdateBuilder) From(update *db.Update) {
+	this.store = update.GetDb()
 	table := update.GetTable()
 	alias := update.GetTableAlias()
-	this.tablePart.AddAsOne(this.translator.TableName(table), " ", alias)
+	this.tablePart.AddAsOne(QualifiedTableName(this.translator, this.store, table), " ", alias)
 }
 
 func (this *UpdateBuilder) Where(update *db.Update) {
@@ -283,6 +341,8 @@ func (this *UpdateBuilder) Where(update *db.Update) {
  */
 
 type DeleteProcessor interface {
+	IJoiner
+
 	From(del *db.Delete)
 	TablePart() string
 	Where(del *db.Delete)
@@ -291,8 +351,11 @@ type DeleteProcessor interface {
 
 type DeleteBuilder struct {
 	translator db.Translator
-	tablePart  *tk.Joiner
-	wherePart  *tk.Joiner
+	// resolves the schemas of the tables
+	store     db.IDb
+	tablePart *tk.Joiner
+	joinPart  *tk.StrBuffer
+	wherePart *tk.Joiner
 }
 
 func NewDeleteBuilder(translator db.Translator) *DeleteBuilder {
@@ -305,6 +368,7 @@ func (this *DeleteBuilder) Super(translator db.Translator) {
 	this.translator = translator
 
 	this.tablePart = tk.NewJoiner(", ")
+	this.joinPart = tk.NewStrBuffer()
 	this.wherePart = tk.NewJoiner(" AND ")
 }
 
@@ -312,14 +376,28 @@ func (this *DeleteBuilder) TablePart() string {
 	return this.tablePart.String()
 }
 
+func (this *DeleteBuilder) JoinPart() string {
+	return this.joinPart.String()
+}
+
+// the standard DELETE has no joins. The dialects that support them must override this.
+func (this *DeleteBuilder) JoinAssociation(fk *db.Association, inner bool) {
+	panic("goSQL: DELETE with joins is not supported by this database")
+}
+
+func (this *DeleteBuilder) JoinCriteria(criteria *db.Criteria) {
+	panic("goSQL: DELETE with joins is not supported by this database")
+}
+
 func (this *DeleteBuilder) WherePart() string {
 	return this.wherePart.String()
 }
 
 func (this *DeleteBuilder) From(del *db.Delete) {
+	this.store = del.GetDb()
 	table := del.GetTable()
 	alias := del.GetTableAlias()
-	this.tablePart.AddAsOne(this.translator.TableName(table), " ", alias)
+	this.tablePart.AddAsOne(QualifiedTableName(this.translator, this.store, table), " ", alias)
 }
 
 func (this *DeleteBuilder) Where(del *db.Delete) {
@@ -408,7 +486,7 @@ func (this *InsertBuilder) Column(insert *db.Insert) {
 
 func (this *InsertBuilder) From(insert *db.Insert) {
 	table := insert.GetTable()
-	this.tablePart.Add(this.translator.TableName(table))
+	this.tablePart.Add(QualifiedTableName(this.translator, insert.GetDb(), table))
 }
 
 /*
@@ -424,7 +502,25 @@ type GenericTranslator struct {
 	InsertProcessorFactory func() InsertProcessor
 	UpdateProcessorFactory func() UpdateProcessor
 	DeleteProcessorFactory func() DeleteProcessor
-}
+	placeholder            PlaceholderFormatter
+	materializationHints   bool // renders the MATERIALIZED hint of the common table expressions
+	maxParameters          int  // the maximum number of parameters of a statement
+	maxInValues            int  // the maximum number of values of an IN list
+}
+
+// PlaceholderFormatter returns the driver placeholder for the parameter at the zero based index
+type PlaceholderFormatter func(index int) string
+
+var (
+	// ?
+	QuestionPlaceholder PlaceholderFormatter = func(index int) string { return "?" }
+	// $1, $2, ... (ex: lib/pq)
+	DollarPlaceholder PlaceholderFormatter = func(index int) string { return "$" + strconv.Itoa(index+1) }
+	// :1, :2, ... (ex: go-oci8)
+	ColonPlaceholder PlaceholderFormatter = func(index int) string { return ":" + strconv.Itoa(index+1) }
+	// @p1, @p2, ... (ex: go-mssqldb)
+	AtPlaceholder PlaceholderFormatter = func(index int) string { return "@p" + strconv.Itoa(index+1) }
+)
 
 func RolloverParameter(dmlType db.DmlType, tx db.Translator, parameters []db.Tokener, separator string) string {
 	sb := tk.NewStrBuffer()
@@ -437,6 +533,23 @@ func RolloverParameter(dmlType db.DmlType, tx db.Translator, parameters []db.Tok
 	return sb.String()
 }
 
+// filterCase is the CASE WHEN criteria THEN value END of a filtered aggregate
+func filterCase(criteria db.Tokener, value db.Tokener) db.Tokener {
+	when := db.NewToken(db.TOKEN_CASE_WHEN)
+	when.SetMembers(criteria, value)
+	caseToken := db.NewToken(db.TOKEN_CASE)
+	caseToken.SetMembers(when)
+	return caseToken
+}
+
+// aggOrderBy renders the ORDER BY inside an aggregate function, preceded by a space
+func aggOrderBy(dmlType db.DmlType, tx db.Translator, orderBy []db.Tokener) string {
+	if len(orderBy) == 0 {
+		return ""
+	}
+	return " ORDER BY " + RolloverParameter(dmlType, tx, orderBy, ", ")
+}
+
 func (this *GenericTranslator) Init(overrider db.Translator) {
 	this.overrider = overrider
 	this.tokens = make(map[string]func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string)
@@ -444,6 +557,11 @@ func (this *GenericTranslator) Init(overrider db.Translator) {
 	// Column
 	this.RegisterTranslation(db.TOKEN_COLUMN, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
 		if col, ok := token.GetValue().(*db.Column); ok {
+			if col.IsVirtual() {
+				// the expression columns are resolved with the alias of the virtual column
+				expr := col.VirtualFor(token.GetTableAlias())
+				return "(" + tx.Translate(dmlType, expr) + ")"
+			}
 			sb := tk.NewStrBuffer()
 			if token.GetTableAlias() != "" {
 				sb.Add(token.GetTableAlias())
@@ -458,16 +576,22 @@ func (this *GenericTranslator) Init(overrider db.Translator) {
 	})
 
 	// Match
-	this.RegisterTranslation(db.TOKEN_EQ, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
-		o := token.GetMembers()
-		return tx.Translate(dmlType, o[0]) + " = " + tx.Translate(dmlType, o[1])
-	})
+	// = ANY is rendered as the equivalent IN, since not all the databases have ANY
+	this.RegisterTranslation(db.TOKEN_EQ, this.MatchesAnyAsIn)
 
 	// Match
 	this.RegisterTranslation(db.TOKEN_NULL, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
 		return "NULL"
 	})
 
+	this.RegisterTranslation(db.TOKEN_DEFAULT, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
+		return "DEFAULT"
+	})
+
+	this.RegisterTranslation(db.TOKEN_NOW, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
+		return "CURRENT_TIMESTAMP"
+	})
+
 	// Val
 	handle := func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
 		o := token.GetValue()
@@ -565,8 +689,30 @@ func (this *GenericTranslator) Init(overrider db.Translator) {
 		if c, ok := token.(*db.Criteria); ok {
 			return fmt.Sprintf(
 				pattern,
+				tx.Translate(dmlType, m[0]),
 				this.isNot(c),
+				RolloverParameter(dmlType, tx, m[1:], ", "),
+			)
+		}
+		return ""
+	})
+
+	// Tuple
+	this.RegisterTranslation(db.TOKEN_TUPLE, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
+		return "(" + RolloverParameter(dmlType, tx, token.GetMembers(), ", ") + ")"
+	})
+
+	// In Tuple
+	this.RegisterTranslation(db.TOKEN_IN_TUPLE, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
+		m := token.GetMembers()
+		if c, ok := token.(*db.Criteria); ok {
+			if len(m) == 1 {
+				return this.emptyIn(c)
+			}
+			return fmt.Sprintf(
+				"%s%s IN (%s)",
 				tx.Translate(dmlType, m[0]),
+				this.isNot(c),
 				RolloverParameter(dmlType, tx, m[1:], ", "),
 			)
 		}
@@ -576,12 +722,18 @@ func (this *GenericTranslator) Init(overrider db.Translator) {
 	// Or
 	this.RegisterTranslation(db.TOKEN_OR, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
 		m := token.GetMembers()
+		if c, ok := token.(*db.Criteria); ok && c.IsNot {
+			return fmt.Sprintf("NOT (%s)", RolloverParameter(dmlType, tx, m, " OR "))
+		}
 		return fmt.Sprintf("(%s)", RolloverParameter(dmlType, tx, m, " OR "))
 	})
 
 	// And
 	this.RegisterTranslation(db.TOKEN_AND, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
 		m := token.GetMembers()
+		if c, ok := token.(*db.Criteria); ok && c.IsNot {
+			return fmt.Sprintf("NOT (%s)", RolloverParameter(dmlType, tx, m, " AND "))
+		}
 		return fmt.Sprintf("%s", RolloverParameter(dmlType, tx, m, " AND "))
 	})
 
@@ -641,12 +793,16 @@ func (this *GenericTranslator) Init(overrider db.Translator) {
 	// exists
 	this.RegisterTranslation(db.TOKEN_EXISTS, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
 		m := token.GetMembers()
-		return fmt.Sprintf("EXISTS %s", tx.Translate(dmlType, m[0]))
+		var not string
+		if c, ok := token.(*db.Criteria); ok && c.IsNot {
+			not = "NOT "
+		}
+		return fmt.Sprintf("%sEXISTS %s", not, tx.Translate(dmlType, m[0]))
 	})
 
 	this.RegisterTranslation(db.TOKEN_NOT, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
 		m := token.GetMembers()
-		return fmt.Sprintf("NOT %s", tx.Translate(dmlType, m[0]))
+		return fmt.Sprintf("NOT (%s)", tx.Translate(dmlType, m[0]))
 	})
 
 	this.RegisterTranslation(db.TOKEN_ALIAS, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
@@ -672,6 +828,11 @@ func (this *GenericTranslator) Init(overrider db.Translator) {
 		return fmt.Sprintf("MIN(%s)", RolloverParameter(dmlType, tx, m, ", "))
 	})
 
+	this.RegisterTranslation(db.TOKEN_STRING_AGG, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
+		m := token.GetMembers()
+		return fmt.Sprintf("STRING_AGG(%s, %s%s)", tx.Translate(dmlType, m[0]), tx.Translate(dmlType, m[1]), aggOrderBy(dmlType, tx, m[2:]))
+	})
+
 	this.RegisterTranslation(db.TOKEN_UPPER, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
 		m := token.GetMembers()
 		return fmt.Sprintf("UPPER(%s)", RolloverParameter(dmlType, tx, m, ", "))
@@ -706,6 +867,27 @@ func (this *GenericTranslator) Init(overrider db.Translator) {
 		return fmt.Sprintf("COUNT(%s)", tx.Translate(dmlType, m[0]))
 	})
 
+	this.RegisterTranslation(db.TOKEN_COUNT_DISTINCT, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
+		m := token.GetMembers()
+		return fmt.Sprintf("COUNT(DISTINCT %s)", tx.Translate(dmlType, m[0]))
+	})
+
+	// without FILTER, the rows not matching the criteria are aggregated as NULL, that every aggregate ignores
+	this.RegisterTranslation(db.TOKEN_FILTER, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
+		m := token.GetMembers()
+		aggregate := m[0]
+		if aggregate.GetOperator() == db.TOKEN_COUNT {
+			return fmt.Sprintf("COUNT(%s)", tx.Translate(dmlType, filterCase(m[1], db.AsIs(1))))
+		}
+		members := aggregate.GetMembers()
+		filtered := make([]db.Tokener, len(members))
+		copy(filtered, members)
+		filtered[0] = filterCase(m[1], members[0])
+		rewritten := aggregate.Clone().(db.Tokener)
+		rewritten.SetMembers(filtered...)
+		return tx.Translate(dmlType, rewritten)
+	})
+
 	this.RegisterTranslation(db.TOKEN_RTRIM, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
 		m := token.GetMembers()
 		return fmt.Sprintf("RTRIM(%s)", tx.Translate(dmlType, m[0]))
@@ -717,11 +899,25 @@ func (this *GenericTranslator) Init(overrider db.Translator) {
 		return fmt.Sprintf("( %s )", this.GetSqlForQuery(query))
 	})
 
+	this.RegisterTranslation(db.TOKEN_ANY, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
+		m := token.GetMembers()
+		return fmt.Sprintf("ANY %s", tx.Translate(dmlType, m[0]))
+	})
+
+	this.RegisterTranslation(db.TOKEN_ALL, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
+		m := token.GetMembers()
+		return fmt.Sprintf("ALL %s", tx.Translate(dmlType, m[0]))
+	})
+
 	this.RegisterTranslation(db.TOKEN_COALESCE, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
 		m := token.GetMembers()
 		return fmt.Sprintf("COALESCE(%s)", RolloverParameter(dmlType, tx, m, ", "))
 	})
 
+	// the databases with GREATEST and LEAST register the native functions
+	this.RegisterTranslation(db.TOKEN_GREATEST, this.GreatestAsCase)
+	this.RegisterTranslation(db.TOKEN_LEAST, this.LeastAsCase)
+
 	this.RegisterTranslation(db.TOKEN_CASE, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
 		m := token.GetMembers()
 		return fmt.Sprintf("CASE %s END", RolloverParameter(dmlType, tx, m, " "))
@@ -751,7 +947,41 @@ func (this *GenericTranslator) Translate(dmlType db.DmlType, token db.Tokener) s
 	panic("token " + tag + " is unknown")
 }
 
+// SetPlaceholderFormatter defines the placeholder style expected by the driver.
+func (this *GenericTranslator) SetPlaceholderFormatter(formatter PlaceholderFormatter) {
+	this.placeholder = formatter
+}
+
+// SetMaterializationHints enables the MATERIALIZED / NOT MATERIALIZED hints of the common table expressions.
+// When disabled the hints are omitted.
+func (this *GenericTranslator) SetMaterializationHints(enabled bool) {
+	this.materializationHints = enabled
+}
+
+// SetMaxParameters defines the maximum number of parameters of a statement, accepted by the database or by the driver.
+// A statement exceeding it, due to the values of an IN, is split in several. Zero means no maximum.
+func (this *GenericTranslator) SetMaxParameters(max int) {
+	this.maxParameters = max
+}
+
+func (this *GenericTranslator) GetMaxParameters() int {
+	return this.maxParameters
+}
+
+// SetMaxInValues defines the maximum number of values of an IN list, accepted by the database.
+// An IN exceeding it is split in several statements, as with SetMaxParameters. Zero means no maximum.
+func (this *GenericTranslator) SetMaxInValues(max int) {
+	this.maxInValues = max
+}
+
+func (this *GenericTranslator) GetMaxInValues() int {
+	return this.maxInValues
+}
+
 func (this *GenericTranslator) GetPlaceholder(index int, name string) string {
+	if this.placeholder != nil {
+		return this.placeholder(index)
+	}
 	return "?"
 }
 
@@ -790,6 +1020,10 @@ func (this *GenericTranslator) IgnoreNullKeys() bool {
 	return true
 }
 
+func (this *GenericTranslator) IdentifierCase() dbx.IdentifierCase {
+	return dbx.CASE_PRESERVE
+}
+
 func (this *GenericTranslator) GetAutoNumberQuery(column *db.Column) string {
 	return ""
 }
@@ -800,6 +1034,7 @@ func (this *GenericTranslator) CreateUpdateProcessor(update *db.Update) UpdatePr
 	proc.Column(update)
 	proc.From(update)
 	proc.Where(update)
+	AppendJoins(update.GetJoins(), proc)
 	return proc
 }
 
@@ -811,20 +1046,25 @@ func (this *GenericTranslator) GetSqlForUpdate(update *db.Update) string {
 	sel.Add("UPDATE ", proc.TablePart())
 	sel.Add(" SET ", proc.ColumnPart())
 	// JOINS
-	// sel.Add(proc.joinPart.String())
+	sel.Add(proc.JoinPart())
 	// WHERE - conditions
-	if update.GetCriteria() != nil {
-		sel.Add(" WHERE ", proc.WherePart())
+	if where := proc.WherePart(); where != "" {
+		sel.Add(" WHERE ", where)
 	}
 
 	return sel.String()
 }
 
+func (this *GenericTranslator) GetSqlForUpdateReturning(update *db.Update, columns []*db.Column) string {
+	return ""
+}
+
 // DELETE
 func (this *GenericTranslator) CreateDeleteProcessor(del *db.Delete) DeleteProcessor {
 	proc := this.DeleteProcessorFactory()
 	proc.From(del)
 	proc.Where(del)
+	AppendJoins(del.GetJoins(), proc)
 	return proc
 }
 
@@ -834,8 +1074,8 @@ func (this *GenericTranslator) GetSqlForDelete(del *db.Delete) string {
 	sb := tk.NewStrBuffer()
 
 	sb.Add("DELETE FROM ", proc.TablePart())
+	sb.Add(proc.JoinPart())
 	where := proc.WherePart()
-	// INNER JOINS NOT IMPLEMENTED
 	if where != "" {
 		sb.Add(" WHERE ", where)
 	}
@@ -878,15 +1118,8 @@ func (this *GenericTranslator) GetSqlForQuery(query *db.Query) string {
 	if query.IsDistinct() {
 		sel.Add("DISTINCT ")
 	}
-	sel.Add(proc.ColumnPart())
-	// FROM
-	sel.Add(" FROM ", proc.FromPart())
-	// JOINS
-	sel.Add(proc.JoinPart())
-	// WHERE - conditions
-	if query.GetCriteria() != nil {
-		sel.Add(" WHERE ", proc.WherePart())
-	}
+	sel.Add(proc.ColumnPart(), " ")
+	sel.Add(this.fromSql(query, proc))
 	// GROUP BY
 	if len(query.GetGroupBy()) != 0 {
 		sel.Add(" GROUP BY ", proc.GroupPart())
@@ -905,14 +1138,155 @@ func (this *GenericTranslator) GetSqlForQuery(query *db.Query) string {
 	}
 
 	sql := this.overrider.PaginateSQL(query, sel.String())
+	sql = this.overrider.LockSQL(query, sql)
 
+	return this.commonTablesSql(query) + sql
+}
+
+// the WITH clause of the common table expressions, if any
+func (this *GenericTranslator) commonTablesSql(query *db.Query) string {
+	commonTables := query.GetCommonTables()
+	if len(commonTables) == 0 {
+		return ""
+	}
+	sb := tk.NewStrBuffer()
+	sb.Add("WITH ")
+	for k, cte := range commonTables {
+		if k > 0 {
+			sb.Add(", ")
+		}
+		sb.Add(this.overrider.TableName(cte.Table), " (", this.columnNames(cte.Table), ") AS ")
+		if this.materializationHints {
+			switch cte.Materialization {
+			case db.MATERIALIZED:
+				sb.Add("MATERIALIZED ")
+			case db.NOT_MATERIALIZED:
+				sb.Add("NOT MATERIALIZED ")
+			}
+		}
+		sb.Add("(", this.overrider.GetSqlForQuery(cte.Query), ")")
+	}
+	sb.Add(" ")
+	return sb.String()
+}
+
+func (this *GenericTranslator) GetSqlForFrom(query *db.Query) string {
+	return this.fromSql(query, this.CreateQueryProcessor(query))
+}
+
+// CREATE TABLE ... AS SELECT
+func (this *GenericTranslator) GetSqlForCreateTableAs(query *db.Query, table *db.Table) string {
+	return "CREATE TABLE " + QualifiedTableName(this.overrider, query.GetDb(), table) +
+		" (" + this.columnNames(table) + ") AS " + this.overrider.GetSqlForQuery(query)
+}
+
+// the comma separated names of the columns of the table
+func (this *GenericTranslator) columnNames(table *db.Table) string {
+	sb := tk.NewStrBuffer()
+	for i, it := 0, table.GetColumns().Enumerator(); it.HasNext(); i++ {
+		if i > 0 {
+			sb.Add(", ")
+		}
+		sb.Add(this.overrider.ColumnName(it.Next().(*db.Column)))
+	}
+	return sb.String()
+}
+
+// the FROM, JOIN and WHERE parts
+func (this *GenericTranslator) fromSql(query *db.Query, proc QueryProcessor) string {
+	sel := tk.NewStrBuffer()
+	// FROM
+	sel.Add("FROM ", proc.FromPart())
+	// JOINS
+	sel.Add(proc.JoinPart())
+	// WHERE - conditions
+	if query.GetCriteria() != nil {
+		sel.Add(" WHERE ", proc.WherePart())
+	}
+	return sel.String()
+}
+
+func (this *GenericTranslator) GetSqlForSavepoint(name string) string {
+	return "SAVEPOINT " + name
+}
+
+func (this *GenericTranslator) GetSqlForRollbackTo(name string) string {
+	return "ROLLBACK TO SAVEPOINT " + name
+}
+
+// TRUNCATE
+func (this *GenericTranslator) GetSqlForTruncate(truncate *db.Truncate) string {
+	if truncate.IsCascade() {
+		panic("goSQL: TRUNCATE CASCADE is not supported")
+	}
+	sql := "TRUNCATE TABLE " + QualifiedTableName(this.overrider, truncate.GetDb(), truncate.GetTable())
+	if truncate.IsRestartIdentity() {
+		sql += " RESTART IDENTITY"
+	}
 	return sql
 }
 
+func (this *GenericTranslator) GetSqlForPing() string {
+	return "SELECT 1"
+}
+
+// TruncateAsDelete renders the truncate as a DELETE FROM, for databases without truncate
+// or where the truncate commits the transaction
+func (this *GenericTranslator) TruncateAsDelete(truncate *db.Truncate) string {
+	if truncate.IsCascade() || truncate.IsRestartIdentity() {
+		panic("goSQL: TRUNCATE options are not supported when rendered as DELETE")
+	}
+	return "DELETE FROM " + QualifiedTableName(this.overrider, truncate.GetDb(), truncate.GetTable())
+}
+
+func (this *GenericTranslator) GetSqlForReleaseSavepoint(name string) string {
+	return "RELEASE SAVEPOINT " + name
+}
+
+// no statement timeout by default
+func (this *GenericTranslator) GetSqlForStatementTimeout(timeout time.Duration) string {
+	return ""
+}
+
+// no server side cursors by default
+func (this *GenericTranslator) GetSqlForCursor(name string, sql string, fetchSize int) *dbx.Cursor {
+	return nil
+}
+
 func (this *GenericTranslator) PaginateSQL(query *db.Query, sql string) string {
 	return sql
 }
 
+// PaginateWithTies renders the standard OFFSET n ROWS FETCH FIRST n ROWS WITH TIES
+func (this *GenericTranslator) PaginateWithTies(query *db.Query, sql string) string {
+	if len(query.GetOrders()) == 0 {
+		panic("goSQL: WITH TIES requires an ORDER BY")
+	}
+	sb := tk.NewStrBuffer()
+	sb.Add(sql)
+	if query.GetSkip() > 0 {
+		sb.Add(" OFFSET :", db.OFFSET_PARAM, " ROWS")
+		query.SetParameter(db.OFFSET_PARAM, query.GetSkip())
+	}
+	sb.Add(" FETCH FIRST :", db.LIMIT_PARAM, " ROWS WITH TIES")
+	query.SetParameter(db.LIMIT_PARAM, query.GetLimit())
+	return sb.String()
+}
+
+// LockSQL renders the standard FOR UPDATE, without any wait option
+func (this *GenericTranslator) LockSQL(query *db.Query, sql string) string {
+	switch query.GetLockMode() {
+	case db.LOCK_NONE:
+		return sql
+	case db.LOCK_FOR_UPDATE:
+		if query.GetLockWait() != db.LOCK_WAIT {
+			panic("goSQL: the lock wait option is not supported by this translator")
+		}
+		return sql + " FOR UPDATE"
+	}
+	panic("goSQL: the lock mode is not supported by this translator")
+}
+
 func ReduceAssociations(cachedAssociation [][]*db.PathElement, join *db.Join) ([]*db.PathElement, [][]*db.PathElement) {
 	associations := join.GetPathElements()
 	common := db.DeepestCommonPath(cachedAssociation, associations)
@@ -959,6 +1333,109 @@ func AppendJoins(joins []*db.Join, joiner IJoiner) {
 	}
 }
 
+// DefaultAsOmitted leaves out of the insert the columns set with DEFAULT, for the databases
+// without the DEFAULT keyword in the values, so that the column default is applied.
+func (this *GenericTranslator) DefaultAsOmitted(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
+	if dmlType == db.INSERT {
+		return ""
+	}
+	return "DEFAULT"
+}
+
+// InTupleAsOr translates a tuple IN as an OR of AND groups, for the databases without row values.
+// ex: (A, B) IN ((1, 2), (3, 4)) -> (A = 1 AND B = 2 OR A = 3 AND B = 4)
+func (this *GenericTranslator) InTupleAsOr(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
+	c, ok := token.(*db.Criteria)
+	if !ok {
+		return ""
+	}
+	m := token.GetMembers()
+	if len(m) == 1 {
+		return this.emptyIn(c)
+	}
+
+	columns := m[0].GetMembers()
+	or := tk.NewStrBuffer()
+	for k, row := range m[1:] {
+		if k > 0 {
+			or.Add(" OR ")
+		}
+		for i, value := range row.GetMembers() {
+			if i > 0 {
+				or.Add(" AND ")
+			}
+			or.Add(tx.Translate(dmlType, columns[i]), " = ", tx.Translate(dmlType, value))
+		}
+	}
+	if c.IsNot {
+		return "NOT (" + or.String() + ")"
+	}
+	return "(" + or.String() + ")"
+}
+
+// MatchesAnyAsIn translates = ANY (subquery) as IN (subquery), for the databases without ANY.
+// The other matches are translated as usual.
+func (this *GenericTranslator) MatchesAnyAsIn(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
+	m := token.GetMembers()
+	if m[1] != nil && m[1].GetOperator() == db.TOKEN_ANY {
+		return tx.Translate(dmlType, m[0]) + " IN " + tx.Translate(dmlType, m[1].GetMembers()[0])
+	}
+	return tx.Translate(dmlType, m[0]) + " = " + tx.Translate(dmlType, m[1])
+}
+
+// FunctionOf translates a token as the function with the supplied name, having the members as arguments.
+// ex: FunctionOf("GREATEST") -> GREATEST(A, B)
+func FunctionOf(name string) func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
+	return func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
+		return name + "(" + RolloverParameter(dmlType, tx, token.GetMembers(), ", ") + ")"
+	}
+}
+
+// GreatestAsCase translates GREATEST as a CASE, for the databases without it.
+// ex: GREATEST(A, B, C) -> CASE WHEN A >= B AND A >= C THEN A WHEN B >= C THEN B ELSE C END
+func (this *GenericTranslator) GreatestAsCase(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
+	return extremeAsCase(dmlType, token, tx, " >= ")
+}
+
+// LeastAsCase translates LEAST as a CASE, for the databases without it.
+// ex: LEAST(A, B) -> CASE WHEN A <= B THEN A ELSE B END
+func (this *GenericTranslator) LeastAsCase(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
+	return extremeAsCase(dmlType, token, tx, " <= ")
+}
+
+// each value, except the last, is compared with all the values after it
+func extremeAsCase(dmlType db.DmlType, token db.Tokener, tx db.Translator, comparison string) string {
+	m := token.GetMembers()
+	values := make([]string, len(m))
+	for k, v := range m {
+		values[k] = tx.Translate(dmlType, v)
+	}
+
+	sb := tk.NewStrBuffer()
+	sb.Add("CASE")
+	last := len(values) - 1
+	for k := 0; k < last; k++ {
+		sb.Add(" WHEN ")
+		for i := k + 1; i <= last; i++ {
+			if i > k+1 {
+				sb.Add(" AND ")
+			}
+			sb.Add(values[k], comparison, values[i])
+		}
+		sb.Add(" THEN ", values[k])
+	}
+	sb.Add(" ELSE ", values[last], " END")
+	return sb.String()
+}
+
+// a tuple IN without rows is never true
+func (this *GenericTranslator) emptyIn(c *db.Criteria) string {
+	if c.IsNot {
+		return "1 = 1"
+	}
+	return "1 = 0"
+}
+
 func (this *GenericTranslator) isNot(c *db.Criteria) string {
 	if c.IsNot {
 		return " NOT"
@@ -971,6 +1448,24 @@ func (this *GenericTranslator) TableName(table *db.Table) string {
 	return table.GetName()
 }
 
+func (this *GenericTranslator) SchemaName(schema string) string {
+	return schema
+}
+
+// QualifiedTableName renders the table name prefixed by its schema, if any.
+// The schema of the table is resolved by the store, that may map it to another one.
+func QualifiedTableName(tx db.Translator, store db.IDb, table *db.Table) string {
+	schema := table.GetSchema()
+	if store != nil {
+		schema = store.ResolveSchema(schema)
+	}
+	name := tx.TableName(table)
+	if schema == "" {
+		return name
+	}
+	return tx.SchemaName(schema) + "." + name
+}
+
 func (this *GenericTranslator) ColumnName(column *db.Column) string {
 	return column.GetName()
 }
@@ -991,14 +1486,13 @@ func (this *GenericTranslator) ColumnAlias(token db.Tokener, position int) strin
 	return alias
 }
 
+func (this *GenericTranslator) Collate(expression string, collation string) string {
+	return expression + " COLLATE " + collation
+}
+
 // ORDER BY
 func (this *GenericTranslator) OrderBy(query *db.Query, order *db.Order) string {
-	var str string
-	if order.GetHolder() != nil {
-		str = this.Translate(db.QUERY, order.GetHolder())
-	} else {
-		str = order.GetAlias()
-	}
+	str := OrderExpression(this.overrider, query, order)
 
 	if order.IsAsc() {
 		str += " ASC"
@@ -4,11 +4,14 @@ import (
 	"github.com/quintans/goSQL/db"
 	tk "github.com/quintans/toolkit"
 
+	"fmt"
 	"strings"
 )
 
 type MySQL5Translator struct {
 	*GenericTranslator
+	// the generated keys are obtained from the driver result
+	lastInsertId bool
 }
 
 var _ db.Translator = &MySQL5Translator{}
@@ -17,10 +20,18 @@ func NewMySQL5Translator() *MySQL5Translator {
 	this := new(MySQL5Translator)
 	this.GenericTranslator = new(GenericTranslator)
 	this.Init(this)
+	this.RegisterTranslation(db.TOKEN_GREATEST, FunctionOf("GREATEST"))
+	this.RegisterTranslation(db.TOKEN_LEAST, FunctionOf("LEAST"))
+	this.RegisterTranslation(db.TOKEN_STRING_AGG, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
+		m := token.GetMembers()
+		return "GROUP_CONCAT(" + tx.Translate(dmlType, m[0]) + aggOrderBy(dmlType, tx, m[2:]) + " SEPARATOR " + tx.Translate(dmlType, m[1]) + ")"
+	})
 	this.QueryProcessorFactory = func() QueryProcessor { return NewQueryBuilder(this) }
 	this.InsertProcessorFactory = func() InsertProcessor { return NewInsertBuilder(this) }
-	this.UpdateProcessorFactory = func() UpdateProcessor { return NewUpdateBuilder(this) }
+	this.UpdateProcessorFactory = func() UpdateProcessor { return NewMySQL5UpdateBuilder(this) }
 	this.DeleteProcessorFactory = func() DeleteProcessor { return NewMySQL5DeleteBuilder(this) }
+	// the protocol counts the parameters with 16 bits
+	this.SetMaxParameters(65535)
 
 	return this
 }
@@ -39,10 +50,71 @@ func (this *MySQL5DeleteBuilder) From(del *db.Delete) {
 	table := del.GetTable()
 	alias := del.GetTableAlias()
 	// Multiple-table syntax:
-	this.tablePart.AddAsOne(alias, " USING ", this.translator.TableName(table), " AS ", alias)
+	this.store = del.GetDb()
+	this.tablePart.AddAsOne(alias, " USING ", QualifiedTableName(this.translator, this.store, table), " AS ", alias)
+}
+
+// DELETE t0 USING BOOK AS t0 INNER JOIN PUBLISHER t1 ON t1.ID = t0.PUBLISHER_ID
+func (this *MySQL5DeleteBuilder) JoinAssociation(fk *db.Association, inner bool) {
+	if !inner {
+		panic("goSQL: Only inner joins are supported in a DELETE")
+	}
+	this.joinPart.Add(" INNER JOIN ", QualifiedTableName(this.translator, this.store, fk.GetTableTo()), " ", fk.GetAliasTo(), " ON ")
+	for i, rel := range fk.GetRelations() {
+		if i > 0 {
+			this.joinPart.Add(" AND ")
+		}
+		this.joinPart.Add(this.translator.Translate(db.DELETE, rel.From),
+			" = ",
+			this.translator.Translate(db.DELETE, rel.To))
+	}
+}
+
+func (this *MySQL5DeleteBuilder) JoinCriteria(criteria *db.Criteria) {
+	this.joinPart.Add(" AND ", this.translator.Translate(db.DELETE, criteria))
+}
+
+type MySQL5UpdateBuilder struct {
+	UpdateBuilder
+}
+
+func NewMySQL5UpdateBuilder(translator db.Translator) *MySQL5UpdateBuilder {
+	this := new(MySQL5UpdateBuilder)
+	this.Super(translator)
+	return this
+}
+
+// UPDATE BOOK t0 INNER JOIN PUBLISHER t1 ON t1.ID = t0.PUBLISHER_ID SET t0.PRICE = ?
+func (this *MySQL5UpdateBuilder) JoinAssociation(fk *db.Association, inner bool) {
+	if !inner {
+		panic("goSQL: Only inner joins are supported in an UPDATE")
+	}
+	this.tablePart.Append(" INNER JOIN ", QualifiedTableName(this.translator, this.store, fk.GetTableTo()), " ", fk.GetAliasTo(), " ON ")
+	for i, rel := range fk.GetRelations() {
+		if i > 0 {
+			this.tablePart.Append(" AND ")
+		}
+		this.tablePart.Append(this.translator.Translate(db.UPDATE, rel.From),
+			" = ",
+			this.translator.Translate(db.UPDATE, rel.To))
+	}
+}
+
+func (this *MySQL5UpdateBuilder) JoinCriteria(criteria *db.Criteria) {
+	this.tablePart.Append(" AND ", this.translator.Translate(db.UPDATE, criteria))
+}
+
+// UseLastInsertId obtains the generated keys from the driver result (sql.Result.LastInsertId),
+// saving the SELECT LAST_INSERT_ID() issued after each insert, by default.
+func (this *MySQL5Translator) UseLastInsertId(enabled bool) *MySQL5Translator {
+	this.lastInsertId = enabled
+	return this
 }
 
 func (this *MySQL5Translator) GetAutoKeyStrategy() db.AutoKeyStrategy {
+	if this.lastInsertId {
+		return db.AUTOKEY_LAST_INSERT_ID
+	}
 	return db.AUTOKEY_AFTER
 }
 
@@ -50,15 +122,80 @@ func (this *MySQL5Translator) GetAutoNumberQuery(column *db.Column) string {
 	return "select LAST_INSERT_ID()"
 }
 
+// the truncate commits the transaction, so inside one, it is rendered as a delete.
+// The truncate always restarts the auto increment.
+func (this *MySQL5Translator) GetSqlForTruncate(truncate *db.Truncate) string {
+	if truncate.IsCascade() {
+		panic("goSQL: TRUNCATE CASCADE is not supported by MySQL 5")
+	}
+	if truncate.GetDb().InTransaction() {
+		return this.TruncateAsDelete(truncate)
+	}
+	return "TRUNCATE TABLE " + QualifiedTableName(this, truncate.GetDb(), truncate.GetTable())
+}
+
+// MySQL 5 has no common table expressions (WITH)
+func (this *MySQL5Translator) GetSqlForQuery(query *db.Query) string {
+	if len(query.GetCommonTables()) > 0 {
+		panic("goSQL: WITH (common table expressions) is not supported by MySQL 5")
+	}
+	return this.GenericTranslator.GetSqlForQuery(query)
+}
+
+// MySQL has no column list without the types, so the columns of the query are renamed in an outer SELECT.
+// ex: CREATE TABLE `CHEAP` AS SELECT s.t0_ID AS `ID` FROM (SELECT ...) s
+func (this *MySQL5Translator) GetSqlForCreateTableAs(query *db.Query, table *db.Table) string {
+	if len(query.Columns) != table.GetColumns().Size() {
+		panic(fmt.Sprintf("goSQL: The query has %v columns but the table %s has %v", len(query.Columns), table, table.GetColumns().Size()))
+	}
+	sb := tk.NewStrBuffer()
+	sb.Add("CREATE TABLE ", QualifiedTableName(this, query.GetDb(), table), " AS SELECT ")
+	for k, it := 0, table.GetColumns().Enumerator(); it.HasNext(); k++ {
+		if k > 0 {
+			sb.Add(", ")
+		}
+		token := query.Columns[k]
+		alias := this.ColumnAlias(token, k+1)
+		if alias == "" {
+			alias = this.Translate(db.QUERY, token)
+		}
+		sb.Add("s.", alias, " AS ", this.ColumnName(it.Next().(*db.Column)))
+	}
+	sb.Add(" FROM (", this.GetSqlForQuery(query), ") s")
+	return sb.String()
+}
+
 func (this *MySQL5Translator) TableName(table *db.Table) string {
 	return "`" + strings.ToUpper(table.GetName()) + "`"
 }
 
+func (this *MySQL5Translator) SchemaName(schema string) string {
+	return "`" + schema + "`"
+}
+
 func (this *MySQL5Translator) ColumnName(column *db.Column) string {
 	return "`" + strings.ToUpper(column.GetName()) + "`"
 }
 
+// MySQL 5 has no NOWAIT nor SKIP LOCKED
+func (this *MySQL5Translator) LockSQL(query *db.Query, sql string) string {
+	mode := query.GetLockMode()
+	if mode == db.LOCK_NONE {
+		return sql
+	}
+	if query.GetLockWait() != db.LOCK_WAIT {
+		panic("goSQL: NOWAIT and SKIP LOCKED are not supported by MySQL 5")
+	}
+	if mode == db.LOCK_FOR_SHARE {
+		return sql + " LOCK IN SHARE MODE"
+	}
+	return sql + " FOR UPDATE"
+}
+
 func (this *MySQL5Translator) PaginateSQL(query *db.Query, sql string) string {
+	if query.IsWithTies() {
+		panic("goSQL: WITH TIES is not supported by MySQL 5")
+	}
 	sb := tk.NewStrBuffer()
 	if query.GetLimit() > 0 {
 		sb.Add(sql, " LIMIT :", db.OFFSET_PARAM, ", :", db.LIMIT_PARAM)
@@ -67,6 +204,11 @@ func (this *MySQL5Translator) PaginateSQL(query *db.Query, sql string) string {
 		}
 		query.SetParameter(db.LIMIT_PARAM, query.GetLimit())
 		return sb.String()
+	} else if query.GetSkip() > 0 {
+		// MySQL has no OFFSET without LIMIT, so the limit is the largest possible
+		sb.Add(sql, " LIMIT :", db.OFFSET_PARAM, ", 18446744073709551615")
+		query.SetParameter(db.OFFSET_PARAM, query.GetSkip())
+		return sb.String()
 	}
 
 	return sql
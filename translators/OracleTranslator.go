@@ -2,6 +2,7 @@ package translators
 
 import (
 	"github.com/quintans/goSQL/db"
+	"github.com/quintans/goSQL/dbx"
 
 	"fmt"
 	"strings"
@@ -17,10 +18,22 @@ func NewOracleTranslator() *OracleTranslator {
 	this := new(OracleTranslator)
 	this.GenericTranslator = new(GenericTranslator)
 	this.Init(this)
+	this.RegisterTranslation(db.TOKEN_GREATEST, FunctionOf("GREATEST"))
+	this.RegisterTranslation(db.TOKEN_LEAST, FunctionOf("LEAST"))
+	this.RegisterTranslation(db.TOKEN_STRING_AGG, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
+		m := token.GetMembers()
+		orderBy := "NULL"
+		if len(m) > 2 {
+			orderBy = RolloverParameter(dmlType, tx, m[2:], ", ")
+		}
+		return fmt.Sprintf("LISTAGG(%s, %s) WITHIN GROUP (ORDER BY %s)", tx.Translate(dmlType, m[0]), tx.Translate(dmlType, m[1]), orderBy)
+	})
 	this.QueryProcessorFactory = func() QueryProcessor { return NewQueryBuilder(this) }
 	this.InsertProcessorFactory = func() InsertProcessor { return NewInsertBuilder(this) }
 	this.UpdateProcessorFactory = func() UpdateProcessor { return NewUpdateBuilder(this) }
 	this.DeleteProcessorFactory = func() DeleteProcessor { return NewDeleteBuilder(this) }
+	// a list of values is limited to 1000 expressions (ORA-01795)
+	this.SetMaxInValues(1000)
 	return this
 }
 
@@ -32,16 +45,86 @@ func (this *OracleTranslator) GetAutoNumberQuery(column *db.Column) string {
 	return "select " + strings.ToUpper(column.GetTable().GetName()) + "_SEQ.nextval from dual"
 }
 
+// the truncate commits the transaction, so inside one, it is rendered as a delete
+func (this *OracleTranslator) GetSqlForTruncate(truncate *db.Truncate) string {
+	if truncate.IsRestartIdentity() {
+		panic("goSQL: TRUNCATE RESTART IDENTITY is not supported by Oracle")
+	}
+	if truncate.GetDb().InTransaction() {
+		return this.TruncateAsDelete(truncate)
+	}
+	sql := "TRUNCATE TABLE " + QualifiedTableName(this, truncate.GetDb(), truncate.GetTable())
+	if truncate.IsCascade() {
+		sql += " CASCADE"
+	}
+	return sql
+}
+
+// Oracle does not accept bind variables in DDL (ORA-01027)
+func (this *OracleTranslator) GetSqlForCreateTableAs(query *db.Query, table *db.Table) string {
+	sql := this.GenericTranslator.GetSqlForCreateTableAs(query, table)
+	if dbx.CountPlaceholders(sql) > 0 {
+		panic("goSQL: CREATE TABLE AS with parameters is not supported by Oracle")
+	}
+	return sql
+}
+
+func (this *OracleTranslator) GetSqlForPing() string {
+	return "SELECT 1 FROM DUAL"
+}
+
 func (this *OracleTranslator) TableName(table *db.Table) string {
 	return "\"" + strings.ToUpper(table.GetName()) + "\""
 }
 
+func (this *OracleTranslator) SchemaName(schema string) string {
+	return "\"" + strings.ToUpper(schema) + "\""
+}
+
+func (this *OracleTranslator) IdentifierCase() dbx.IdentifierCase {
+	return dbx.CASE_UPPER
+}
+
 func (this *OracleTranslator) ColumnName(column *db.Column) string {
 	return "\"" + strings.ToUpper(column.GetName()) + "\""
 }
 
+// linguistic sort. ex: NLSSORT(name, 'NLS_SORT=BINARY_CI')
+func (this *OracleTranslator) Collate(expression string, collation string) string {
+	return "NLSSORT(" + expression + ", 'NLS_SORT=" + collation + "')"
+}
+
+// Oracle releases the savepoints only at the end of the transaction
+func (this *OracleTranslator) GetSqlForReleaseSavepoint(name string) string {
+	return ""
+}
+
+// the pagination wraps the query, with ROWNUM, or uses FETCH FIRST, and both cannot be locked (ORA-02014)
+func (this *OracleTranslator) LockSQL(query *db.Query, sql string) string {
+	switch query.GetLockMode() {
+	case db.LOCK_NONE:
+		return sql
+	case db.LOCK_FOR_SHARE:
+		panic("goSQL: FOR SHARE is not supported by Oracle")
+	}
+	if query.GetLimit() > 0 || query.GetSkip() > 0 {
+		panic("goSQL: FOR UPDATE with pagination is not supported by Oracle")
+	}
+	switch query.GetLockWait() {
+	case db.LOCK_NOWAIT:
+		return sql + " FOR UPDATE NOWAIT"
+	case db.LOCK_SKIP_LOCKED:
+		return sql + " FOR UPDATE SKIP LOCKED"
+	}
+	return sql + " FOR UPDATE"
+}
+
 func (this *OracleTranslator) PaginateSQL(query *db.Query, sql string) string {
-	if query.GetSkip() > 0 {
+	// since Oracle 12c
+	if query.IsWithTies() {
+		return this.PaginateWithTies(query, sql)
+	}
+	if query.GetSkip() > 0 && query.GetLimit() > 0 {
 		query.SetParameter(db.OFFSET_PARAM, query.GetSkip()+1)
 		query.SetParameter(db.LIMIT_PARAM, query.GetSkip()+query.GetLimit())
 		return fmt.Sprintf("select * from ( select a.*, rownum rnum from ( %s ) a where rownum <= :%s ) where rnum >= :%s",
@@ -49,6 +132,10 @@ func (this *OracleTranslator) PaginateSQL(query *db.Query, sql string) string {
 	} else if query.GetLimit() > 0 {
 		query.SetParameter(db.LIMIT_PARAM, query.GetLimit())
 		return fmt.Sprintf("select * from ( %s ) where rownum <= :%s", sql, db.LIMIT_PARAM)
+	} else if query.GetSkip() > 0 {
+		query.SetParameter(db.OFFSET_PARAM, query.GetSkip()+1)
+		return fmt.Sprintf("select * from ( select a.*, rownum rnum from ( %s ) a ) where rnum >= :%s",
+			sql, db.OFFSET_PARAM)
 	}
 
 	return sql
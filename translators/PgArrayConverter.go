@@ -0,0 +1,168 @@
+package translators
+
+import (
+	"github.com/quintans/goSQL/db"
+	tk "github.com/quintans/toolkit"
+
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var _ db.Converter = &PgArrayConverter{}
+
+// PgArrayConverter converts one dimensional Go slices of numbers, strings or booleans
+// to and from Postgres arrays, without depending on the driver.
+//
+// ex: BOOK.COLUMN("TAGS").Convert(translators.NewPgArrayConverter([]string{}))
+type PgArrayConverter struct {
+	typ reflect.Type
+}
+
+// NewPgArrayConverter creates a converter for the slice type of the template.
+func NewPgArrayConverter(template interface{}) *PgArrayConverter {
+	typ := reflect.TypeOf(template)
+	if typ == nil || typ.Kind() != reflect.Slice {
+		panic("The template for a Postgres array must be a slice")
+	}
+	this := new(PgArrayConverter)
+	this.typ = typ
+	return this
+}
+
+// ToDb renders the slice as a Postgres array literal. ex: {1,2,3}
+func (this *PgArrayConverter) ToDb(in interface{}) (interface{}, error) {
+	v := reflect.ValueOf(in)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.Kind() == reflect.Slice && v.IsNil() {
+		return nil, nil
+	}
+	if v.Kind() != reflect.Slice {
+		return nil, errors.New(fmt.Sprintf("goSQL: Expected a slice for a Postgres array. Got %T", in))
+	}
+
+	sb := tk.NewStrBuffer()
+	sb.Add("{")
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 {
+			sb.Add(",")
+		}
+		e := v.Index(i)
+		switch e.Kind() {
+		case reflect.String:
+			s := strings.Replace(e.String(), `\`, `\\`, -1)
+			s = strings.Replace(s, `"`, `\"`, -1)
+			sb.Add(`"`, s, `"`)
+		default:
+			sb.Add(fmt.Sprint(e.Interface()))
+		}
+	}
+	sb.Add("}")
+	return sb.String(), nil
+}
+
+func (this *PgArrayConverter) FromDbInstance() interface{} {
+	return new(sql.NullString)
+}
+
+// FromDb parses the Postgres array literal into a new slice
+func (this *PgArrayConverter) FromDb(in interface{}) (interface{}, error) {
+	ns := in.(*sql.NullString)
+	if !ns.Valid {
+		return nil, nil
+	}
+
+	s := strings.TrimSpace(ns.String)
+	if len(s) < 2 || s[0] != '{' || s[len(s)-1] != '}' {
+		return nil, errors.New(fmt.Sprintf("goSQL: Invalid Postgres array %s", s))
+	}
+
+	elems := splitPgArray(s[1 : len(s)-1])
+	slice := reflect.MakeSlice(this.typ, len(elems), len(elems))
+	for i, elem := range elems {
+		if err := setPgElement(slice.Index(i), elem); err != nil {
+			return nil, err
+		}
+	}
+	return slice.Interface(), nil
+}
+
+// splits the array content by comma, honoring quoted elements
+func splitPgArray(s string) []*string {
+	var elems []*string
+	if s == "" {
+		return elems
+	}
+
+	var current []byte
+	quoted, wasQuoted, escaped := false, false, false
+	add := func() {
+		e := string(current)
+		if !wasQuoted && strings.ToUpper(e) == "NULL" {
+			elems = append(elems, nil)
+		} else {
+			elems = append(elems, &e)
+		}
+		current = nil
+		wasQuoted = false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case escaped:
+			current = append(current, c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+			wasQuoted = true
+		case c == ',' && !quoted:
+			add()
+		default:
+			current = append(current, c)
+		}
+	}
+	add()
+	return elems
+}
+
+// NULL elements are left with the zero value
+func setPgElement(v reflect.Value, elem *string) error {
+	if elem == nil {
+		return nil
+	}
+	s := *elem
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		v.SetBool(s == "t" || s == "true")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return errors.New(fmt.Sprintf("goSQL: Unsupported Postgres array element type %s", v.Type()))
+	}
+	return nil
+}
@@ -2,10 +2,12 @@ package translators
 
 import (
 	"github.com/quintans/goSQL/db"
+	"github.com/quintans/goSQL/dbx"
 	tk "github.com/quintans/toolkit"
 
 	"strconv"
 	"strings"
+	"time"
 )
 
 type PostgreSQLTranslator struct {
@@ -18,10 +20,21 @@ func NewPostgreSQLTranslator() *PostgreSQLTranslator {
 	this := new(PostgreSQLTranslator)
 	this.GenericTranslator = new(GenericTranslator)
 	this.Init(this)
+	this.RegisterTranslation(db.TOKEN_GREATEST, FunctionOf("GREATEST"))
+	this.RegisterTranslation(db.TOKEN_LEAST, FunctionOf("LEAST"))
+	this.RegisterTranslation(db.TOKEN_FILTER, func(dmlType db.DmlType, token db.Tokener, tx db.Translator) string {
+		m := token.GetMembers()
+		return tx.Translate(dmlType, m[0]) + " FILTER (WHERE " + tx.Translate(dmlType, m[1]) + ")"
+	})
 	this.QueryProcessorFactory = func() QueryProcessor { return NewQueryBuilder(this) }
 	this.InsertProcessorFactory = func() InsertProcessor { return NewInsertBuilder(this) }
 	this.UpdateProcessorFactory = func() UpdateProcessor { return NewPgUpdateBuilder(this) }
-	this.DeleteProcessorFactory = func() DeleteProcessor { return NewDeleteBuilder(this) }
+	this.DeleteProcessorFactory = func() DeleteProcessor { return NewPgDeleteBuilder(this) }
+	this.SetPlaceholderFormatter(DollarPlaceholder)
+	// Postgres 12+
+	this.SetMaterializationHints(true)
+	// the protocol counts the parameters with 16 bits
+	this.SetMaxParameters(65535)
 	return this
 }
 
@@ -29,10 +42,6 @@ func (this *PostgreSQLTranslator) GetAutoKeyStrategy() db.AutoKeyStrategy {
 	return db.AUTOKEY_RETURNING
 }
 
-func (this *PostgreSQLTranslator) GetPlaceholder(index int, name string) string {
-	return "$" + strconv.Itoa(index+1)
-}
-
 // INSERT
 func (this *PostgreSQLTranslator) GetSqlForInsert(insert *db.Insert) string {
 	// insert generated by super
@@ -51,26 +60,91 @@ func (this *PostgreSQLTranslator) GetSqlForInsert(insert *db.Insert) string {
 	return sql
 }
 
+// SET LOCAL ends with the transaction, so the limit does not leak to the next user of the pooled connection.
+// The timeout is rounded up to milliseconds, since zero would remove the limit
+func (this *PostgreSQLTranslator) GetSqlForStatementTimeout(timeout time.Duration) string {
+	ms := (timeout + time.Millisecond - 1) / time.Millisecond
+	return "SET LOCAL statement_timeout = " + strconv.FormatInt(int64(ms), 10)
+}
+
+func (this *PostgreSQLTranslator) GetSqlForUpdateReturning(update *db.Update, columns []*db.Column) string {
+	// the columns are qualified, since the joined tables (FROM) can have columns with the same name
+	returning := tk.NewJoiner(", ")
+	for _, column := range columns {
+		returning.Add(update.GetTableAlias() + "." + this.overrider.ColumnName(column))
+	}
+	return this.overrider.GetSqlForUpdate(update) + " RETURNING " + returning.String()
+}
+
+func (this *PostgreSQLTranslator) GetSqlForTruncate(truncate *db.Truncate) string {
+	sql := "TRUNCATE TABLE " + QualifiedTableName(this, truncate.GetDb(), truncate.GetTable())
+	if truncate.IsRestartIdentity() {
+		sql += " RESTART IDENTITY"
+	}
+	if truncate.IsCascade() {
+		sql += " CASCADE"
+	}
+	return sql
+}
+
 func (this *PostgreSQLTranslator) TableName(table *db.Table) string {
 	return strings.ToLower(table.GetName())
 }
 
+func (this *PostgreSQLTranslator) SchemaName(schema string) string {
+	return strings.ToLower(schema)
+}
+
+func (this *PostgreSQLTranslator) IdentifierCase() dbx.IdentifierCase {
+	return dbx.CASE_LOWER
+}
+
 func (this *PostgreSQLTranslator) ColumnName(column *db.Column) string {
 	return strings.ToLower(column.GetName())
 }
 
+func (this *PostgreSQLTranslator) Collate(expression string, collation string) string {
+	return expression + ` COLLATE "` + collation + `"`
+}
+
 //// UPDATE
 
 type PgUpdateBuilder struct {
 	UpdateBuilder
+	fromPart *tk.Joiner
 }
 
 func NewPgUpdateBuilder(translator db.Translator) *PgUpdateBuilder {
 	this := new(PgUpdateBuilder)
 	this.Super(translator)
+	this.fromPart = tk.NewJoiner(", ")
 	return this
 }
 
+func (this *PgUpdateBuilder) JoinPart() string {
+	if from := this.fromPart.String(); from != "" {
+		return " FROM " + from
+	}
+	return ""
+}
+
+// UPDATE book t0 SET price = $1 FROM publisher t1 WHERE t1.id = t0.publisher_id
+func (this *PgUpdateBuilder) JoinAssociation(fk *db.Association, inner bool) {
+	if !inner {
+		panic("goSQL: Only inner joins are supported in an UPDATE")
+	}
+	this.fromPart.AddAsOne(QualifiedTableName(this.translator, this.store, fk.GetTableTo()), " ", fk.GetAliasTo())
+	for _, rel := range fk.GetRelations() {
+		this.wherePart.Add(this.translator.Translate(db.UPDATE, rel.From) +
+			" = " +
+			this.translator.Translate(db.UPDATE, rel.To))
+	}
+}
+
+func (this *PgUpdateBuilder) JoinCriteria(criteria *db.Criteria) {
+	this.wherePart.Add(this.translator.Translate(db.UPDATE, criteria))
+}
+
 func (this *PgUpdateBuilder) Column(update *db.Update) {
 	values := update.GetValues()
 	for it := values.Iterator(); it.HasNext(); {
@@ -84,7 +158,39 @@ func (this *PgUpdateBuilder) Column(update *db.Update) {
 	}
 }
 
+// the cursor is only valid inside a transaction
+func (this *PostgreSQLTranslator) GetSqlForCursor(name string, sql string, fetchSize int) *dbx.Cursor {
+	return &dbx.Cursor{
+		Declare:   "DECLARE " + name + " NO SCROLL CURSOR FOR " + sql,
+		Fetch:     "FETCH FORWARD " + strconv.Itoa(fetchSize) + " FROM " + name,
+		Close:     "CLOSE " + name,
+		FetchSize: fetchSize,
+	}
+}
+
+func (this *PostgreSQLTranslator) LockSQL(query *db.Query, sql string) string {
+	switch query.GetLockMode() {
+	case db.LOCK_FOR_UPDATE:
+		sql += " FOR UPDATE"
+	case db.LOCK_FOR_SHARE:
+		sql += " FOR SHARE"
+	default:
+		return sql
+	}
+	switch query.GetLockWait() {
+	case db.LOCK_NOWAIT:
+		sql += " NOWAIT"
+	case db.LOCK_SKIP_LOCKED:
+		sql += " SKIP LOCKED"
+	}
+	return sql
+}
+
 func (this *PostgreSQLTranslator) PaginateSQL(query *db.Query, sql string) string {
+	// since PostgreSQL 13
+	if query.IsWithTies() {
+		return this.PaginateWithTies(query, sql)
+	}
 	sb := tk.NewStrBuffer()
 	if query.GetLimit() > 0 {
 		sb.Add(sql, " LIMIT :", db.LIMIT_PARAM)
@@ -94,7 +200,49 @@ func (this *PostgreSQLTranslator) PaginateSQL(query *db.Query, sql string) strin
 			query.SetParameter(db.OFFSET_PARAM, query.GetSkip())
 		}
 		return sb.String()
+	} else if query.GetSkip() > 0 {
+		sb.Add(sql, " OFFSET :", db.OFFSET_PARAM)
+		query.SetParameter(db.OFFSET_PARAM, query.GetSkip())
+		return sb.String()
 	}
 
 	return sql
 }
+
+//// DELETE
+
+type PgDeleteBuilder struct {
+	DeleteBuilder
+	usingPart *tk.Joiner
+}
+
+func NewPgDeleteBuilder(translator db.Translator) *PgDeleteBuilder {
+	this := new(PgDeleteBuilder)
+	this.Super(translator)
+	this.usingPart = tk.NewJoiner(", ")
+	return this
+}
+
+func (this *PgDeleteBuilder) JoinPart() string {
+	if using := this.usingPart.String(); using != "" {
+		return " USING " + using
+	}
+	return ""
+}
+
+// DELETE FROM book t0 USING publisher t1 WHERE t1.id = t0.publisher_id
+func (this *PgDeleteBuilder) JoinAssociation(fk *db.Association, inner bool) {
+	if !inner {
+		panic("goSQL: Only inner joins are supported in a DELETE")
+	}
+	this.usingPart.AddAsOne(QualifiedTableName(this.translator, this.store, fk.GetTableTo()), " ", fk.GetAliasTo())
+	for _, rel := range fk.GetRelations() {
+		this.wherePart.Add(this.translator.Translate(db.DELETE, rel.From) +
+			" = " +
+			this.translator.Translate(db.DELETE, rel.To))
+	}
+}
+
+func (this *PgDeleteBuilder) JoinCriteria(criteria *db.Criteria) {
+	this.wherePart.Add(this.translator.Translate(db.DELETE, criteria))
+}